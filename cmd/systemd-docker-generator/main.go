@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/oott123/systemd-docker/pkg/generator"
+)
+
+func main() {
+	os.Exit(generator.Main(os.Args[1:]))
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/oott123/systemd-docker/pkg/supervisor"
+)
+
+func main() {
+	os.Exit(supervisor.Main(os.Args[1:]))
+}
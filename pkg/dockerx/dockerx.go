@@ -0,0 +1,135 @@
+/* Package dockerx is the part of the Docker SDK systemd-docker builds on, and
+ * the helpers around it the supervisor shares with embedding programs. */
+package dockerx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/checkpoint"
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerEvents "github.com/docker/docker/api/types/events"
+	dockerImage "github.com/docker/docker/api/types/image"
+	dockerRegistry "github.com/docker/docker/api/types/registry"
+	dockerSystem "github.com/docker/docker/api/types/system"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/sockets"
+)
+
+/* API is the part of the Docker SDK client we use, tests point a real
+ * client at a fake daemon */
+type API interface {
+	ContainerInspect(ctx context.Context, id string) (dockerContainer.InspectResponse, error)
+	ContainerStart(ctx context.Context, id string, options dockerContainer.StartOptions) error
+	ContainerStop(ctx context.Context, id string, options dockerContainer.StopOptions) error
+	ContainerKill(ctx context.Context, id, signal string) error
+	ContainerWait(ctx context.Context, id string, condition dockerContainer.WaitCondition) (<-chan dockerContainer.WaitResponse, <-chan error)
+	ContainerRemove(ctx context.Context, id string, options dockerContainer.RemoveOptions) error
+	ContainerList(ctx context.Context, options dockerContainer.ListOptions) ([]dockerContainer.Summary, error)
+	ContainerLogs(ctx context.Context, id string, options dockerContainer.LogsOptions) (io.ReadCloser, error)
+	ContainerAttach(ctx context.Context, id string, options dockerContainer.AttachOptions) (types.HijackedResponse, error)
+	ContainerResize(ctx context.Context, id string, options dockerContainer.ResizeOptions) error
+	ContainerStatsOneShot(ctx context.Context, id string) (dockerContainer.StatsResponseReader, error)
+	ContainerUpdate(ctx context.Context, id string, config dockerContainer.UpdateConfig) (dockerContainer.UpdateResponse, error)
+	ContainerExecCreate(ctx context.Context, id string, options dockerContainer.ExecOptions) (dockerContainer.ExecCreateResponse, error)
+	ContainerExecAttach(ctx context.Context, execId string, options dockerContainer.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execId string) (dockerContainer.ExecInspect, error)
+	CheckpointCreate(ctx context.Context, id string, options checkpoint.CreateOptions) error
+	ImageInspect(ctx context.Context, id string, options ...dockerClient.ImageInspectOption) (dockerImage.InspectResponse, error)
+	ImagePull(ctx context.Context, ref string, options dockerImage.PullOptions) (io.ReadCloser, error)
+	ImageRemove(ctx context.Context, id string, options dockerImage.RemoveOptions) ([]dockerImage.DeleteResponse, error)
+	DistributionInspect(ctx context.Context, ref, encodedAuth string) (dockerRegistry.DistributionInspect, error)
+	Events(ctx context.Context, options dockerEvents.ListOptions) (<-chan dockerEvents.Message, <-chan error)
+	Info(ctx context.Context) (dockerSystem.Info, error)
+	ServerVersion(ctx context.Context) (types.Version, error)
+	Ping(ctx context.Context) (types.Ping, error)
+	NegotiateAPIVersion(ctx context.Context)
+	ClientVersion() string
+}
+
+/* NewClient talks to host with DOCKER_API_VERSION if set, otherwise with the
+ * highest API version both sides support.  A non nil wrap wraps the HTTP
+ * transport, to trace requests for example. */
+func NewClient(host string, wrap func(http.RoundTripper) http.RoundTripper) (*dockerClient.Client, error) {
+	opts := []dockerClient.Opt{dockerClient.WithHost(host)}
+	if len(os.Getenv("DOCKER_API_VERSION")) > 0 {
+		opts = append(opts, dockerClient.WithVersionFromEnv())
+	} else {
+		opts = append(opts, dockerClient.WithAPIVersionNegotiation())
+	}
+
+	if wrap != nil {
+		url, err := dockerClient.ParseHostURL(host)
+		if err != nil {
+			return nil, err
+		}
+
+		transport := &http.Transport{}
+		err = sockets.ConfigureTransport(transport, url.Scheme, url.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		/* After WithHost, which only configures a plain *http.Transport */
+		opts = append(opts, dockerClient.WithHTTPClient(&http.Client{
+			Transport: wrap(transport),
+		}))
+	}
+
+	return dockerClient.NewClientWithOpts(opts...)
+}
+
+func IsNotFound(err error) bool {
+	return cerrdefs.IsNotFound(err)
+}
+
+/* IsConflict is true if the daemon refused because something still uses the
+ * object, an image of a container for example */
+func IsConflict(err error) bool {
+	return cerrdefs.IsConflict(err)
+}
+
+/* IsUnreachable is true if err comes from not reaching the daemon at all */
+func IsUnreachable(err error) bool {
+	return dockerClient.IsErrConnectionFailed(err)
+}
+
+/* StartedAt parses the State.StartedAt docker reports, zero if the container
+ * never started */
+func StartedAt(container *dockerContainer.InspectResponse) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, container.State.StartedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func HasTty(container *dockerContainer.InspectResponse) bool {
+	return container.Config != nil && container.Config.Tty
+}
+
+func HealthStatus(container *dockerContainer.InspectResponse) string {
+	if container.State.Health == nil {
+		return ""
+	}
+	return string(container.State.Health.Status)
+}
+
+/* CopyOutput splits a container's output into stdout and stderr.  Without a
+ * TTY docker multiplexes both into one stream of frames, a TTY's output is a
+ * plain byte stream and all of it is stdout. */
+func CopyOutput(tty bool, stdout, stderr io.Writer, stream io.Reader) error {
+	var err error
+	if tty {
+		_, err = io.Copy(stdout, stream)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, stream)
+	}
+	return err
+}
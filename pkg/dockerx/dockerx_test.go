@@ -0,0 +1,48 @@
+package dockerx
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestStartedAt(t *testing.T) {
+	container := &dockerContainer.InspectResponse{ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+		State: &dockerContainer.State{StartedAt: "2024-03-01T10:00:00.123456789Z"},
+	}}
+	if !StartedAt(container).Equal(time.Date(2024, 3, 1, 10, 0, 0, 123456789, time.UTC)) {
+		t.Fatal("Bad start time", StartedAt(container))
+	}
+
+	container.State.StartedAt = "0001-01-01T00:00:00Z"
+	if !StartedAt(container).IsZero() {
+		t.Fatal("A container that never started has no start time")
+	}
+}
+
+func TestCopyOutput(t *testing.T) {
+	var stream bytes.Buffer
+	stdcopy.NewStdWriter(&stream, stdcopy.Stdout).Write([]byte("out\n"))
+	stdcopy.NewStdWriter(&stream, stdcopy.Stderr).Write([]byte("err\n"))
+
+	var stdout, stderr bytes.Buffer
+	err := CopyOutput(false, &stdout, &stderr, bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Fatal("Bad demux", stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	err = CopyOutput(true, &stdout, &stderr, bytes.NewReader([]byte("raw\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "raw\n" {
+		t.Fatal("A tty's output should be copied as is", stdout.String())
+	}
+}
@@ -0,0 +1,360 @@
+/* Package generator turns .container files into service units running
+ * systemd-docker, the way Podman's Quadlet does.  It runs as a systemd
+ * generator, at boot and on every daemon-reload:
+ *
+ *   [Unit]
+ *   Description=Nginx
+ *
+ *   [Container]
+ *   Image=nginx:stable
+ *   PublishPort=8080:80
+ *   Volume=/srv/www:/usr/share/nginx/html:ro
+ *
+ *   [Install]
+ *   WantedBy=multi-user.target
+ *
+ * in /etc/systemd-docker/nginx.container becomes nginx.service. */
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	CONTAINER_DIR  = "/etc/systemd-docker"
+	DEFAULT_BINARY = "/opt/bin/systemd-docker"
+)
+
+/* containerKeys maps keys of [Container] to the docker run flag they become */
+var containerKeys = map[string]string{
+	"Volume":          "-v",
+	"PublishPort":     "-p",
+	"EnvironmentFile": "--env-file",
+	"Network":         "--network",
+	"Label":           "--label",
+	"User":            "--user",
+	"ContainerName":   "--name",
+	"HostName":        "--hostname",
+}
+
+/* otherKeys of [Container] are handled one by one */
+var otherKeys = map[string]bool{
+	"Image":             true,
+	"Environment":       true,
+	"Exec":              true,
+	"Notify":            true,
+	"DockerArgs":        true,
+	"SystemdDockerArgs": true,
+}
+
+/* quote quotes a word for ExecStart=, % is left alone so specifiers work */
+func quote(word string) string {
+	if len(word) > 0 && !strings.ContainsAny(word, " \t\"'\\;") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "yes", "true", "on":
+		return true
+	}
+	return false
+}
+
+/* containerArgs are the arguments of systemd-docker for the [Container]
+ * section */
+func containerArgs(unit unitFile) ([]string, error) {
+	container := unit.section("Container")
+	if container == nil {
+		return nil, errors.New("no [Container] section")
+	}
+
+	for _, e := range container.entries {
+		if _, ok := containerKeys[e.key]; !ok && !otherKeys[e.key] {
+			return nil, errors.New(fmt.Sprintf("unknown key %s in [Container]", e.key))
+		}
+	}
+
+	image := unit.value("Container", "Image")
+	if len(image) == 0 {
+		return nil, errors.New("Image= is missing")
+	}
+
+	args := []string{}
+	switch notify := unit.value("Container", "Notify"); {
+	case isTrue(notify):
+		args = append(args, "--notify")
+	case notify == "healthy" || notify == "off":
+		/* The --notify modes other than the container's own READY=1 */
+		args = append(args, "--notify="+notify)
+	}
+	for _, value := range unit.values("Container", "SystemdDockerArgs") {
+		words, err := splitWords(value)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, words...)
+	}
+	args = append(args, "run", "--rm")
+
+	for _, e := range container.entries {
+		flag, ok := containerKeys[e.key]
+		if ok {
+			args = append(args, flag, e.value)
+		}
+
+		switch e.key {
+		case "Environment":
+			/* Several assignments may share a line, as in Environment= of units */
+			assignments, err := splitWords(e.value)
+			if err != nil {
+				return nil, err
+			}
+			for _, assignment := range assignments {
+				args = append(args, "-e", assignment)
+			}
+		case "DockerArgs":
+			words, err := splitWords(e.value)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, words...)
+		}
+	}
+
+	args = append(args, image)
+	command, err := splitWords(unit.value("Container", "Exec"))
+	if err != nil {
+		return nil, err
+	}
+	return append(args, command...), nil
+}
+
+/* execStart is the systemd-docker command line for the [Container] section */
+func execStart(unit unitFile, binary string) (string, error) {
+	args, err := containerArgs(unit)
+	if err != nil {
+		return "", err
+	}
+
+	words := []string{quote(binary)}
+	for _, arg := range args {
+		words = append(words, quote(arg))
+	}
+	return strings.Join(words, " "), nil
+}
+
+/* generate turns one .container file into its service unit */
+func generate(source string, unit unitFile, binary string) (unitFile, error) {
+	command, err := execStart(unit, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unit.values("Service", "ExecStart")) > 0 {
+		return nil, errors.New("ExecStart= is generated from [Container], it can't be set in [Service]")
+	}
+
+	unitSection := &section{name: "Unit"}
+	if s := unit.section("Unit"); s != nil {
+		unitSection.entries = append(unitSection.entries, s.entries...)
+	}
+	unitSection.entries = append(unitSection.entries,
+		entry{"SourcePath", source},
+		entry{"After", "docker.service"},
+		entry{"Requires", "docker.service"})
+
+	serviceSection := &section{name: "Service"}
+	if len(unit.value("Service", "Type")) == 0 {
+		serviceSection.entries = append(serviceSection.entries, entry{"Type", "notify"})
+	}
+	if len(unit.value("Service", "NotifyAccess")) == 0 {
+		serviceSection.entries = append(serviceSection.entries, entry{"NotifyAccess", "all"})
+	}
+	if s := unit.section("Service"); s != nil {
+		serviceSection.entries = append(serviceSection.entries, s.entries...)
+	}
+	serviceSection.entries = append(serviceSection.entries, entry{"ExecStart", command})
+
+	/* Generated units can't be enabled, [Install] becomes symlinks instead */
+	return unitFile{unitSection, serviceSection}, nil
+}
+
+/* install links the service into the .wants and .requires directories of
+ * WantedBy= and RequiredBy=, as systemctl enable would */
+func install(outputDir, service string, unit unitFile) error {
+	for _, kind := range []string{"WantedBy", "RequiredBy"} {
+		suffix := ".wants"
+		if kind == "RequiredBy" {
+			suffix = ".requires"
+		}
+
+		for _, value := range unit.values("Install", kind) {
+			for _, target := range strings.Fields(value) {
+				dir := filepath.Join(outputDir, target+suffix)
+				err := os.MkdirAll(dir, 0755)
+				if err != nil {
+					return err
+				}
+
+				link := filepath.Join(dir, service)
+				os.Remove(link)
+				err = os.Symlink("../"+service, link)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/* Generate writes a service unit to outputDir for each .container file in
+ * sourceDir.  A broken file doesn't keep the others from being generated,
+ * its error is returned along with those of the others. */
+func Generate(sourceDir, outputDir, binary string) []error {
+	files, err := filepath.Glob(filepath.Join(sourceDir, "*.container"))
+	if err != nil {
+		return []error{err}
+	}
+	sort.Strings(files)
+
+	errs := []error{}
+	for _, file := range files {
+		service := strings.TrimSuffix(filepath.Base(file), ".container") + ".service"
+		err := generateFile(file, outputDir, service, binary)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("%s: %s", file, err)))
+		}
+	}
+	return errs
+}
+
+func generateFile(file, outputDir, service, binary string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	unit, err := parseUnit(f)
+	if err != nil {
+		return err
+	}
+
+	generated, err := generate(file, unit, binary)
+	if err != nil {
+		return err
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# Automatically generated by systemd-docker-generator from %s\n\n", file)
+	generated.write(out)
+
+	err = ioutil.WriteFile(filepath.Join(outputDir, service), out.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return install(outputDir, service, unit)
+}
+
+/* Container is a .container file as systemd-docker daemon runs it */
+type Container struct {
+	Name       string
+	Args       []string
+	Restart    string
+	RestartSec string
+}
+
+/* LoadContainers reads the .container files in dir, like Generate a broken
+ * file is skipped and its error returned */
+func LoadContainers(dir string) ([]*Container, []error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.container"))
+	if err != nil {
+		return nil, []error{err}
+	}
+	sort.Strings(files)
+
+	containers := []*Container{}
+	errs := []error{}
+	for _, file := range files {
+		container, err := loadContainer(file)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("%s: %s", file, err)))
+			continue
+		}
+		containers = append(containers, container)
+	}
+	return containers, errs
+}
+
+func loadContainer(file string) (*Container, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	unit, err := parseUnit(f)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := containerArgs(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Container{
+		Name:       strings.TrimSuffix(filepath.Base(file), ".container"),
+		Args:       args,
+		Restart:    unit.value("Service", "Restart"),
+		RestartSec: unit.value("Service", "RestartSec"),
+	}, nil
+}
+
+/* binary is systemd-docker next to the generator, so both installed in one
+ * place find each other, /opt/bin/systemd-docker otherwise */
+func binary() string {
+	exe, err := os.Executable()
+	if err == nil {
+		candidate := filepath.Join(filepath.Dir(exe), "systemd-docker")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return DEFAULT_BINARY
+}
+
+/* Main is the generator, systemd passes the normal, early and late output
+ * directories and units go to the normal one */
+func Main(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: systemd-docker-generator normal-dir [early-dir late-dir]")
+		return 1
+	}
+
+	sourceDir := os.Getenv("SYSTEMD_DOCKER_CONTAINER_DIR")
+	if len(sourceDir) == 0 {
+		sourceDir = CONTAINER_DIR
+	}
+
+	errs := Generate(sourceDir, args[0], binary())
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "systemd-docker-generator:", err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,173 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testContainer = `
+# A web server
+[Unit]
+Description=Nginx
+
+[Container]
+Image=nginx:stable
+ContainerName=web
+PublishPort=8080:80
+Volume=/srv/www:/usr/share/nginx/html:ro
+Environment=MODE=production "GREETING=hello world"
+Notify=yes
+SystemdDockerArgs=--pull-policy=missing
+DockerArgs=--read-only
+Exec=nginx -g \
+  "daemon off;"
+
+[Service]
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "generator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestParseUnit(t *testing.T) {
+	unit, err := parseUnit(strings.NewReader(testContainer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unit) != 4 || unit.value("Unit", "Description") != "Nginx" {
+		t.Fatal("Bad unit", unit)
+	}
+	if exec := unit.value("Container", "Exec"); exec != `nginx -g "daemon off;"` {
+		t.Fatal("Bad continued line", exec)
+	}
+
+	_, err = parseUnit(strings.NewReader("Image=nginx\n"))
+	if err == nil {
+		t.Fatal("Expected a key outside of a section to fail")
+	}
+}
+
+func TestExecStart(t *testing.T) {
+	unit, err := parseUnit(strings.NewReader(testContainer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command, err := execStart(unit, "/opt/bin/systemd-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `/opt/bin/systemd-docker --notify --pull-policy=missing run --rm --name web -p 8080:80 -v /srv/www:/usr/share/nginx/html:ro -e MODE=production -e "GREETING=hello world" --read-only nginx:stable nginx -g "daemon off;"`
+	if command != expected {
+		t.Fatal("Bad ExecStart", command)
+	}
+
+	unit, _ = parseUnit(strings.NewReader("[Container]\nImage=nginx\nPorts=80\n"))
+	_, err = execStart(unit, "systemd-docker")
+	if err == nil || !strings.Contains(err.Error(), "Ports") {
+		t.Fatal("Expected an unknown key to fail", err)
+	}
+
+	unit, _ = parseUnit(strings.NewReader("[Container]\nPublishPort=80\n"))
+	_, err = execStart(unit, "systemd-docker")
+	if err == nil {
+		t.Fatal("Expected a missing image to fail")
+	}
+
+	unit, _ = parseUnit(strings.NewReader("[Container]\nImage=nginx\nNotify=healthy\n"))
+	command, err = execStart(unit, "systemd-docker")
+	if err != nil || command != "systemd-docker --notify=healthy run --rm nginx" {
+		t.Fatal("Bad ExecStart for Notify=healthy", command, err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"8080:80":  "8080:80",
+		"%N":       "%N",
+		"":         `""`,
+		"a b":      `"a b"`,
+		`say "hi"`: `"say \"hi\""`,
+		`C:\data`:  `"C:\\data"`,
+	}
+
+	for word, expected := range tests {
+		if quoted := quote(word); quoted != expected {
+			t.Fatal("Expected", expected, "for", word, "got", quoted)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	source := tempDir(t)
+	output := tempDir(t)
+
+	ioutil.WriteFile(filepath.Join(source, "web.container"), []byte(testContainer), 0644)
+	ioutil.WriteFile(filepath.Join(source, "broken.container"), []byte("[Container]\n"), 0644)
+	ioutil.WriteFile(filepath.Join(source, "ignored.conf"), []byte("[Container]\nImage=nginx\n"), 0644)
+
+	errs := Generate(source, output, "/opt/bin/systemd-docker")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken.container") {
+		t.Fatal("Expected only broken.container to fail", errs)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(output, "web.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Description=Nginx", "Requires=docker.service", "Type=notify", "NotifyAccess=all", "Restart=always", "ExecStart=/opt/bin/systemd-docker --notify"} {
+		if !strings.Contains(string(data), "\n"+line) {
+			t.Fatal("Expected", line, "in", string(data))
+		}
+	}
+	if strings.Contains(string(data), "[Install]") {
+		t.Fatal("Expected no [Install] section", string(data))
+	}
+
+	target, err := os.Readlink(filepath.Join(output, "multi-user.target.wants", "web.service"))
+	if err != nil || target != "../web.service" {
+		t.Fatal("Expected web.service to be wanted by multi-user.target", target, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(output, "ignored.service")); err == nil {
+		t.Fatal("Expected only .container files to be read")
+	}
+}
+
+func TestGenerateExecStartConflict(t *testing.T) {
+	unit, _ := parseUnit(strings.NewReader("[Container]\nImage=nginx\n[Service]\nExecStart=/bin/true\n"))
+	_, err := generate("x.container", unit, "systemd-docker")
+	if err == nil {
+		t.Fatal("Expected ExecStart= in [Service] to fail")
+	}
+}
+
+func TestLoadContainers(t *testing.T) {
+	dir := tempDir(t)
+	ioutil.WriteFile(filepath.Join(dir, "web.container"), []byte(testContainer), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "broken.container"), []byte("[Container]\nExec=\"\n"), 0644)
+
+	containers, errs := LoadContainers(dir)
+	if len(errs) != 1 || len(containers) != 1 {
+		t.Fatal("Expected one container and one error", containers, errs)
+	}
+
+	web := containers[0]
+	if web.Name != "web" || web.Restart != "always" || web.Args[len(web.Args)-1] != "daemon off;" {
+		t.Fatal("Bad container", web)
+	}
+}
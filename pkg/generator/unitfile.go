@@ -0,0 +1,161 @@
+package generator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/* unitFile is a file in systemd's ini format.  Sections and keys keep their
+ * order and keys may repeat, as in unit files. */
+type unitFile []*section
+
+type section struct {
+	name    string
+	entries []entry
+}
+
+type entry struct {
+	key   string
+	value string
+}
+
+/* parseUnit reads a unit file, with comments and backslash continued lines */
+func parseUnit(r io.Reader) (unitFile, error) {
+	unit := unitFile{}
+	var current *section
+	continued := ""
+
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if len(continued) == 0 && (len(line) == 0 || line[0] == '#' || line[0] == ';') {
+			continue
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			continued += strings.TrimSpace(strings.TrimSuffix(line, "\\")) + " "
+			continue
+		}
+		line = continued + line
+		continued = ""
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.New(fmt.Sprintf("line %d: bad section header %s", number, line))
+			}
+			current = &section{name: line[1 : len(line)-1]}
+			unit = append(unit, current)
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New(fmt.Sprintf("line %d: expected key=value, got %s", number, line))
+		}
+		if current == nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s is outside of a section", number, line))
+		}
+		current.entries = append(current.entries, entry{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+
+	return unit, scanner.Err()
+}
+
+func (u unitFile) section(name string) *section {
+	for _, s := range u {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+/* values returns every value of key in the named section, in order */
+func (u unitFile) values(name, key string) []string {
+	values := []string{}
+	for _, s := range u {
+		if s.name != name {
+			continue
+		}
+		for _, e := range s.entries {
+			if e.key == key {
+				values = append(values, e.value)
+			}
+		}
+	}
+	return values
+}
+
+/* value returns the last value of key, which is the one systemd uses */
+func (u unitFile) value(name, key string) string {
+	values := u.values(name, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+func (u unitFile) write(w io.Writer) error {
+	for i, s := range u {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "[%s]\n", s.name)
+		for _, e := range s.entries {
+			_, err := fmt.Fprintf(w, "%s=%s\n", e.key, e.value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/* splitWords splits a value into words as systemd does for ExecStart=, with
+ * quotes and backslash escapes */
+func splitWords(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New(fmt.Sprintf("unterminated quote in %s", s))
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
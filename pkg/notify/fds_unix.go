@@ -0,0 +1,25 @@
+//go:build !windows
+
+package notify
+
+import "syscall"
+
+/* SendFds passes file descriptors along with message, for FDSTORE=1 */
+func SendFds(socket string, fds []int, message string) error {
+	/* Go refuses WriteMsgUnix on connected datagram sockets, so address the
+	 * message ourselves.  Not every Unix has SOCK_CLOEXEC, so hold off forks
+	 * until close-on-exec is set like the standard library does. */
+	syscall.ForkLock.RLock()
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fd)
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	defer syscall.Close(fd)
+
+	return syscall.Sendmsg(fd, []byte(message), syscall.UnixRights(fds...), &syscall.SockaddrUnix{Name: socket}, 0)
+}
@@ -0,0 +1,8 @@
+package notify
+
+import "errors"
+
+/* Windows has no systemd to hand file descriptors to */
+func SendFds(socket string, fds []int, message string) error {
+	return errors.New("passing file descriptors is not supported on Windows")
+}
@@ -0,0 +1,69 @@
+/* Package notify speaks the sd_notify protocol, the socket is $NOTIFY_SOCKET
+ * of the service. */
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+/* Send writes each message as its own datagram, a message may hold several
+ * newline separated assignments systemd then applies together */
+func Send(socket string, messages ...string) error {
+	if len(socket) == 0 {
+		return nil
+	}
+
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	for _, msg := range messages {
+		_, err = conn.Write([]byte(msg))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* Barrier returns once systemd has processed everything sent before it, it
+ * closes the pipe we hand it with BARRIER=1 */
+func Barrier(socket string, timeout time.Duration) error {
+	if len(socket) == 0 {
+		return nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	err = SendFds(socket, []int{int(w.Fd())}, "BARRIER=1")
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New(fmt.Sprintf("systemd did not process notifications within %s", timeout))
+	}
+}
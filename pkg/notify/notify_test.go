@@ -0,0 +1,80 @@
+//go:build !windows
+
+package notify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) (string, *net.UnixConn) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := dir + "/notify"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return socket, conn
+}
+
+func TestSend(t *testing.T) {
+	err := Send("", "READY=1")
+	if err != nil {
+		t.Fatal("Without a socket there is nothing to notify", err)
+	}
+
+	socket, conn := listen(t)
+	err = Send(socket, "MAINPID=1", "READY=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 256)
+	for _, expected := range []string{"MAINPID=1", "READY=1"} {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != expected {
+			t.Fatal("Expected", expected, "got", string(buf[:n]))
+		}
+	}
+}
+
+func TestNotifyBarrier(t *testing.T) {
+	socket, conn := listen(t)
+
+	go func() {
+		buf := make([]byte, 256)
+		oob := make([]byte, 256)
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil || string(buf[:n]) != "BARRIER=1" {
+			return
+		}
+
+		/* Like systemd, close the pipe once done */
+		msgs, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+		for _, msg := range msgs {
+			fds, _ := syscall.ParseUnixRights(&msg)
+			for _, fd := range fds {
+				syscall.Close(fd)
+			}
+		}
+	}()
+
+	err := Barrier(socket, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerEvents "github.com/docker/docker/api/types/events"
+	dockerFilters "github.com/docker/docker/api/types/filters"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* Docker is the runtime of a docker (or podman) daemon */
+type Docker struct {
+	Client dockerx.API
+}
+
+func NewDocker(client dockerx.API) *Docker {
+	return &Docker{Client: client}
+}
+
+func fromInspect(container dockerContainer.InspectResponse) *Container {
+	c := &Container{}
+	if container.ContainerJSONBase == nil {
+		return c
+	}
+
+	c.ID = container.ID
+	c.Name = container.Name
+	c.Image = container.Image
+	c.RestartCount = container.RestartCount
+	c.Tty = dockerx.HasTty(&container)
+	if container.HostConfig != nil {
+		c.RestartPolicy = RestartPolicy{string(container.HostConfig.RestartPolicy.Name), container.HostConfig.RestartPolicy.MaximumRetryCount}
+	}
+
+	if container.State != nil {
+		c.State = State{
+			Running:    container.State.Running,
+			Paused:     container.State.Paused,
+			Restarting: container.State.Restarting,
+			OOMKilled:  container.State.OOMKilled,
+			Pid:        container.State.Pid,
+			ExitCode:   container.State.ExitCode,
+			StartedAt:  dockerx.StartedAt(&container),
+			Health:     dockerx.HealthStatus(&container),
+		}
+	}
+
+	return c
+}
+
+func (d *Docker) Inspect(ctx context.Context, id string) (*Container, error) {
+	container, err := d.Client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return fromInspect(container), nil
+}
+
+func (d *Docker) Start(ctx context.Context, id string) error {
+	return d.Client.ContainerStart(ctx, id, dockerContainer.StartOptions{})
+}
+
+func (d *Docker) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	options := dockerContainer.StopOptions{}
+	if timeout >= 0 {
+		seconds := int(timeout.Seconds())
+		options.Timeout = &seconds
+	}
+	return d.Client.ContainerStop(ctx, id, options)
+}
+
+func (d *Docker) Kill(ctx context.Context, id string, signal string) error {
+	return d.Client.ContainerKill(ctx, id, signal)
+}
+
+func (d *Docker) Wait(ctx context.Context, id string) (int, error) {
+	results, errs := d.Client.ContainerWait(ctx, id, dockerContainer.WaitConditionNotRunning)
+	select {
+	case result := <-results:
+		return int(result.StatusCode), nil
+	case err := <-errs:
+		return -1, err
+	}
+}
+
+/* Without a TTY docker multiplexes stdout and stderr into one stream of
+ * frames, which CopyOutput splits up again */
+func (d *Docker) Logs(ctx context.Context, id string, since time.Time, stdout, stderr io.Writer) error {
+	container, err := d.Inspect(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	options := dockerContainer.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	}
+	if !since.IsZero() {
+		options.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+	}
+
+	logs, err := d.Client.ContainerLogs(ctx, id, options)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	return dockerx.CopyOutput(container.Tty, stdout, stderr, logs)
+}
+
+func (d *Docker) Remove(ctx context.Context, id string, volumes bool) error {
+	return d.Client.ContainerRemove(ctx, id, dockerContainer.RemoveOptions{Force: true, RemoveVolumes: volumes})
+}
+
+/* Older daemons only fill in the deprecated Status and ID */
+func eventContainerId(event dockerEvents.Message) string {
+	if len(event.Actor.ID) > 0 {
+		return event.Actor.ID
+	}
+	return event.ID
+}
+
+func eventAction(event dockerEvents.Message) string {
+	if len(event.Action) > 0 {
+		return string(event.Action)
+	}
+	return event.Status
+}
+
+func eventExitCode(event dockerEvents.Message) int {
+	code, err := strconv.Atoi(event.Actor.Attributes["exitCode"])
+	if err != nil {
+		return -1
+	}
+	return code
+}
+
+func (d *Docker) Events(ctx context.Context, id string) (<-chan Event, <-chan error) {
+	messages, errs := d.Client.Events(ctx, dockerEvents.ListOptions{
+		Filters: dockerFilters.NewArgs(
+			dockerFilters.Arg("type", string(dockerEvents.ContainerEventType)),
+			dockerFilters.Arg("container", id),
+		),
+	})
+
+	events := make(chan Event)
+	go func() {
+		for {
+			select {
+			case message := <-messages:
+				event := Event{eventContainerId(message), eventAction(message), eventExitCode(message)}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerEvents "github.com/docker/docker/api/types/events"
+)
+
+func TestEventFields(t *testing.T) {
+	old := dockerEvents.Message{Status: "start", ID: "abc"}
+	if eventContainerId(old) != "abc" || eventAction(old) != "start" {
+		t.Fatal("Failed to read old style event", old)
+	}
+
+	event := dockerEvents.Message{
+		Action: "die",
+		Status: "die",
+		Actor:  dockerEvents.Actor{ID: "def", Attributes: map[string]string{"exitCode": "3"}},
+	}
+	if eventContainerId(event) != "def" || eventAction(event) != "die" || eventExitCode(event) != 3 {
+		t.Fatal("Failed to read new style event", event)
+	}
+
+	if eventExitCode(old) != -1 {
+		t.Fatal("Only a die has an exit code")
+	}
+}
+
+func TestFromInspect(t *testing.T) {
+	container := fromInspect(dockerContainer.InspectResponse{
+		ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+			ID:    "abc",
+			Image: "sha256:abc",
+			State: &dockerContainer.State{Running: true, Pid: 42, Health: &dockerContainer.Health{Status: "healthy"}},
+			HostConfig: &dockerContainer.HostConfig{
+				RestartPolicy: dockerContainer.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+			},
+		},
+		Config: &dockerContainer.Config{Tty: true},
+	})
+
+	if container.ID != "abc" || !container.State.Running || container.State.Pid != 42 || container.State.Health != "healthy" {
+		t.Fatal("Bad state", container)
+	}
+	if container.RestartPolicy.Name != "on-failure" || container.RestartPolicy.MaxRetries != 3 || !container.Tty || container.Image != "sha256:abc" {
+		t.Fatal("Bad config", container)
+	}
+
+	if fromInspect(dockerContainer.InspectResponse{}).State.Running {
+		t.Fatal("An empty response is no running container")
+	}
+}
@@ -0,0 +1,326 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Mock is an in-memory runtime.  Tests add containers, make them exit and
+ * check which calls the supervisor made. */
+type Mock struct {
+	/* The exit code of containers stopped through the runtime */
+	StopExitCode int
+	/* Stop returns without stopping, like a daemon that lost the container,
+	 * only Kill ends them */
+	IgnoreStop bool
+	/* Create hangs until its context ends, like a daemon stuck creating */
+	BlockCreate bool
+	/* Started containers get a sleep process of ours as their pid, for
+	 * tests of a supervisor that watches /proc */
+	Processes bool
+	/* What Logs writes to stdout, per container */
+	Output map[string]string
+	Calls  []string
+
+	lock        sync.Mutex
+	containers  map[string]*Container
+	subscribers map[chan Event]string
+	changed     chan struct{}
+	pid         int
+	created     int
+	image       string
+	processes   map[string]*exec.Cmd
+}
+
+func NewMock() *Mock {
+	return &Mock{
+		Output:      map[string]string{},
+		containers:  map[string]*Container{},
+		subscribers: map[chan Event]string{},
+		changed:     make(chan struct{}),
+		pid:         1000,
+		processes:   map[string]*exec.Cmd{},
+	}
+}
+
+/* find looks a container up by id or name, like the daemon does.  It must
+ * be called with the lock held */
+func (m *Mock) find(id string) (*Container, bool) {
+	if container, ok := m.containers[id]; ok {
+		return container, true
+	}
+	for _, container := range m.containers {
+		if len(container.Name) > 0 && container.Name == id {
+			return container, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Mock) call(name, id string) {
+	m.Calls = append(m.Calls, name+" "+id)
+}
+
+/* emit must be called with the lock held */
+func (m *Mock) emit(id, action string, exitCode int) {
+	for events, subscribed := range m.subscribers {
+		if subscribed == id {
+			events <- Event{id, action, exitCode}
+		}
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+/* Add puts a container into the runtime, a running one gets a pid */
+func (m *Mock) Add(container *Container) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if container.State.Running && container.State.Pid == 0 {
+		m.pid++
+		container.State.Pid = m.pid
+	}
+	m.containers[container.ID] = container
+}
+
+/* Exit ends a container's process with code, like it exited by itself */
+func (m *Mock) Exit(id string, code int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.exit(id, code)
+}
+
+/* OOMKill ends a container's process like the kernel's OOM killer */
+func (m *Mock) OOMKill(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if container, ok := m.containers[id]; ok && container.State.Running {
+		container.State.OOMKilled = true
+		m.exit(id, 137)
+	}
+}
+
+func (m *Mock) exit(id string, code int) {
+	container, ok := m.containers[id]
+	if !ok || !container.State.Running {
+		return
+	}
+
+	if cmd, ok := m.processes[id]; ok {
+		cmd.Process.Kill()
+		cmd.Wait()
+		delete(m.processes, id)
+	}
+
+	container.State.Running = false
+	container.State.Pid = 0
+	container.State.ExitCode = code
+	m.emit(id, "die", code)
+}
+
+/* SetImage makes containers created from now on run image, like the tag
+ * moved on to it */
+func (m *Mock) SetImage(image string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.image = image
+}
+
+/* Image is the image containers are created from now */
+func (m *Mock) Image() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.image
+}
+
+/* SetHealth changes the health of a container with a healthcheck */
+func (m *Mock) SetHealth(id, health string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if container, ok := m.containers[id]; ok {
+		container.State.Health = health
+		m.emit(id, "health_status: "+health, -1)
+	}
+}
+
+/* Create adds a container that isn't running yet, created-1, created-2 and
+ * so on, under the --name of args */
+func (m *Mock) Create(ctx context.Context, args []string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.created++
+	id := fmt.Sprintf("created-%d", m.created)
+	if m.BlockCreate {
+		m.lock.Unlock()
+		<-ctx.Done()
+		m.lock.Lock()
+		m.call("create", id)
+		return "", ctx.Err()
+	}
+
+	m.call("create", id)
+	m.containers[id] = &Container{ID: id, Name: createName(args), Image: m.image}
+	m.emit(id, "create", -1)
+	return id, nil
+}
+
+func createName(args []string) string {
+	for i, arg := range args {
+		if arg == "--name" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--name=") {
+			return strings.TrimPrefix(arg, "--name=")
+		}
+	}
+	return ""
+}
+
+func (m *Mock) Inspect(ctx context.Context, id string) (*Container, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	container, ok := m.find(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copy := *container
+	return &copy, nil
+}
+
+func (m *Mock) Start(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.call("start", id)
+
+	container, ok := m.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if container.State.Running {
+		return nil
+	}
+
+	m.pid++
+	pid := m.pid
+	if m.Processes {
+		cmd := exec.Command("sleep", "3600")
+		err := cmd.Start()
+		if err != nil {
+			return err
+		}
+		m.processes[container.ID] = cmd
+		pid = cmd.Process.Pid
+	}
+
+	container.State = State{Running: true, Pid: pid, StartedAt: time.Now()}
+	m.emit(container.ID, "start", -1)
+	return nil
+}
+
+func (m *Mock) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.call("stop", id)
+
+	if _, ok := m.containers[id]; !ok {
+		return ErrNotFound
+	}
+	if m.IgnoreStop {
+		return nil
+	}
+	/* dockerd's order: kill, die, stop */
+	m.emit(id, "kill", -1)
+	m.exit(id, m.StopExitCode)
+	m.emit(id, "stop", -1)
+	return nil
+}
+
+func (m *Mock) Kill(ctx context.Context, id string, signal string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.call("kill", id)
+
+	if _, ok := m.containers[id]; !ok {
+		return ErrNotFound
+	}
+	m.emit(id, "kill", -1)
+	m.exit(id, 137)
+	return nil
+}
+
+func (m *Mock) Wait(ctx context.Context, id string) (int, error) {
+	for {
+		m.lock.Lock()
+		container, ok := m.containers[id]
+		changed := m.changed
+		m.lock.Unlock()
+
+		if !ok {
+			return -1, ErrNotFound
+		}
+		if !container.State.Running {
+			return container.State.ExitCode, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+}
+
+func (m *Mock) Logs(ctx context.Context, id string, since time.Time, stdout, stderr io.Writer) error {
+	m.lock.Lock()
+	output := m.Output[id]
+	m.lock.Unlock()
+
+	_, err := io.WriteString(stdout, output)
+	return err
+}
+
+func (m *Mock) Remove(ctx context.Context, id string, volumes bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.call("remove", id)
+
+	container, ok := m.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+	m.exit(container.ID, 137)
+	delete(m.containers, container.ID)
+	m.emit(container.ID, "destroy", -1)
+	return nil
+}
+
+/* Events are buffered, a test emitting faster than the supervisor reads
+ * doesn't block */
+func (m *Mock) Events(ctx context.Context, id string) (<-chan Event, <-chan error) {
+	events := make(chan Event, 100)
+	errs := make(chan error, 1)
+
+	m.lock.Lock()
+	m.subscribers[events] = id
+	m.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.lock.Lock()
+		delete(m.subscribers, events)
+		m.lock.Unlock()
+		errs <- ctx.Err()
+	}()
+
+	return events, errs
+}
@@ -0,0 +1,85 @@
+/* Package runtime is the container engine the supervisor drives once a
+ * container exists.  Docker is one implementation, Mock is another for
+ * deterministic tests of the lifecycle. */
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+var ErrNotFound = errors.New("No such container")
+
+/* State is what a runtime reports about a container's process */
+type State struct {
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Pid        int
+	ExitCode   int
+	StartedAt  time.Time
+	/* starting, healthy or unhealthy, empty without a healthcheck */
+	Health string
+}
+
+type RestartPolicy struct {
+	Name       string
+	MaxRetries int
+}
+
+type Container struct {
+	ID            string
+	Name          string
+	Image         string
+	Tty           bool
+	RestartPolicy RestartPolicy
+	RestartCount  int
+	State         State
+}
+
+/* Event is a change of a container, Action is the runtime's name for it like
+ * start, die or "health_status: healthy" */
+type Event struct {
+	ContainerID string
+	Action      string
+	/* The exit code of a die, -1 otherwise */
+	ExitCode int
+}
+
+type ContainerRuntime interface {
+	Inspect(ctx context.Context, id string) (*Container, error)
+	Start(ctx context.Context, id string) error
+	/* Stop asks the container to exit and kills it after timeout, a negative
+	 * timeout leaves it to the runtime's default */
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+	/* Kill sends signal to the container's main process right away */
+	Kill(ctx context.Context, id string, signal string) error
+	/* Wait returns the exit code once the container is no longer running */
+	Wait(ctx context.Context, id string) (int, error)
+	/* Logs follows the container's output from since until ctx is done or
+	 * the container exits */
+	Logs(ctx context.Context, id string, since time.Time, stdout, stderr io.Writer) error
+	/* Remove takes the container's anonymous volumes with it if volumes */
+	Remove(ctx context.Context, id string, volumes bool) error
+	/* Events follows the events of one container, the error channel gets a
+	 * value when the stream ends */
+	Events(ctx context.Context, id string) (<-chan Event, <-chan error)
+}
+
+/* Creator is a runtime that creates containers itself from the arguments of
+ * docker run, without the run.  The supervisor runs docker create for
+ * runtimes that aren't. */
+type Creator interface {
+	/* Create returns the id as soon as the container exists, even with an
+	 * error */
+	Create(ctx context.Context, args []string) (string, error)
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || dockerx.IsNotFound(err)
+}
@@ -0,0 +1,142 @@
+package supervisor
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* Every docker call gets --api-timeout, so a hung daemon can't keep the unit
+ * activating forever, and is cancelled with c.Ctx on SIGTERM while starting */
+
+func rootContext(c *Context) context.Context {
+	if c.Ctx == nil {
+		return context.Background()
+	}
+	return c.Ctx
+}
+
+func withApiTimeout(c *Context, ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.ApiTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.ApiTimeout)
+}
+
+func apiContext(c *Context) (context.Context, context.CancelFunc) {
+	return withApiTimeout(c, rootContext(c))
+}
+
+/* cleanupContext is for removing and stopping containers, which has to
+ * happen even once c.Ctx is cancelled.  grace is how long the daemon itself
+ * may take on top of --api-timeout. */
+func cleanupContext(c *Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	if c.ApiTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.ApiTimeout+grace)
+}
+
+func cancelled(c *Context) bool {
+	return rootContext(c).Err() != nil
+}
+
+/* sleepContext waits for d, or less if we are asked to stop meanwhile */
+func sleepContext(c *Context, d time.Duration) error {
+	select {
+	case <-rootContext(c).Done():
+		return rootContext(c).Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func inspectContainer(c *Context, client dockerx.API, id string) (*dockerContainer.InspectResponse, error) {
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	container, err := client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	/* Spares every caller the nil checks */
+	if container.ContainerJSONBase == nil {
+		container.ContainerJSONBase = &dockerContainer.ContainerJSONBase{}
+	}
+	if container.State == nil {
+		container.State = &dockerContainer.State{}
+	}
+
+	return &container, nil
+}
+
+/* What SIGTERM and SIGINT do as supervise goes on */
+const (
+	SIGNALS_CANCEL = iota
+	SIGNALS_STOP
+	SIGNALS_CLEANUP
+)
+
+/* stopSignals takes SIGTERM and SIGINT for all of supervise.  It stays
+ * registered throughout, a gap would leave them to Go, which exits on the
+ * spot without any cleanup.  While starting a signal cancels c.Ctx, once the
+ * container runs it is stopped, and while cleaning up we are on our way out
+ * already. */
+type stopSignals struct {
+	phase   int32
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+func handleStopSignals(c *Context, cancel func()) *stopSignals {
+	s := &stopSignals{signals: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(s.signals, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		defer close(s.done)
+
+		stopped := false
+		for sig := range s.signals {
+			switch atomic.LoadInt32(&s.phase) {
+			case SIGNALS_CANCEL:
+				logInfo("Got", sig, "while starting, giving up")
+				cancel()
+			case SIGNALS_STOP:
+				if !stopped {
+					stopped = true
+					stopOnSignal(c, sig)
+				}
+			default:
+				logInfo("Got", sig, "while cleaning up, finishing that first")
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *stopSignals) setPhase(phase int32) {
+	atomic.StoreInt32(&s.phase, phase)
+}
+
+/* stop unregisters the signals and waits for a stop in progress */
+func (s *stopSignals) stop() {
+	signal.Stop(s.signals)
+	close(s.signals)
+	<-s.done
+}
+
+func inspectRuntime(c *Context, rt runtime.ContainerRuntime, id string) (*runtime.Container, error) {
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	return rt.Inspect(ctx, id)
+}
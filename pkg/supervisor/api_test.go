@@ -0,0 +1,138 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	dockerClient "github.com/docker/docker/client"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+func hangingClient(t *testing.T) *dockerClient.Client {
+	done := make(chan struct{})
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	})
+	/* Cleanups run last first, the requests end before the daemon closes */
+	t.Cleanup(func() { close(done) })
+	return daemon.Client
+}
+
+func TestApiTimeout(t *testing.T) {
+	client := hangingClient(t)
+	c := &Context{Id: "abc", Client: client, ApiTimeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	_, err := inspectContainer(c, client, c.Id)
+	if err == nil {
+		t.Fatal("Expected the inspect to time out")
+	}
+
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("Inspect took", time.Since(start))
+	}
+}
+
+func TestReinspectCancelled(t *testing.T) {
+	client := hangingClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Context{Id: "abc", Client: client, Ctx: ctx}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	/* Without the cancellation this would wait for the daemon for good */
+	_, err := reinspect(c, runtime.NewDocker(client))
+	if err == nil {
+		t.Fatal("Expected reinspect to be cancelled")
+	}
+}
+
+func TestWaitProbeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Context{Ctx: ctx, Pid: os.Getpid()}
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	err := waitProbe(c, "test", time.Hour, func() error { return errors.New("not yet") })
+	if err != context.Canceled {
+		t.Fatal("Expected the probe to be cancelled, got", err)
+	}
+}
+
+func TestAbortStart(t *testing.T) {
+	c, m := mockContext("")
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Ctx = ctx
+	c.Rm = true
+	c.StopTimeout = -1
+
+	abortStart(c)
+	if len(m.Calls) > 0 {
+		t.Fatal("Stopped a container without being cancelled", m.Calls)
+	}
+
+	cancel()
+	abortStart(c)
+	if strings.Join(m.Calls, ",") != "stop abc,remove abc" {
+		t.Fatal("Expected stop and remove, got", m.Calls)
+	}
+}
+
+func TestCleanupHalfStartedInvocation(t *testing.T) {
+	_, m := mockContext("")
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Id": "abc"}]`))
+	})
+	t.Setenv("INVOCATION_ID", "0123")
+
+	cleanupHalfStarted(&Context{Client: daemon.Client, Runtime: m})
+	if strings.Join(daemon.requests(), ",") != "GET /v1.41/containers/json" || strings.Join(m.Calls, ",") != "remove abc" {
+		t.Fatal("Expected the container of the invocation to be removed, got", daemon.requests(), m.Calls)
+	}
+}
+
+/* The volumes only show in the request to the daemon */
+func TestRmContainerVolumes(t *testing.T) {
+	daemon := newFakeDaemon(t, nil)
+
+	c := &Context{Id: "abc", Client: daemon.Client, Rm: true}
+	err := rmContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.RmVolumes = true
+	err = rmContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []string{}
+	for _, call := range daemon.calls() {
+		queries = append(queries, call.Method+" "+call.Path+"?"+call.Query.Get("v"))
+	}
+	if strings.Join(queries, ",") != "DELETE /v1.41/containers/abc?,DELETE /v1.41/containers/abc?1" {
+		t.Fatal("Expected the volumes to be removed only with --rm-volumes", queries)
+	}
+
+	_, err = Parse([]string{"--rm-volumes", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected --rm-volumes to need --rm")
+	}
+	c, err = Parse([]string{"--rm-volumes", "run", "--rm", "busybox"})
+	if err != nil || !c.RmVolumes {
+		t.Fatal("Expected --rm-volumes with --rm", err)
+	}
+}
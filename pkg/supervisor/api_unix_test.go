@@ -0,0 +1,49 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+/* Every phase keeps SIGTERM from Go's default, which would kill the test */
+func TestStopSignalsPhases(t *testing.T) {
+	c, m := mockContext("")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := handleStopSignals(c, cancel)
+	defer signals.stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM while starting didn't cancel the start")
+	}
+
+	signals.setPhase(SIGNALS_STOP)
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	stopped := false
+	for i := 0; i < 500 && !stopped; i++ {
+		time.Sleep(10 * time.Millisecond)
+		container, err := m.Inspect(context.Background(), "abc")
+		stopped = err == nil && !container.State.Running
+	}
+	if !stopped {
+		t.Fatal("SIGTERM while running didn't stop the container")
+	}
+
+	/* A restarted container is left alone while we clean up */
+	m.Start(context.Background(), "abc")
+	signals.setPhase(SIGNALS_CLEANUP)
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	time.Sleep(100 * time.Millisecond)
+
+	container, err := m.Inspect(context.Background(), "abc")
+	if err != nil || !container.State.Running {
+		t.Fatal("SIGTERM while cleaning up stopped the container again")
+	}
+}
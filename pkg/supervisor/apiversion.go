@@ -0,0 +1,57 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types/versions"
+)
+
+/* DistributionInspect, which check uses to see if an image is pullable */
+const API_DISTRIBUTION = "1.30"
+
+/* The oldest Docker API versions our features work with */
+var apiFeatures = []struct {
+	name string
+	min  string
+	used func(c *Context) bool
+}{
+	{"following container events", "1.22", func(c *Context) bool { return true }},
+	{"--watchdog-trigger", "1.24", func(c *Context) bool { return c.WatchdogTrigger }},
+	{"--checkpoint", "1.25", func(c *Context) bool { return c.Checkpoint }},
+	{"--metrics-textfile", "1.41", func(c *Context) bool { return len(c.MetricsFile) > 0 }},
+	{"--auto-update=registry", API_DISTRIBUTION, func(c *Context) bool { return c.AutoUpdate == AUTO_UPDATE_REGISTRY }},
+}
+
+/* apiVersion is the API version we talk to the daemon with, DOCKER_API_VERSION
+ * if set, otherwise the highest both sides support */
+func apiVersion(c *Context) (string, error) {
+	client, err := getClient(c)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	client.NegotiateAPIVersion(ctx)
+	return client.ClientVersion(), nil
+}
+
+/* checkAPIVersion fails early if the daemon is too old for a feature we are
+ * asked to use, instead of with an obscure error once the container runs */
+func checkAPIVersion(c *Context) error {
+	version, err := apiVersion(c)
+	if err != nil {
+		return err
+	}
+	logDebug("Using Docker API", version)
+
+	for _, feature := range apiFeatures {
+		if feature.used(c) && versions.LessThan(version, feature.min) {
+			return errors.New(fmt.Sprintf("%s needs Docker API %s or newer, the daemon speaks %s", feature.name, feature.min, version))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package supervisor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* apiServer is a daemon that only answers pings, for API version 1.23 */
+func apiServer(t *testing.T) *Context {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.23")
+		w.Write([]byte("OK"))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := dockerx.NewClient("tcp://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Context{Client: client}
+}
+
+func TestCheckAPIVersion(t *testing.T) {
+	c := apiServer(t)
+	err := checkAPIVersion(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.WatchdogTrigger = true
+	err = checkAPIVersion(c)
+	if err == nil || !strings.Contains(err.Error(), "--watchdog-trigger needs Docker API 1.24") {
+		t.Fatal("Expected the daemon to be too old", err)
+	}
+}
+
+func TestDockerAPIVersionEnv(t *testing.T) {
+	os.Setenv("DOCKER_API_VERSION", "1.40")
+	defer os.Unsetenv("DOCKER_API_VERSION")
+
+	c := apiServer(t)
+	version, err := apiVersion(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.40" {
+		t.Fatal("Expected DOCKER_API_VERSION to skip negotiation, got", version)
+	}
+}
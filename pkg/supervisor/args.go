@@ -0,0 +1,356 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+/* Boolean docker run flags, anything else is assumed to take a value when it
+ * isn't given in --flag=value form */
+var dockerBoolFlags = map[string]bool{
+	"detach":                true,
+	"rm":                    true,
+	"interactive":           true,
+	"tty":                   true,
+	"publish-all":           true,
+	"privileged":            true,
+	"init":                  true,
+	"read-only":             true,
+	"sig-proxy":             true,
+	"no-healthcheck":        true,
+	"oom-kill-disable":      true,
+	"disable-content-trust": true,
+	"quiet":                 true,
+	"help":                  true,
+	"use-api-socket":        true,
+}
+
+/* The long names of docker run's short flags */
+var dockerShortFlags = map[byte]string{
+	'a': "attach",
+	'c': "cpu-shares",
+	'd': "detach",
+	'e': "env",
+	'h': "hostname",
+	'i': "interactive",
+	'l': "label",
+	'm': "memory",
+	'P': "publish-all",
+	'p': "publish",
+	'q': "quiet",
+	't': "tty",
+	'u': "user",
+	'v': "volume",
+	'w': "workdir",
+}
+
+/* Old docker versions took long flags with a single dash */
+var dockerLegacyFlags = map[string]bool{
+	"rm":     true,
+	"detach": true,
+	"name":   true,
+}
+
+/* runFlag is one flag of docker run, short flags are translated to their
+ * long name.  Combined short flags (-dit) give one runFlag each, all in the
+ * same argument. */
+type runFlag struct {
+	Name  string
+	Value string
+	Arg   int
+	Args  int
+}
+
+func longRunFlag(args []string, i int, arg string) runFlag {
+	parts := strings.SplitN(arg, "=", 2)
+	f := runFlag{Name: parts[0], Arg: i, Args: 1}
+
+	switch {
+	case len(parts) == 2:
+		f.Value = parts[1]
+	case dockerBoolFlags[f.Name]:
+		f.Value = "true"
+	case i+1 < len(args) && !looksLikeFlag(args[i+1]):
+		f.Value = args[i+1]
+		f.Args = 2
+	}
+
+	return f
+}
+
+/* A value flag directly followed by another flag most likely is a bool flag
+ * we don't know about.  Negative numbers (--memory-swap -1) are values. */
+func looksLikeFlag(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && (arg[1] < '0' || arg[1] > '9')
+}
+
+/* parseRunArgs splits docker run args into its flags and returns them with
+ * the position of the image, everything after it is the container's command */
+func parseRunArgs(args []string) ([]runFlag, int) {
+	flags := []runFlag{}
+
+	i := 0
+	for i < len(args) {
+		arg := args[i]
+		if arg == "--" {
+			return flags, i + 1
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			f := longRunFlag(args, i, arg[2:])
+			flags = append(flags, f)
+			i += f.Args
+			continue
+		}
+
+		if name := strings.SplitN(arg[1:], "=", 2)[0]; len(name) > 1 && dockerLegacyFlags[name] {
+			f := longRunFlag(args, i, arg[1:])
+			flags = append(flags, f)
+			i += f.Args
+			continue
+		}
+
+		consumed := 1
+		for j := 1; j < len(arg); j++ {
+			name, ok := dockerShortFlags[arg[j]]
+			if !ok {
+				name = arg[j : j+1]
+			}
+
+			if dockerBoolFlags[name] {
+				flags = append(flags, runFlag{Name: name, Value: "true", Arg: i, Args: 1})
+				continue
+			}
+
+			/* The rest of the argument or the next one is the value */
+			f := runFlag{Name: name, Value: strings.TrimPrefix(arg[j+1:], "="), Arg: i, Args: 1}
+			if j+1 == len(arg) && i+1 < len(args) && !looksLikeFlag(args[i+1]) {
+				f.Value = args[i+1]
+				f.Args = 2
+				consumed = 2
+			}
+			flags = append(flags, f)
+			break
+		}
+
+		i += consumed
+	}
+
+	return flags, i
+}
+
+/* findRunFlag returns the first flag called name */
+func findRunFlag(args []string, name string) (runFlag, bool) {
+	flags, _ := parseRunArgs(args)
+	for _, f := range flags {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return runFlag{}, false
+}
+
+/* removeRunFlags drops the flags matching remove from args.  A flag in a
+ * group of short flags is cut out of the group. */
+func removeRunFlags(args []string, remove func(f runFlag) bool) []string {
+	flags, _ := parseRunArgs(args)
+
+	dropped := map[int]bool{}
+	groups := map[int]string{}
+	for _, f := range flags {
+		if !remove(f) {
+			continue
+		}
+
+		arg := args[f.Arg]
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 && !dockerLegacyFlags[strings.SplitN(arg[1:], "=", 2)[0]] {
+			/* Only bool flags are removed from groups, value flags end them */
+			group, ok := groups[f.Arg]
+			if !ok {
+				group = arg
+			}
+			for short, long := range dockerShortFlags {
+				if long == f.Name {
+					group = strings.Replace(group, string(short), "", 1)
+				}
+			}
+			groups[f.Arg] = group
+			continue
+		}
+
+		for j := 0; j < f.Args; j++ {
+			dropped[f.Arg+j] = true
+		}
+	}
+
+	newArgs := make([]string, 0, len(args))
+	for i, arg := range args {
+		if dropped[i] {
+			continue
+		}
+		if group, ok := groups[i]; ok {
+			if group == "-" {
+				continue
+			}
+			arg = group
+		}
+		newArgs = append(newArgs, arg)
+	}
+
+	return newArgs
+}
+
+func hasStrictArgs(ownArgs []string) bool {
+	for _, arg := range ownArgs {
+		if arg == "--strict-args" || arg == "--strict-args=true" {
+			return true
+		}
+	}
+	return false
+}
+
+func argError(pos int, arg string, msg string) error {
+	return errors.New(fmt.Sprintf("argument %d (%s): %s", pos, arg, msg))
+}
+
+/* Positions are 1-based and count from the first argument after the program
+ * name, so they match what is written in ExecStart= */
+func validateArgs(flags *flag.FlagSet, ownArgs, runArgs []string) error {
+	for i := 0; i < len(ownArgs); i++ {
+		arg := ownArgs[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return argError(i+1, arg, "unexpected argument before run")
+		}
+
+		var err error
+		if strings.HasPrefix(arg, "--") {
+			i, err = validateLongFlag(flags, ownArgs, i)
+		} else {
+			i, err = validateShortFlags(flags, ownArgs, i)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Positions come from the same parse that finds the image, so a flag
+	 * value or the container's command is never taken for a flag */
+	offset := len(ownArgs) + 2
+	runFlags, _ := parseRunArgs(runArgs)
+	for _, f := range runFlags {
+		arg := runArgs[f.Arg]
+		if strings.HasPrefix(arg, "--") && isOwnOnlyFlag(flags, f.Name) {
+			return argError(offset+f.Arg, arg, "systemd-docker flag must come before run")
+		}
+	}
+
+	return nil
+}
+
+/* validateLongFlag checks --flag and --flag=value at args[i] and returns the
+ * position of its last argument */
+func validateLongFlag(flags *flag.FlagSet, args []string, i int) (int, error) {
+	parts := strings.SplitN(args[i][2:], "=", 2)
+	f := flags.Lookup(parts[0])
+	if f == nil {
+		return i, argError(i+1, args[i], "unknown systemd-docker flag")
+	}
+
+	/* Bool flags and --notify take their value only after = */
+	if len(parts) == 1 && len(f.NoOptDefVal) == 0 {
+		return i + 1, nil
+	}
+	return i, nil
+}
+
+/* validateShortFlags checks a group of short flags like pflag reads them,
+ * -ln, -p/run/x.pid, -p=/run/x.pid or -p /run/x.pid.  The first flag that
+ * takes a value takes the rest of the argument, or the next one. */
+func validateShortFlags(flags *flag.FlagSet, args []string, i int) (int, error) {
+	arg := args[i]
+	for j := 1; j < len(arg); j++ {
+		f := flags.ShorthandLookup(arg[j : j+1])
+		if f == nil {
+			return i, argError(i+1, arg, fmt.Sprintf("unknown systemd-docker flag -%c", arg[j]))
+		}
+
+		if len(f.NoOptDefVal) > 0 {
+			if j+1 < len(arg) && arg[j+1] == '=' {
+				return i, nil
+			}
+			continue
+		}
+
+		if j+1 == len(arg) {
+			return i + 1, nil
+		}
+		return i, nil
+	}
+	return i, nil
+}
+
+/* redactedArgs is docker run args fit for the log: --env values are hidden
+ * and the container's command is only counted */
+func redactedArgs(args []string) []string {
+	flags, image := parseRunArgs(args)
+
+	redacted := append([]string{}, args[:image]...)
+	for _, f := range flags {
+		parts := strings.SplitN(f.Value, "=", 2)
+		if f.Name != "env" || len(parts) != 2 {
+			continue
+		}
+
+		hidden := parts[0] + "=***"
+		if f.Args == 2 {
+			redacted[f.Arg+1] = hidden
+		} else {
+			redacted[f.Arg] = strings.TrimSuffix(redacted[f.Arg], f.Value) + hidden
+		}
+	}
+
+	if image < len(args) {
+		redacted = append(redacted, args[image])
+		if command := len(args) - image - 1; command > 0 {
+			redacted = append(redacted, fmt.Sprintf("<%d command args>", command))
+		}
+	}
+	return redacted
+}
+
+/* imageIndex returns the position of the image in docker run args, everything
+ * after it belongs to the container's command */
+func imageIndex(args []string) int {
+	_, image := parseRunArgs(args)
+	return image
+}
+
+/* Our flags that docker run doesn't also have */
+func isOwnOnlyFlag(flags *flag.FlagSet, name string) bool {
+	switch name {
+	case "attach", "env", "name", "stop-signal", "stop-timeout":
+		return false
+	}
+	return flags.Lookup(name) != nil
+}
+
+/* stripRestartPolicy removes --restart from docker run args, returning the
+ * policy that was asked for */
+func stripRestartPolicy(args []string) ([]string, string) {
+	policy := ""
+	args = removeRunFlags(args, func(f runFlag) bool {
+		if f.Name == "restart" {
+			policy = f.Value
+			return true
+		}
+		return false
+	})
+	return args, policy
+}
@@ -0,0 +1,112 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	args := []string{"-dit", "-p8080:80", "-e", "A=b", "--named-volume", "x", "--memory-swap", "-1", "--rm",
+		"-v", "/data:/data", "--label=a=b", "busybox", "sh", "-c", "--rm"}
+
+	flags, image := parseRunArgs(args)
+	if image != 12 || args[image] != "busybox" {
+		t.Fatal("Bad image index", image)
+	}
+
+	got := []string{}
+	for _, f := range flags {
+		got = append(got, f.Name+"="+f.Value)
+	}
+
+	expected := "detach=true interactive=true tty=true publish=8080:80 env=A=b named-volume=x " +
+		"memory-swap=-1 rm=true volume=/data:/data label=a=b"
+	if strings.Join(got, " ") != expected {
+		t.Fatal("Bad flags", got)
+	}
+}
+
+func TestParseRunArgsLegacy(t *testing.T) {
+	flags, image := parseRunArgs([]string{"-rm", "-name", "test", "busybox"})
+	if image != 3 || len(flags) != 2 || flags[0].Name != "rm" || flags[1].Name != "name" || flags[1].Value != "test" {
+		t.Fatal("Bad legacy flags", flags, image)
+	}
+}
+
+func TestRemoveRunFlags(t *testing.T) {
+	args := removeRunFlags([]string{"-dit", "-d", "--name", "test", "-dp", "80:80", "busybox", "-d"}, func(f runFlag) bool {
+		return f.Name == "detach"
+	})
+
+	if strings.Join(args, " ") != "-it --name test -p 80:80 busybox -d" {
+		t.Fatal("Bad args", args)
+	}
+}
+
+/* docker run flags we also have are allowed after run with --strict-args */
+func TestStrictArgsSharedFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--attach", "stdout"},
+		{"--env", "A=1"},
+		{"--name", "web"},
+		{"--stop-signal", "SIGINT"},
+		{"--stop-timeout", "5"},
+	} {
+		_, err := Parse(append(append([]string{"--strict-args", "run"}, args...), "busybox"))
+		if err != nil {
+			t.Fatal("docker run's", args[0], "should be allowed after run:", err)
+		}
+	}
+}
+
+func TestStrictArgsForms(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-p/run/x.pid", "run", "busybox"}, ""},
+		{[]string{"-p=/run/x.pid", "run", "busybox"}, ""},
+		{[]string{"-p", "/run/x.pid", "run", "busybox"}, ""},
+		{[]string{"--pid-file=/run/x.pid", "run", "busybox"}, ""},
+		{[]string{"-l=false", "run", "busybox"}, ""},
+		{[]string{"-ln", "run", "busybox"}, ""},
+		{[]string{"-lp", "/run/x.pid", "run", "busybox"}, ""},
+		{[]string{"-n=healthy", "run", "busybox"}, ""},
+		{[]string{"--notify", "--logs=false", "run", "busybox"}, ""},
+		{[]string{"-x", "run", "busybox"}, "argument 2 (-x): unknown systemd-docker flag -x"},
+		{[]string{"-lx", "run", "busybox"}, "argument 2 (-lx): unknown systemd-docker flag -x"},
+		{[]string{"--bogus=1", "run", "busybox"}, "argument 2 (--bogus=1): unknown systemd-docker flag"},
+		{[]string{"-p", "/run/x.pid", "stray", "run", "busybox"}, "argument 4 (stray): unexpected argument before run"},
+		/* The container's command is not ours, whatever it looks like */
+		{[]string{"run", "--use-api-socket", "busybox", "--logs"}, ""},
+		{[]string{"run", "-e", "A=1", "--logs=false", "busybox"}, "argument 5 (--logs=false): systemd-docker flag must come before run"},
+		{[]string{"run", "-dit", "--cid-file", "x", "busybox"}, "argument 4 (--cid-file): systemd-docker flag must come before run"},
+	} {
+		_, err := Parse(append([]string{"--strict-args"}, test.args...))
+		if len(test.err) == 0 && err != nil {
+			t.Fatal("Expected", test.args, "to pass:", err)
+		}
+		if len(test.err) > 0 && (err == nil || err.Error() != test.err) {
+			t.Fatal("Expected", test.args, "to fail with", test.err, "got", err)
+		}
+	}
+}
+
+func TestRedactedArgs(t *testing.T) {
+	args := []string{"-e", "A=secret", "--env=B=secret", "-eC=secret", "--env", "D", "-p", "80:80", "busybox", "app", "--token", "secret"}
+	expected := "-e A=*** --env=B=*** -eC=*** --env D -p 80:80 busybox <3 command args>"
+	if redacted := strings.Join(redactedArgs(args), " "); redacted != expected {
+		t.Fatal("Expected", expected, "got", redacted)
+	}
+	if args[1] != "A=secret" {
+		t.Fatal("Redacting changed the args", args)
+	}
+
+	c, err := Parse([]string{"--log-sink", "send --token secret", "run", "-e", "PASSWORD=secret", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if description := describeContext(c); strings.Contains(description, "secret") {
+		t.Fatal("The debug log shows a secret", description)
+	}
+}
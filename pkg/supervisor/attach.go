@@ -0,0 +1,125 @@
+package supervisor
+
+import (
+	"io"
+	"os"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* With --attach the container runs in the foreground: the unit's stdin is
+ * forwarded and its output written as is, through a TTY if it was run with -t */
+
+var restoreTerminal = func() {}
+
+func attachStdio(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	tty := dockerx.HasTty(container)
+	if tty && isTerminal(os.Stdin.Fd()) {
+		err = makeRaw(os.Stdin.Fd())
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = attachContainer(c, client, tty, os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		restoreTerminal()
+		return err
+	}
+
+	if tty && isTerminal(os.Stdout.Fd()) {
+		go resizeOnWinch(c)
+	}
+
+	c.Attached = true
+	return nil
+}
+
+/* attachStdin forwards the unit's stdin to a container run with -i, output
+ * is left to --logs.  docker create -i sets StdinOnce, so the container sees
+ * EOF when our stdin ends. */
+func attachStdin(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = attachContainer(c, client, false, os.Stdin, nil, nil)
+	return err
+}
+
+func resizeTty(c *Context) {
+	rows, cols, err := terminalSize(os.Stdout.Fd())
+	if err != nil || rows == 0 || cols == 0 {
+		return
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	err = client.ContainerResize(ctx, c.Id, dockerContainer.ResizeOptions{Height: rows, Width: cols})
+	if err != nil {
+		logDebug("Failed to resize container tty:", err)
+	}
+}
+
+/* resizeOnWinch follows the size of our terminal.  The first resize waits
+ * for SIGWINCH too, startContainer sends one once the container runs. */
+func resizeOnWinch(c *Context) {
+	signals := make(chan os.Signal, 1)
+	notifyResize(signals)
+
+	for range signals {
+		resizeTty(c)
+	}
+}
+
+/* attachContainer attaches to the container's streams and copies them in
+ * the background, a nil stdin, stdout or stderr is not attached */
+func attachContainer(c *Context, client dockerx.API, tty bool, stdin io.Reader, stdout, stderr io.Writer) (io.Closer, error) {
+	resp, err := client.ContainerAttach(rootContext(c), c.Id, dockerContainer.AttachOptions{
+		Stream: true,
+		Stdin:  stdin != nil,
+		Stdout: stdout != nil,
+		Stderr: stderr != nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if stdin != nil {
+		go func() {
+			io.Copy(resp.Conn, stdin)
+			resp.CloseWrite()
+		}()
+	}
+
+	go func() {
+		defer resp.Close()
+		if stdout == nil {
+			stdout = io.Discard
+		}
+		if stderr == nil {
+			stderr = io.Discard
+		}
+		dockerx.CopyOutput(tty, stdout, stderr, resp.Reader)
+	}()
+
+	return resp.Conn, nil
+}
@@ -0,0 +1,239 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* --auto-update keeps a unit on the latest image of its tag, like podman
+ * auto-update.  Every --auto-update-interval the tag is resolved again, with
+ * registry at the registry and with local in the daemon's images.  When it
+ * points at another image than the container runs, the image is pulled, the
+ * container stopped and created again, and systemd told about the new pid.
+ * systemd tracks our pid meanwhile, so the unit stays up through it. */
+
+const (
+	AUTO_UPDATE_REGISTRY = "registry"
+	AUTO_UPDATE_LOCAL    = "local"
+)
+
+func checkAutoUpdate(c *Context) error {
+	switch c.AutoUpdate {
+	case "":
+		return nil
+	case AUTO_UPDATE_REGISTRY, AUTO_UPDATE_LOCAL:
+	default:
+		return errors.New(fmt.Sprintf("Invalid --auto-update %s, expected registry or local", c.AutoUpdate))
+	}
+
+	if len(imageDigest(imageRef(c.Args))) > 0 {
+		return errors.New("--auto-update needs an image tag, an image pinned by digest never changes")
+	}
+	if c.Foreground || c.Attach || c.Checkpoint {
+		return errors.New("--auto-update can't be used with --foreground, --attach or --checkpoint")
+	}
+	if c.UpdateInterval <= 0 {
+		return errors.New(fmt.Sprintf("Invalid --auto-update-interval %s, it must be positive", c.UpdateInterval))
+	}
+	return nil
+}
+
+/* updateAvailable resolves the image tag and tells whether the container
+ * runs something else, pulling the new image for registry */
+func updateAvailable(c *Context) (bool, error) {
+	client, err := getClient(c)
+	if err != nil {
+		return false, err
+	}
+
+	ref := imageRef(c.Args)
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return false, err
+	}
+
+	if c.AutoUpdate == AUTO_UPDATE_REGISTRY {
+		ctx, cancel := apiContext(c)
+		remote, err := client.DistributionInspect(ctx, ref, registryAuth(ref))
+		cancel()
+		if err != nil {
+			return false, err
+		}
+
+		running, err := localImage(c, client, container.Image)
+		if err != nil {
+			return false, err
+		}
+		if running != nil {
+			for _, digest := range running.RepoDigests {
+				if strings.HasSuffix(digest, "@"+remote.Descriptor.Digest.String()) {
+					return false, nil
+				}
+			}
+		}
+
+		logInfo(fmt.Sprintf("%s moved to %s", ref, remote.Descriptor.Digest))
+		err = pullImage(c, client, ref)
+		if err != nil {
+			pullFailed(c, ref, err)
+			return false, errors.New(fmt.Sprintf("Failed to pull %s: %s", ref, err))
+		}
+	}
+
+	image, err := localImage(c, client, ref)
+	if err != nil {
+		return false, err
+	}
+	if image == nil {
+		return false, errors.New(fmt.Sprintf("Image %s is gone", ref))
+	}
+	return image.ID != container.Image, nil
+}
+
+/* runAutoUpdate checks for updates until the unit stops, keepAlive does
+ * the recreating once the update stopped the container */
+func runAutoUpdate(c *Context) {
+	if len(c.AutoUpdate) == 0 {
+		return
+	}
+
+	for {
+		if sleepContext(c, c.UpdateInterval) != nil {
+			return
+		}
+
+		if !startUpdate(c) {
+			continue
+		}
+
+		select {
+		case <-c.updated:
+		case <-rootContext(c).Done():
+			return
+		}
+	}
+}
+
+/* startUpdate stops the container if its image moved on, true when it did
+ * and keepAlive is to replace it */
+func startUpdate(c *Context) bool {
+	c.identity.RLock()
+	defer c.identity.RUnlock()
+
+	update, err := updateAvailable(c)
+	if err != nil {
+		logWarn("Auto-update check failed:", err)
+		return false
+	}
+	if !update {
+		logDebug("Auto-update: image", imageRef(c.Args), "is current")
+		return false
+	}
+
+	logInfo(fmt.Sprintf("Updating container %s to the new %s", shortId(c.Id), imageRef(c.Args)))
+	sendNotify(c, fmt.Sprintf("MAINPID=%d", os.Getpid()), "STATUS=Updating to the new "+imageRef(c.Args))
+	notifyBarrier(c)
+
+	atomic.StoreInt32(&c.updating, 1)
+	err = stopContainer(c)
+	if err != nil {
+		logWarn("Failed to stop container for the update:", err)
+		atomic.StoreInt32(&c.updating, 0)
+		sendNotify(c, fmt.Sprintf("MAINPID=%d", mainPid(c)), statusMessage(c))
+		return false
+	}
+	return true
+}
+
+/* replaceContainer creates the container again after an update stopped it,
+ * from the image just pulled, and hands its pid to systemd.  The identity
+ * lock keeps the other goroutines off the container while it changes. */
+func replaceContainer(c *Context) error {
+	defer func() {
+		atomic.StoreInt32(&c.updating, 0)
+		select {
+		case c.updated <- struct{}{}:
+		default:
+		}
+	}()
+
+	c.identity.Lock()
+	defer c.identity.Unlock()
+
+	if !updating(c) {
+		/* Stopped meanwhile, the old container's exit is ours */
+		return nil
+	}
+
+	rt, err := getRuntime(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := cleanupContext(c, 0)
+	err = rt.Remove(ctx, c.Id, c.RmVolumes)
+	cancel()
+	if err != nil && !dockerx.IsNotFound(err) {
+		return err
+	}
+	unregisterMachine(c)
+
+	if cidfile, ok := argValue(createArgs(c.Args), "--cidfile"); ok {
+		/* docker create refuses to overwrite it */
+		os.Remove(cidfile)
+	}
+
+	old := c.Id
+	c.Id = ""
+	c.Pid = 0
+	c.Exited = false
+	c.ExitCode = 0
+	atomic.StoreInt32(&c.Unhealthy, 0)
+	markUnhealthy(c, false)
+	err = launchContainer(c)
+	if err != nil {
+		return withExitCode(EXIT_START_FAILED, err)
+	}
+	if c.Exited {
+		return errors.New(fmt.Sprintf("Updated container %s exited right away with code %d", shortId(c.Id), c.ExitCode))
+	}
+	logInfo(fmt.Sprintf("Replaced container %s with %s", shortId(old), shortId(c.Id)))
+	setLogField("container", c.Id)
+
+	startedEvent(c)
+	err = sendNotify(c, fmt.Sprintf("MAINPID=%d", mainPid(c)), statusMessage(c))
+	if err != nil {
+		return err
+	}
+	notifyBarrier(c)
+
+	err = pidFile(c)
+	if err == nil {
+		err = cidFile(c)
+	}
+	if err == nil {
+		err = writeContainerEnv(c)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = storeState(c)
+	if err != nil {
+		logWarn("Failed to store state in fd store:", err)
+	}
+	registerMachine(c)
+	if !c.Attached {
+		go pipeLogs(c)
+	}
+	return nil
+}
+
+func updating(c *Context) bool {
+	return atomic.LoadInt32(&c.updating) == 1
+}
@@ -0,0 +1,68 @@
+package supervisor
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckAutoUpdate(t *testing.T) {
+	c, err := Parse([]string{"--auto-update=registry", "run", "nginx:stable"})
+	if err != nil || c.AutoUpdate != AUTO_UPDATE_REGISTRY {
+		t.Fatal("Expected registry", err)
+	}
+
+	for _, args := range [][]string{
+		{"--auto-update=sometimes", "run", "nginx:stable"},
+		{"--auto-update=registry", "run", "nginx@sha256:abc"},
+		{"--auto-update=local", "--foreground", "run", "nginx"},
+		{"--auto-update=local", "--auto-update-interval=0", "run", "nginx"},
+	} {
+		if _, err := Parse(args); err == nil {
+			t.Fatal("Expected", args, "to fail")
+		}
+	}
+}
+
+/* updateServer runs image old from a registry whose tag moved to new */
+func updateServer(t *testing.T) (*Context, *fakeDaemon) {
+	present := false
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/abc/json"):
+			w.Write([]byte(`{"Id": "abc", "Image": "sha256:old", "State": {"Running": true}}`))
+		case strings.Contains(r.URL.Path, "/distribution/"):
+			w.Write([]byte(`{"Descriptor": {"digest": "sha256:1111111111111111111111111111111111111111111111111111111111111111"}}`))
+		case strings.HasSuffix(r.URL.Path, "/images/sha256:old/json"):
+			w.Write([]byte(`{"Id": "sha256:old", "RepoDigests": ["nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000"]}`))
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			present = true
+			w.Write([]byte(`{"status": "Downloaded newer image"}`))
+		case strings.HasSuffix(r.URL.Path, "/images/nginx:stable/json"):
+			if present {
+				w.Write([]byte(`{"Id": "sha256:new"}`))
+			} else {
+				w.Write([]byte(`{"Id": "sha256:old"}`))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return &Context{Client: daemon.Client, Id: "abc", Args: []string{"-d", "nginx:stable"}}, daemon
+}
+
+func TestUpdateAvailable(t *testing.T) {
+	c, daemon := updateServer(t)
+
+	c.AutoUpdate = AUTO_UPDATE_LOCAL
+	update, err := updateAvailable(c)
+	if err != nil || update || len(pulled(daemon)) != 0 {
+		t.Fatal("Expected the local tag to be current", update, pulled(daemon), err)
+	}
+
+	c.AutoUpdate = AUTO_UPDATE_REGISTRY
+	update, err = updateAvailable(c)
+	if err != nil || !update || len(pulled(daemon)) != 1 {
+		t.Fatal("Expected the moved tag to be pulled", update, pulled(daemon), err)
+	}
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* waitRunning waits for container id of m to run, failing t after a while */
+func waitRunning(t *testing.T, m *runtime.Mock, id string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		container, err := m.Inspect(context.Background(), id)
+		if err == nil && container.State.Running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Container", id, "never ran")
+}
+
+/* A whole update with the watchers running, for -race */
+func TestAutoUpdateReplacesContainer(t *testing.T) {
+	c, err := Parse([]string{"--auto-update=local", "--auto-update-interval=50ms", "--poll-interval=20ms",
+		"--unhealthy-timeout=1h", "--metrics-textfile=" + path.Join(t.TempDir(), "web.prom"), "--metrics-interval=10ms",
+		"--logs=false", "run", "--rm", "--name", "web", "nginx:stable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := runtime.NewMock()
+	m.Processes = true
+	m.SetImage("sha256:old")
+	c.Runtime = m
+	c.Client = mockDaemon(t, m)
+
+	done := make(chan error)
+	go func() {
+		_, err := supervise(c, time.Now())
+		done <- err
+	}()
+
+	waitRunning(t, m, "created-1")
+	m.SetHealth("created-1", "unhealthy")
+	time.Sleep(100 * time.Millisecond)
+
+	/* The tag moves on */
+	m.SetImage("sha256:new")
+	waitRunning(t, m, "created-2")
+	time.Sleep(100 * time.Millisecond)
+	m.Exit("created-2", 0)
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The updated container's exit didn't end the unit")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := strings.Join(m.Calls, ", ")
+	if !strings.Contains(calls, "stop created-1, remove created-1, create created-2, start created-2") {
+		t.Fatal("Expected the container to be replaced", calls)
+	}
+	if c.Id != "created-2" || isUnhealthy(c) || unhealthyFor(c) != 0 {
+		t.Fatal("Expected the new container to be followed afresh", c.Id, isUnhealthy(c))
+	}
+	if logFields["container"] != "created-2" {
+		t.Fatal("Expected the log field to follow the container", logFields["container"])
+	}
+}
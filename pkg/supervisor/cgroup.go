@@ -0,0 +1,142 @@
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* On unified (cgroup v2) hosts the container's cgroup tells exactly which
+ * processes are its own.  cgroup.procs confirms a pid still belongs to the
+ * container, where /proc/<pid> may already be a reused pid, and cgroup.events
+ * says populated 0 the moment its last process is gone. */
+
+var (
+	cgroupRoot = "/sys/fs/cgroup"
+	procRoot   = "/proc"
+)
+
+/* pidCgroup is the unified hierarchy cgroup directory of pid, empty on hosts
+ * still mounting cgroup v1 controllers */
+func pidCgroup(pid int) string {
+	data, err := ioutil.ReadFile(path.Join(procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "0::/") {
+		return ""
+	}
+	return path.Join(cgroupRoot, strings.TrimPrefix(lines[0], "0::"))
+}
+
+func cgroupPopulated(dir string) (bool, error) {
+	f, err := os.Open(path.Join(dir, "cgroup.events"))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "populated" {
+			return fields[1] == "1", nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func cgroupHasPid(dir string, pid int) (bool, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == strconv.Itoa(pid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/* cgroupTarget is the pid and cgroup watchCgroup watches.  The watcher runs
+ * in its own goroutine, so it gets them from here rather than from c.Pid and
+ * c.Cgroup. */
+type cgroupTarget struct {
+	lock sync.Mutex
+	pid  int
+	dir  string
+}
+
+func (t *cgroupTarget) set(pid int, dir string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pid, t.dir = pid, dir
+}
+
+func (t *cgroupTarget) get() (int, string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.pid, t.dir
+}
+
+/* trackCgroup remembers the cgroup of the container's new pid */
+func trackCgroup(c *Context) {
+	c.Cgroup = ""
+	if c.Pid > 0 {
+		c.Cgroup = pidCgroup(c.Pid)
+	}
+	c.watched.set(c.Pid, c.Cgroup)
+}
+
+/* containerDied is whether the container's main process is gone */
+func containerDied(c *Context) bool {
+	if len(c.Cgroup) > 0 {
+		ok, err := cgroupHasPid(c.Cgroup, c.Pid)
+		if err == nil || os.IsNotExist(err) {
+			return !ok
+		}
+	}
+	return pidDied(c)
+}
+
+/* watchCgroup fires whenever the container's cgroup empties, until the
+ * returned func is called.  It watches again once the container got a new
+ * pid, a restarted container reuses its cgroup. */
+func watchCgroup(c *Context) (<-chan struct{}, func()) {
+	ctx, cancel := context.WithCancel(rootContext(c))
+	emptied := make(chan struct{}, 1)
+	interval := pollInterval(c)
+
+	go func() {
+		for ctx.Err() == nil {
+			pid, dir := c.watched.get()
+			if len(dir) > 0 && waitCgroupEmpty(ctx, dir) {
+				select {
+				case emptied <- struct{}{}:
+				default:
+				}
+			}
+
+			for ctx.Err() == nil {
+				if current, _ := c.watched.get(); current != pid {
+					break
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(interval):
+				}
+			}
+		}
+	}()
+
+	return emptied, cancel
+}
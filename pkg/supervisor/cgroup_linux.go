@@ -0,0 +1,46 @@
+package supervisor
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+)
+
+/* waitCgroupEmpty returns true once dir isn't populated anymore, false if
+ * ctx ended first.  The kernel signals changes of cgroup.events through
+ * inotify. */
+func waitCgroupEmpty(ctx context.Context, dir string) bool {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		logDebug("Failed to watch the container's cgroup:", err)
+		<-ctx.Done()
+		return false
+	}
+
+	/* Non blocking, so closing it ends a pending read */
+	events := os.NewFile(uintptr(fd), "inotify")
+	defer events.Close()
+
+	_, err = syscall.InotifyAddWatch(fd, path.Join(dir, "cgroup.events"), syscall.IN_MODIFY)
+	if err != nil {
+		/* Gone already */
+		return true
+	}
+
+	stop := context.AfterFunc(ctx, func() { events.Close() })
+	defer stop()
+
+	buf := make([]byte, 4096)
+	for {
+		populated, err := cgroupPopulated(dir)
+		if err != nil || !populated {
+			return ctx.Err() == nil
+		}
+
+		_, err = events.Read(buf)
+		if err != nil {
+			return ctx.Err() == nil
+		}
+	}
+}
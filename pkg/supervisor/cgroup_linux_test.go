@@ -0,0 +1,44 @@
+package supervisor
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWaitCgroupEmpty(t *testing.T) {
+	scope := fakeCgroup(t, "42", "0::/system.slice/docker-abc.scope\n")
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- waitCgroupEmpty(context.Background(), scope)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Populated cgroup taken as empty")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ioutil.WriteFile(path.Join(scope, "cgroup.events"), []byte("populated 0\nfrozen 0\n"), 0644)
+	select {
+	case emptied := <-done:
+		if !emptied {
+			t.Fatal("Not emptied")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Emptied cgroup not noticed")
+	}
+}
+
+func TestWaitCgroupEmptyCancelled(t *testing.T) {
+	scope := fakeCgroup(t, "42", "0::/system.slice/docker-abc.scope\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if waitCgroupEmpty(ctx, scope) {
+		t.Fatal("Cancelled wait taken as emptied")
+	}
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func fakeCgroup(t *testing.T, pid string, cgroup string) string {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	oldProc, oldCgroup := procRoot, cgroupRoot
+	procRoot, cgroupRoot = path.Join(dir, "proc"), path.Join(dir, "cgroup")
+	t.Cleanup(func() { procRoot, cgroupRoot = oldProc, oldCgroup })
+
+	os.MkdirAll(path.Join(procRoot, pid), 0755)
+	ioutil.WriteFile(path.Join(procRoot, pid, "cgroup"), []byte(cgroup), 0644)
+
+	scope := path.Join(cgroupRoot, "system.slice", "docker-abc.scope")
+	os.MkdirAll(scope, 0755)
+	ioutil.WriteFile(path.Join(scope, "cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0644)
+	ioutil.WriteFile(path.Join(scope, "cgroup.procs"), []byte(pid+"\n"), 0644)
+	return scope
+}
+
+func TestPidCgroup(t *testing.T) {
+	scope := fakeCgroup(t, "42", "0::/system.slice/docker-abc.scope\n")
+	if dir := pidCgroup(42); dir != scope {
+		t.Fatal("Expected", scope, "got", dir)
+	}
+
+	/* Hybrid hosts have v1 controllers next to the unified hierarchy */
+	fakeCgroup(t, "42", "12:pids:/system.slice/docker-abc.scope\n0::/system.slice/docker-abc.scope\n")
+	if dir := pidCgroup(42); dir != "" {
+		t.Fatal("Cgroup v1 host taken as unified", dir)
+	}
+}
+
+func TestCgroupPopulated(t *testing.T) {
+	scope := fakeCgroup(t, "42", "0::/system.slice/docker-abc.scope\n")
+
+	populated, err := cgroupPopulated(scope)
+	if err != nil || !populated {
+		t.Fatal("Not populated", err)
+	}
+
+	ioutil.WriteFile(path.Join(scope, "cgroup.events"), []byte("populated 0\nfrozen 0\n"), 0644)
+	populated, err = cgroupPopulated(scope)
+	if err != nil || populated {
+		t.Fatal("Populated", err)
+	}
+}
+
+func TestContainerDied(t *testing.T) {
+	scope := fakeCgroup(t, "42", "0::/system.slice/docker-abc.scope\n")
+
+	c := &Context{Pid: 42}
+	trackCgroup(c)
+	if c.Cgroup != scope || containerDied(c) {
+		t.Fatal("Container taken as dead", c.Cgroup)
+	}
+
+	/* The pid was reused by a process outside the container */
+	ioutil.WriteFile(path.Join(scope, "cgroup.procs"), []byte("43\n"), 0644)
+	if !containerDied(c) {
+		t.Fatal("Reused pid taken as the container")
+	}
+
+	os.RemoveAll(scope)
+	if !containerDied(c) {
+		t.Fatal("Container with a removed cgroup taken as alive")
+	}
+}
@@ -0,0 +1,84 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+/* With the systemd cgroup driver docker puts containers in system.slice, away
+ * from the slice of the unit running them.  Unless run has a --cgroup-parent
+ * of its own we put them in the unit's slice, so Slice= and the resource
+ * controls of that slice apply to the container.  A container scope can't be
+ * put under the service itself, systemd only nests units in slices. */
+
+/* sliceFromCgroup finds the slice of the service we run in.  Services of a
+ * user manager are left alone, their slices aren't the system's. */
+func sliceFromCgroup(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		units := strings.Split(strings.Trim(parts[2], "/"), "/")
+		if len(units) < 2 || !strings.HasSuffix(units[len(units)-1], ".service") {
+			continue
+		}
+
+		for _, unit := range units[:len(units)-1] {
+			if !strings.HasSuffix(unit, ".slice") {
+				return ""
+			}
+		}
+		return units[len(units)-2]
+	}
+	return ""
+}
+
+func unitSlice(c *Context) string {
+	if len(c.CgroupSlice) > 0 {
+		return c.CgroupSlice
+	}
+
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	return sliceFromCgroup(string(data))
+}
+
+/* cgroupParentArgs puts the container in the unit's slice when docker uses
+ * the systemd cgroup driver */
+func cgroupParentArgs(c *Context) []string {
+	if c.CgroupSlice == "none" {
+		return nil
+	}
+	if _, ok := findRunFlag(c.Args, "cgroup-parent"); ok {
+		return nil
+	}
+
+	slice := unitSlice(c)
+	if len(slice) == 0 {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		logDebug("Failed to ask the daemon for its cgroup driver:", err)
+		return nil
+	}
+	if info.CgroupDriver != "systemd" {
+		return nil
+	}
+
+	logDebug("Putting the container in", slice)
+	return []string{"--cgroup-parent", slice}
+}
@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSliceFromCgroup(t *testing.T) {
+	if slice := sliceFromCgroup("0::/db.slice/postgres.service\n"); slice != "db.slice" {
+		t.Fatal("Expected db.slice, got", slice)
+	}
+
+	if slice := sliceFromCgroup("12:pids:/system.slice/web.service\n1:name=systemd:/system.slice/web.service\n"); slice != "system.slice" {
+		t.Fatal("Expected system.slice, got", slice)
+	}
+
+	if slice := sliceFromCgroup("0::/user.slice/user-1000.slice/user@1000.service/app.slice/web.service\n"); slice != "" {
+		t.Fatal("Slice of a user service", slice)
+	}
+}
+
+func cgroupDriverContext(t *testing.T, driver string, args ...string) *Context {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf(`{"CgroupDriver": %q}`, driver)))
+	}).Client
+
+	return &Context{Client: client, Args: args, CgroupSlice: "db.slice"}
+}
+
+func TestCgroupParentArgs(t *testing.T) {
+	args := cgroupParentArgs(cgroupDriverContext(t, "systemd", "postgres"))
+	if strings.Join(args, " ") != "--cgroup-parent db.slice" {
+		t.Fatal("Bad args", args)
+	}
+
+	if args := cgroupParentArgs(cgroupDriverContext(t, "cgroupfs", "postgres")); len(args) > 0 {
+		t.Fatal("Slice given to the cgroupfs driver", args)
+	}
+
+	if args := cgroupParentArgs(cgroupDriverContext(t, "systemd", "--cgroup-parent=other.slice", "postgres")); len(args) > 0 {
+		t.Fatal("--cgroup-parent of run replaced", args)
+	}
+
+	c := cgroupDriverContext(t, "systemd", "postgres")
+	c.CgroupSlice = "none"
+	if args := cgroupParentArgs(c); len(args) > 0 {
+		t.Fatal("--cgroup-slice=none not honored", args)
+	}
+}
@@ -0,0 +1,136 @@
+package supervisor
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types/versions"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* systemd-docker check takes the same arguments as a normal run and verifies
+ * what the container needs is there, for ExecCondition=.  Unmet requirements
+ * exit 1 so systemd skips the unit, a broken check exits 255 and fails it. */
+
+const (
+	EXIT_CONDITION_FAILED = 1
+	EXIT_CONDITION_ERROR  = 255
+)
+
+var ErrConditionFailed = errors.New("Container prerequisites are not met")
+
+/* runDevices are the host side of the --device flags in docker run args */
+func runDevices(args []string) []string {
+	flags, _ := parseRunArgs(args)
+
+	devices := []string{}
+	for _, f := range flags {
+		if f.Name == "device" && len(f.Value) > 0 {
+			devices = append(devices, strings.SplitN(f.Value, ":", 2)[0])
+		}
+	}
+	return devices
+}
+
+func checkPaths(s *checkReport, kind string, paths []string) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			s.add(kind+" "+path, checkFail, "missing")
+		} else {
+			s.add(kind+" "+path, checkOk, "")
+		}
+	}
+}
+
+func checkImage(s *checkReport, c *Context, client dockerx.API) {
+	ref := imageRef(c.Args)
+	if len(ref) == 0 {
+		s.add("image", checkFail, "no image in run arguments")
+		return
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	_, err := client.ImageInspect(ctx, ref)
+	if err == nil {
+		s.add("image "+ref, checkOk, "present")
+		return
+	}
+	if !dockerx.IsNotFound(err) {
+		s.add("image "+ref, checkFail, err.Error())
+		return
+	}
+
+	if versions.LessThan(client.ClientVersion(), API_DISTRIBUTION) {
+		s.add("image "+ref, checkFail, "not present, asking the registry needs Docker API "+API_DISTRIBUTION)
+		return
+	}
+
+	/* Asks the registry for the manifest without pulling */
+	_, err = client.DistributionInspect(ctx, ref, registryAuth(ref))
+	if err != nil {
+		s.add("image "+ref, checkFail, "not present and not pullable: "+err.Error())
+		return
+	}
+	s.add("image "+ref, checkOk, "pullable")
+}
+
+func runChecks(c *Context) *checkReport {
+	s := &checkReport{}
+
+	client, err := getClient(c)
+	if err == nil {
+		ctx, cancel := apiContext(c)
+		_, err = client.Ping(ctx)
+		cancel()
+	}
+	if err != nil {
+		s.add("daemon", checkFail, err.Error())
+	} else {
+		s.add("daemon", checkOk, dockerHost())
+		err = checkAPIVersion(c)
+		if err != nil {
+			s.add("api", checkFail, err.Error())
+		}
+		checkImage(s, c, client)
+	}
+
+	if c.MkdirVolumes {
+		for _, source := range bindSources(c.Args) {
+			s.add("volume "+source, checkOk, "created on start")
+		}
+	} else {
+		checkPaths(s, "volume", bindSources(c.Args))
+	}
+
+	checkPaths(s, "device", runDevices(c.Args))
+
+	gpus, runtime := gpuRequirements(c.Args)
+	if gpus || len(runtime) > 0 {
+		err = checkGpu(c, gpus, runtime)
+		if err != nil {
+			s.add("gpu", checkFail, err.Error())
+		} else {
+			s.add("gpu", checkOk, "")
+		}
+	}
+
+	return s
+}
+
+func checkMain(args []string) error {
+	c, err := Parse(args)
+	if err != nil {
+		return err
+	}
+
+	s := runChecks(c)
+	s.print(os.Stdout)
+
+	if s.failed() {
+		return ErrConditionFailed
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunDevices(t *testing.T) {
+	devices := runDevices([]string{"--device", "/dev/sdc:/dev/xvdc:rwm", "--device=/dev/fuse", "busybox", "--device", "/dev/nope"})
+	if strings.Join(devices, " ") != "/dev/sdc /dev/fuse" {
+		t.Fatal("Bad devices", devices)
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_ping":
+			w.Write([]byte("OK"))
+		case strings.Contains(r.URL.Path, "/distribution/"):
+			w.Write([]byte(`{"Descriptor": {}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}).Client
+
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Context{Client: client, Args: []string{"-v", dir + ":/data", "-v", dir + "/missing:/other", "busybox"}}
+	s := runChecks(c)
+
+	results := map[string]checkResult{}
+	for _, result := range s.Results {
+		results[result.Name] = result
+	}
+
+	if results["image busybox"].Detail != "pullable" {
+		t.Fatal("Expected a pullable image", s.Results)
+	}
+	if results["volume "+dir].Status != checkOk || results["volume "+dir+"/missing"].Status != checkFail {
+		t.Fatal("Bad volume checks", s.Results)
+	}
+	if !s.failed() {
+		t.Fatal("A missing volume should fail the check")
+	}
+
+	c.MkdirVolumes = true
+	if runChecks(c).failed() {
+		t.Fatal("--mkdir-volumes creates missing volumes")
+	}
+}
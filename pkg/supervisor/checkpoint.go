@@ -0,0 +1,116 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types/checkpoint"
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* --checkpoint has CRIU dump the container on stop instead of killing it,
+ * and the next start restores it.  The checkpoint lives outside the container
+ * so it survives --rm and a new container of the same name restores it.  This
+ * needs an experimental daemon with CRIU installed. */
+
+const CHECKPOINT_ID = "systemd-docker"
+
+const CHECKPOINT_ROOT = "/var/lib/systemd-docker/checkpoints"
+
+func checkpointDir(c *Context) string {
+	if len(c.CheckpointDir) > 0 {
+		return c.CheckpointDir
+	}
+	return path.Join(CHECKPOINT_ROOT, c.Name)
+}
+
+func checkCheckpoint(c *Context) error {
+	if c.Checkpoint && len(c.CheckpointDir) == 0 && len(c.Name) == 0 {
+		return errors.New("--checkpoint needs a container name or --checkpoint-dir to find the checkpoint again")
+	}
+	return nil
+}
+
+func hasCheckpoint(c *Context) bool {
+	_, err := os.Stat(path.Join(checkpointDir(c), CHECKPOINT_ID))
+	return err == nil
+}
+
+/* checkpointContainer dumps and stops the container, false if it couldn't
+ * and has to be stopped the usual way */
+func checkpointContainer(c *Context, grace time.Duration) bool {
+	client, err := getClient(c)
+	if err != nil {
+		logWarn("Failed to checkpoint container:", err)
+		return false
+	}
+
+	dir := checkpointDir(c)
+	err = os.MkdirAll(dir, 0700)
+	if err == nil {
+		/* A checkpoint that was never restored is stale by now */
+		err = os.RemoveAll(path.Join(dir, CHECKPOINT_ID))
+	}
+	if err != nil {
+		logWarn("Failed to checkpoint container:", err)
+		return false
+	}
+
+	ctx, cancel := cleanupContext(c, grace)
+	defer cancel()
+
+	err = client.CheckpointCreate(ctx, c.Id, checkpoint.CreateOptions{
+		CheckpointID:  CHECKPOINT_ID,
+		CheckpointDir: dir,
+		Exit:          true,
+	})
+	if err != nil {
+		logWarn("Failed to checkpoint container, stopping it instead:", err)
+		return false
+	}
+
+	logInfo("Checkpointed container to", dir)
+	return true
+}
+
+func removeCheckpoint(c *Context) {
+	dir := checkpointDir(c)
+	err := os.RemoveAll(path.Join(dir, CHECKPOINT_ID))
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to remove checkpoint in %s: %s", dir, err))
+	}
+}
+
+/* startFromCheckpoint starts the container, restored from its checkpoint if
+ * there is one.  The checkpoint is used up either way, if restoring fails the
+ * container starts afresh. */
+func startFromCheckpoint(c *Context, client dockerx.API) error {
+	options := dockerContainer.StartOptions{}
+	restore := c.Checkpoint && hasCheckpoint(c)
+	if restore {
+		logInfo("Restoring container from checkpoint in", checkpointDir(c))
+		options.CheckpointID = CHECKPOINT_ID
+		options.CheckpointDir = checkpointDir(c)
+	}
+
+	ctx, cancel := apiContext(c)
+	err := client.ContainerStart(ctx, c.Id, options)
+	cancel()
+	if !restore {
+		return err
+	}
+
+	removeCheckpoint(c)
+	if err == nil {
+		return nil
+	}
+
+	logWarn("Failed to restore container, starting it afresh:", err)
+	ctx, cancel = apiContext(c)
+	defer cancel()
+	return client.ContainerStart(ctx, c.Id, dockerContainer.StartOptions{})
+}
@@ -0,0 +1,91 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkpointServer(t *testing.T, restoreFails bool) (*Context, *fakeDaemon) {
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if restoreFails && len(r.URL.Query().Get("checkpoint")) > 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message": "criu failed"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return &Context{Id: "abc", Client: daemon.Client, Checkpoint: true, CheckpointDir: dir}, daemon
+}
+
+func TestCheckpointContainer(t *testing.T) {
+	c, daemon := checkpointServer(t, false)
+
+	if !checkpointContainer(c, time.Second) {
+		t.Fatal("Checkpoint failed")
+	}
+
+	calls := daemon.calls()
+	if len(calls) != 1 || calls[0].Method+" "+calls[0].Path != "POST /v1.41/containers/abc/checkpoints" ||
+		!strings.Contains(calls[0].Body, `"CheckpointDir":"`+c.CheckpointDir+`"`) || !strings.Contains(calls[0].Body, `"Exit":true`) {
+		t.Fatal("Bad checkpoint request", calls)
+	}
+}
+
+func TestStartFromCheckpoint(t *testing.T) {
+	c, daemon := checkpointServer(t, false)
+
+	err := startFromCheckpoint(c, c.Client)
+	calls := daemon.calls()
+	if err != nil || len(calls) != 1 || calls[0].Query.Has("checkpoint") {
+		t.Fatal("Restored without a checkpoint", err, calls)
+	}
+
+	os.Mkdir(path.Join(c.CheckpointDir, CHECKPOINT_ID), 0700)
+	err = startFromCheckpoint(c, c.Client)
+	calls = daemon.calls()
+	if err != nil || len(calls) != 2 || calls[1].Query.Get("checkpoint") != CHECKPOINT_ID {
+		t.Fatal("Not restored", err, calls)
+	}
+
+	if hasCheckpoint(c) {
+		t.Fatal("Checkpoint restored twice")
+	}
+}
+
+func TestStartFromBrokenCheckpoint(t *testing.T) {
+	c, daemon := checkpointServer(t, true)
+
+	os.Mkdir(path.Join(c.CheckpointDir, CHECKPOINT_ID), 0700)
+	err := startFromCheckpoint(c, c.Client)
+	calls := daemon.calls()
+	if err != nil || len(calls) != 2 || calls[1].Query.Has("checkpoint") {
+		t.Fatal("Not started afresh", err, calls)
+	}
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	c, err := Parse([]string{"--checkpoint", "run", "--name", "db", "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpointDir(c) != CHECKPOINT_ROOT+"/db" {
+		t.Fatal("Bad checkpoint dir", checkpointDir(c))
+	}
+
+	_, err = Parse([]string{"--checkpoint", "--default-name=false", "run", "postgres"})
+	if err == nil {
+		t.Fatal("Unnamed checkpoint accepted")
+	}
+}
@@ -0,0 +1,1055 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+/* systemd-docker compose -f docker-compose.yml up runs a whole stack in one
+ * unit.  Every service becomes a docker create like a normal run, the unit is
+ * ready once all of them run (and are healthy if they have a healthcheck), and
+ * the stack is torn down when the unit stops or any service exits. */
+
+const (
+	LABEL_COMPOSE_PROJECT = "com.docker.compose.project"
+	LABEL_COMPOSE_SERVICE = "com.docker.compose.service"
+	LABEL_COMPOSE_NETWORK = "com.docker.compose.network"
+	LABEL_COMPOSE_VOLUME  = "com.docker.compose.volume"
+)
+
+/* stringList is a compose field given either as a string or a list, a string
+ * is split like a shell would */
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		words, err := shellSplit(node.Value)
+		if err != nil {
+			return err
+		}
+		*l = words
+		return nil
+	}
+
+	var list []string
+	err := node.Decode(&list)
+	*l = list
+	return err
+}
+
+/* keyValues is a compose field given either as a map or as a list of
+ * KEY=VALUE, a key without value takes it from our environment */
+type keyValues []string
+
+func (kv *keyValues) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		var list []string
+		err := node.Decode(&list)
+		*kv = list
+		return err
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if value.Tag == "!!null" {
+			*kv = append(*kv, key)
+		} else {
+			*kv = append(*kv, key+"="+value.Value)
+		}
+	}
+	return nil
+}
+
+/* serviceNetworks is the networks of a service, as a list or a map with aliases */
+type serviceNetworks struct {
+	Names   []string
+	Aliases map[string][]string
+}
+
+func (n *serviceNetworks) UnmarshalYAML(node *yaml.Node) error {
+	n.Aliases = map[string][]string{}
+	if node.Kind != yaml.MappingNode {
+		return node.Decode(&n.Names)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		n.Names = append(n.Names, name)
+
+		var network struct {
+			Aliases []string
+		}
+		err := node.Content[i+1].Decode(&network)
+		if err != nil {
+			return err
+		}
+		n.Aliases[name] = network.Aliases
+	}
+	return nil
+}
+
+const (
+	DEPENDS_STARTED   = "service_started"
+	DEPENDS_HEALTHY   = "service_healthy"
+	DEPENDS_COMPLETED = "service_completed_successfully"
+)
+
+/* dependsOn maps the services a service needs to their condition */
+type dependsOn map[string]string
+
+func (d *dependsOn) UnmarshalYAML(node *yaml.Node) error {
+	*d = dependsOn{}
+	if node.Kind != yaml.MappingNode {
+		var names []string
+		err := node.Decode(&names)
+		for _, name := range names {
+			(*d)[name] = DEPENDS_STARTED
+		}
+		return err
+	}
+
+	var conditions map[string]struct {
+		Condition string
+	}
+	err := node.Decode(&conditions)
+	if err != nil {
+		return err
+	}
+
+	for name, dependency := range conditions {
+		switch dependency.Condition {
+		case "":
+			(*d)[name] = DEPENDS_STARTED
+		case DEPENDS_STARTED, DEPENDS_HEALTHY, DEPENDS_COMPLETED:
+			(*d)[name] = dependency.Condition
+		default:
+			return errors.New(fmt.Sprintf("Invalid depends_on condition %s", dependency.Condition))
+		}
+	}
+	return nil
+}
+
+type composeHealthcheck struct {
+	Test        stringList
+	Interval    string
+	Timeout     string
+	Retries     int
+	StartPeriod string `yaml:"start_period"`
+	Disable     bool
+}
+
+type composeService struct {
+	Image           string
+	ContainerName   string `yaml:"container_name"`
+	Command         *stringList
+	Entrypoint      *stringList
+	Environment     keyValues
+	EnvFile         stringList `yaml:"env_file"`
+	Ports           []string
+	Volumes         []string
+	Networks        serviceNetworks
+	DependsOn       dependsOn `yaml:"depends_on"`
+	Restart         string
+	Labels          keyValues
+	User            string
+	WorkingDir      string `yaml:"working_dir"`
+	Hostname        string
+	Healthcheck     *composeHealthcheck
+	CapAdd          []string `yaml:"cap_add"`
+	CapDrop         []string `yaml:"cap_drop"`
+	Devices         []string
+	ExtraHosts      []string `yaml:"extra_hosts"`
+	Dns             stringList
+	Tmpfs           stringList
+	Privileged      bool
+	ReadOnly        bool `yaml:"read_only"`
+	Init            bool
+	Tty             bool
+	StdinOpen       bool   `yaml:"stdin_open"`
+	StopSignal      string `yaml:"stop_signal"`
+	StopGracePeriod string `yaml:"stop_grace_period"`
+}
+
+/* composeResource is a top level network or volume */
+type composeResource struct {
+	Name     string
+	Driver   string
+	External bool
+}
+
+type composeFile struct {
+	/* Obsolete, accepted and ignored like docker compose does */
+	Version  string
+	Name     string
+	Services map[string]*composeService
+	Networks map[string]*composeResource
+	Volumes  map[string]*composeResource
+}
+
+type composeProject struct {
+	composeFile
+	Dir   string
+	Order []string
+
+	c          *Context
+	containers map[string]*Context
+	networks   []string
+	pulls      int
+	logs       sync.Mutex
+}
+
+/* shellSplit splits a command line into words, honoring quotes and backslashes */
+func shellSplit(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != '\'' && r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New(fmt.Sprintf("Unterminated quote in %s", s))
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+var invalidProjectChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+func projectName(name string) string {
+	return invalidProjectChars.ReplaceAllString(strings.ToLower(name), "")
+}
+
+/* loadCompose reads a compose file, unknown keys are errors rather than
+ * silently ignored */
+func loadCompose(file, name string) (*composeProject, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &composeProject{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(&p.composeFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid compose file %s: %s", file, err))
+	}
+
+	p.Dir, err = filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(name) > 0 {
+		p.Name = name
+	} else if len(p.Name) == 0 {
+		p.Name = filepath.Base(p.Dir)
+	}
+	p.Name = projectName(p.Name)
+	if len(p.Name) == 0 {
+		return nil, errors.New("Empty project name, use --project-name")
+	}
+
+	if len(p.Services) == 0 {
+		return nil, errors.New(fmt.Sprintf("No services in %s", file))
+	}
+
+	for serviceName, service := range p.Services {
+		if service == nil || len(service.Image) == 0 {
+			return nil, errors.New(fmt.Sprintf("Service %s has no image, building images is not supported", serviceName))
+		}
+
+		for dependency := range service.DependsOn {
+			if _, ok := p.Services[dependency]; !ok {
+				return nil, errors.New(fmt.Sprintf("Service %s depends on unknown service %s", serviceName, dependency))
+			}
+		}
+
+		for _, network := range service.Networks.Names {
+			if _, ok := p.Networks[network]; !ok && network != "default" {
+				return nil, errors.New(fmt.Sprintf("Service %s uses undefined network %s", serviceName, network))
+			}
+		}
+	}
+
+	p.Order, err = serviceOrder(p.Services)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+/* serviceOrder sorts services so each comes after the ones it depends on,
+ * alphabetically otherwise */
+func serviceOrder(services map[string]*composeService) ([]string, error) {
+	names := []string{}
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := []string{}
+	state := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return errors.New(fmt.Sprintf("Dependency cycle: %s", strings.Join(append(path, name), " -> ")))
+		case 2:
+			return nil
+		}
+
+		state[name] = 1
+		dependencies := []string{}
+		for dependency := range services[name].DependsOn {
+			dependencies = append(dependencies, dependency)
+		}
+		sort.Strings(dependencies)
+
+		for _, dependency := range dependencies {
+			err := visit(dependency, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+func (p *composeProject) containerName(service string) string {
+	if name := p.Services[service].ContainerName; len(name) > 0 {
+		return name
+	}
+	return p.Name + "-" + service
+}
+
+func (p *composeProject) networkName(network string) string {
+	if resource := p.Networks[network]; resource != nil {
+		if len(resource.Name) > 0 {
+			return resource.Name
+		}
+		if resource.External {
+			return network
+		}
+	}
+	return p.Name + "_" + network
+}
+
+func (p *composeProject) volumeName(volume string) string {
+	if resource := p.Volumes[volume]; resource != nil {
+		if len(resource.Name) > 0 {
+			return resource.Name
+		}
+		if resource.External {
+			return volume
+		}
+	}
+	return p.Name + "_" + volume
+}
+
+func (p *composeProject) serviceNetworks(service string) []string {
+	networks := p.Services[service].Networks.Names
+	if len(networks) == 0 {
+		return []string{"default"}
+	}
+	return networks
+}
+
+/* volumeArg resolves the source of a short syntax volume: relative paths are
+ * relative to the compose file, named volumes belong to the project */
+func (p *composeProject) volumeArg(volume string) string {
+	parts := strings.SplitN(volume, ":", 2)
+	if len(parts) == 1 {
+		return volume
+	}
+
+	source := parts[0]
+	switch {
+	case strings.HasPrefix(source, "."):
+		source = filepath.Join(p.Dir, source)
+	case strings.HasPrefix(source, "~/"):
+		source = filepath.Join(os.Getenv("HOME"), source[2:])
+	case !strings.HasPrefix(source, "/"):
+		source = p.volumeName(source)
+	}
+	return source + ":" + parts[1]
+}
+
+/* healthArgs turns a compose healthcheck into docker run flags */
+func healthArgs(health *composeHealthcheck) []string {
+	if health == nil {
+		return nil
+	}
+
+	if health.Disable || (len(health.Test) > 0 && health.Test[0] == "NONE") {
+		return []string{"--no-healthcheck"}
+	}
+
+	args := []string{}
+	if len(health.Test) > 0 {
+		command := strings.Join(health.Test, " ")
+		switch health.Test[0] {
+		case "CMD-SHELL":
+			command = strings.Join(health.Test[1:], " ")
+		case "CMD":
+			command = quoteArgs(health.Test[1:])
+		}
+		args = append(args, "--health-cmd", command)
+	}
+	if len(health.Interval) > 0 {
+		args = append(args, "--health-interval", health.Interval)
+	}
+	if len(health.Timeout) > 0 {
+		args = append(args, "--health-timeout", health.Timeout)
+	}
+	if health.Retries > 0 {
+		args = append(args, "--health-retries", strconv.Itoa(health.Retries))
+	}
+	if len(health.StartPeriod) > 0 {
+		args = append(args, "--health-start-period", health.StartPeriod)
+	}
+	return args
+}
+
+/* runArgs are the docker run arguments of a service.  Only its first network
+ * is given here, the others are connected before it starts. */
+func (p *composeProject) runArgs(service string) []string {
+	s := p.Services[service]
+	args := []string{"--name", p.containerName(service)}
+
+	args = append(args, "--label", LABEL_COMPOSE_PROJECT+"="+p.Name)
+	args = append(args, "--label", LABEL_COMPOSE_SERVICE+"="+service)
+	args = append(args, unitLabels(p.c)...)
+	for _, label := range s.Labels {
+		args = append(args, "--label", label)
+	}
+
+	network := p.serviceNetworks(service)[0]
+	args = append(args, "--network", p.networkName(network), "--network-alias", service)
+	for _, alias := range s.Networks.Aliases[network] {
+		args = append(args, "--network-alias", alias)
+	}
+
+	for _, env := range s.Environment {
+		args = append(args, "-e", env)
+	}
+	for _, file := range s.EnvFile {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(p.Dir, file)
+		}
+		args = append(args, "--env-file", file)
+	}
+	for _, port := range s.Ports {
+		args = append(args, "-p", port)
+	}
+	for _, volume := range s.Volumes {
+		args = append(args, "-v", p.volumeArg(volume))
+	}
+
+	for _, flag := range []struct {
+		name   string
+		values []string
+	}{
+		{"--cap-add", s.CapAdd},
+		{"--cap-drop", s.CapDrop},
+		{"--device", s.Devices},
+		{"--add-host", s.ExtraHosts},
+		{"--dns", s.Dns},
+		{"--tmpfs", s.Tmpfs},
+	} {
+		for _, value := range flag.values {
+			args = append(args, flag.name, value)
+		}
+	}
+
+	for _, flag := range []struct {
+		name  string
+		value string
+	}{
+		{"--user", s.User},
+		{"--workdir", s.WorkingDir},
+		{"--hostname", s.Hostname},
+		{"--stop-signal", s.StopSignal},
+	} {
+		if len(flag.value) > 0 {
+			args = append(args, flag.name, flag.value)
+		}
+	}
+
+	if timeout, err := time.ParseDuration(s.StopGracePeriod); err == nil {
+		args = append(args, "--stop-timeout", strconv.Itoa(int(timeout.Seconds())))
+	}
+
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"--privileged", s.Privileged},
+		{"--read-only", s.ReadOnly},
+		{"--init", s.Init},
+		{"--tty", s.Tty},
+		{"--interactive", s.StdinOpen},
+	} {
+		if flag.set {
+			args = append(args, flag.name)
+		}
+	}
+
+	args = append(args, healthArgs(s.Healthcheck)...)
+
+	command := []string{}
+	if s.Entrypoint != nil {
+		/* docker run only takes the program as --entrypoint, its arguments
+		 * go in front of the command */
+		entrypoint := *s.Entrypoint
+		if len(entrypoint) == 0 {
+			args = append(args, "--entrypoint", "")
+		} else {
+			args = append(args, "--entrypoint", entrypoint[0])
+			command = append(command, entrypoint[1:]...)
+		}
+	}
+	if s.Command != nil {
+		command = append(command, *s.Command...)
+	}
+
+	args = append(args, s.Image)
+	return append(args, command...)
+}
+
+func (p *composeProject) docker(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Env = append(os.Environ(), "DOCKER_HOST="+dockerHost())
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+/* usedNetworks are the networks services of the project are on */
+func (p *composeProject) usedNetworks() []string {
+	used := map[string]bool{}
+	for _, service := range p.Order {
+		for _, network := range p.serviceNetworks(service) {
+			used[network] = true
+		}
+	}
+
+	networks := []string{}
+	for network := range used {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+/* createResources creates the project's networks and volumes, external ones
+ * have to exist already */
+func (p *composeProject) createResources() error {
+	for _, network := range p.usedNetworks() {
+		resource := p.Networks[network]
+		name := p.networkName(network)
+		if resource != nil && resource.External {
+			continue
+		}
+
+		if p.docker(rootContext(p.c), "network", "inspect", name) == nil {
+			continue
+		}
+
+		args := []string{"network", "create", "--label", LABEL_COMPOSE_PROJECT + "=" + p.Name, "--label", LABEL_COMPOSE_NETWORK + "=" + network}
+		if resource != nil && len(resource.Driver) > 0 {
+			args = append(args, "--driver", resource.Driver)
+		}
+
+		err := p.docker(rootContext(p.c), append(args, name)...)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to create network %s: %s", name, err))
+		}
+		p.networks = append(p.networks, name)
+	}
+
+	volumes := []string{}
+	for volume := range p.Volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+
+	for _, volume := range volumes {
+		resource := p.Volumes[volume]
+		if resource != nil && resource.External {
+			continue
+		}
+
+		/* docker volume create keeps an existing volume */
+		args := []string{"volume", "create", "--label", LABEL_COMPOSE_PROJECT + "=" + p.Name, "--label", LABEL_COMPOSE_VOLUME + "=" + volume}
+		if resource != nil && len(resource.Driver) > 0 {
+			args = append(args, "--driver", resource.Driver)
+		}
+
+		err := p.docker(rootContext(p.c), append(args, p.volumeName(volume))...)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to create volume %s: %s", p.volumeName(volume), err))
+		}
+	}
+
+	return nil
+}
+
+/* serviceState reports whether a service's container runs, and is healthy
+ * if it has a healthcheck */
+func (p *composeProject) serviceState(service string) (*dockerContainer.InspectResponse, bool, error) {
+	sc := p.containers[service]
+	client, err := getClient(sc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	container, err := inspectContainer(sc, client, sc.Id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	status := dockerx.HealthStatus(container)
+	return container, container.State.Running && (status == "" || status == "healthy"), nil
+}
+
+/* waitFor blocks until a dependency meets its depends_on condition */
+func (p *composeProject) waitFor(service, dependency, condition string) error {
+	if condition == DEPENDS_COMPLETED {
+		rt, err := getRuntime(p.containers[dependency])
+		if err != nil {
+			return err
+		}
+
+		code, err := rt.Wait(rootContext(p.c), p.containers[dependency].Id)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return errors.New(fmt.Sprintf("Service %s needed by %s exited with code %d", dependency, service, code))
+		}
+		return nil
+	}
+
+	for {
+		container, ready, err := p.serviceState(dependency)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case condition == DEPENDS_STARTED:
+			return nil
+		case condition == DEPENDS_HEALTHY && ready:
+			return nil
+		case condition == DEPENDS_HEALTHY && !container.State.Running:
+			return errors.New(fmt.Sprintf("Service %s needed by %s exited with code %d", dependency, service, container.State.ExitCode))
+		}
+
+		if cancelled(p.c) {
+			return rootContext(p.c).Err()
+		}
+		time.Sleep(pollInterval(p.c))
+	}
+}
+
+/* completed tells whether a service is expected to exit, because another one
+ * waits for it to complete */
+func (p *composeProject) completed(service string) bool {
+	for _, s := range p.Services {
+		if s.DependsOn[service] == DEPENDS_COMPLETED {
+			return true
+		}
+	}
+	return false
+}
+
+/* prefixWriter prefixes each line with the service, like docker compose up.
+ * With afterLevel the prefix goes after a <N> syslog level the line starts
+ * with, so journald still sees it. */
+type prefixWriter struct {
+	out        io.Writer
+	prefix     string
+	lock       *sync.Mutex
+	buf        []byte
+	afterLevel bool
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := strings.IndexByte(string(w.buf), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		line := append([]byte(w.prefix), w.buf[:i+1]...)
+		if level := levelPrefix.Find(w.buf[:i+1]); w.afterLevel && level != nil {
+			line = append(append(append([]byte{}, level...), w.prefix...), w.buf[len(level):i+1]...)
+		}
+
+		w.lock.Lock()
+		_, err := w.out.Write(line)
+		w.lock.Unlock()
+		w.buf = w.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (p *composeProject) startService(service string) error {
+	for dependency, condition := range p.Services[service].DependsOn {
+		err := p.waitFor(service, dependency, condition)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(p.Services[service].Restart) > 0 && p.Services[service].Restart != "no" {
+		logWarn(fmt.Sprintf("Ignoring restart: %s of service %s, restart the unit with Restart= instead", p.Services[service].Restart, service))
+	}
+
+	sc := &Context{
+		Args:         p.runArgs(service),
+		Client:       p.c.Client,
+		Ctx:          p.c.Ctx,
+		ApiTimeout:   p.c.ApiTimeout,
+		PollInterval: p.c.PollInterval,
+		LogLevel:     -1,
+		StderrLevel:  p.c.StderrLevel,
+	}
+	p.containers[service] = sc
+
+	client, err := getClient(sc)
+	if err != nil {
+		return err
+	}
+
+	/* A container a crashed run of the unit left behind */
+	ctx, cancel := apiContext(sc)
+	err = client.ContainerRemove(ctx, p.containerName(service), dockerContainer.RemoveOptions{Force: true})
+	cancel()
+	if err != nil && !dockerx.IsNotFound(err) {
+		return err
+	}
+
+	logInfo(fmt.Sprintf("Creating service %s", service))
+	err = createContainer(sc)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to create service %s: %s", service, err))
+	}
+
+	networks := p.serviceNetworks(service)
+	for _, network := range networks[1:] {
+		args := []string{"network", "connect", "--alias", service}
+		for _, alias := range p.Services[service].Networks.Aliases[network] {
+			args = append(args, "--alias", alias)
+		}
+		err = p.docker(rootContext(p.c), append(args, p.networkName(network), sc.Id)...)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to connect service %s to %s: %s", service, network, err))
+		}
+	}
+
+	ctx, cancel = apiContext(sc)
+	err = client.ContainerStart(ctx, sc.Id, dockerContainer.StartOptions{})
+	cancel()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to start service %s: %s", service, err))
+	}
+
+	if p.c.Logs {
+		stdout, stderr := logWriters(sc)
+		prefix := service + " | "
+		go streamLogs(sc, time.Time{}, &prefixWriter{out: stdout, prefix: prefix, lock: &p.logs}, &prefixWriter{out: stderr, prefix: prefix, lock: &p.logs})
+	}
+
+	return nil
+}
+
+/* waitReady returns once every service that is meant to keep running runs
+ * and is healthy */
+func (p *composeProject) waitReady() error {
+	for {
+		ready := true
+		for _, service := range p.Order {
+			container, serviceReady, err := p.serviceState(service)
+			if err != nil {
+				return err
+			}
+			if !container.State.Running && !p.completed(service) {
+				return errors.New(fmt.Sprintf("Service %s exited with code %d", service, container.State.ExitCode))
+			}
+			ready = ready && (serviceReady || p.completed(service))
+		}
+
+		if ready {
+			return nil
+		}
+
+		if cancelled(p.c) {
+			return rootContext(p.c).Err()
+		}
+		time.Sleep(pollInterval(p.c))
+	}
+}
+
+/* watch returns when a service exits that isn't expected to, or on SIGTERM */
+func (p *composeProject) watch() error {
+	for {
+		select {
+		case <-rootContext(p.c).Done():
+			return nil
+		case <-time.After(pollInterval(p.c)):
+		}
+
+		for _, service := range p.Order {
+			container, _, err := p.serviceState(service)
+			if err != nil {
+				return err
+			}
+
+			if !container.State.Running && !p.completed(service) {
+				return errors.New(fmt.Sprintf("Service %s exited with code %d", service, container.State.ExitCode))
+			}
+		}
+	}
+}
+
+/* down stops the services in reverse order, removes them and the networks we
+ * created.  Volumes are kept, like docker compose down does. */
+func (p *composeProject) down() {
+	sendNotify(p.c, "STOPPING=1")
+
+	for i := len(p.Order) - 1; i >= 0; i-- {
+		service := p.Order[i]
+		sc := p.containers[service]
+		if sc == nil || len(sc.Id) == 0 {
+			continue
+		}
+
+		client, err := getClient(sc)
+		if err != nil {
+			logWarn("Failed to stop service", service, err)
+			continue
+		}
+
+		var timeout *int
+		if grace, err := time.ParseDuration(p.Services[service].StopGracePeriod); err == nil {
+			seconds := int(grace.Seconds())
+			timeout = &seconds
+		}
+
+		logInfo(fmt.Sprintf("Stopping service %s", service))
+		ctx, cancel := cleanupContext(sc, 5*time.Minute)
+		err = client.ContainerStop(ctx, sc.Id, dockerContainer.StopOptions{Timeout: timeout})
+		if err != nil && !dockerx.IsNotFound(err) {
+			logWarn("Failed to stop service", service, err)
+		}
+		err = client.ContainerRemove(ctx, sc.Id, dockerContainer.RemoveOptions{Force: true})
+		if err != nil && !dockerx.IsNotFound(err) {
+			logWarn("Failed to remove service", service, err)
+		}
+		cancel()
+	}
+
+	for _, network := range p.networks {
+		ctx, cancel := cleanupContext(p.c, 0)
+		err := p.docker(ctx, "network", "rm", network)
+		cancel()
+		if err != nil {
+			logWarn("Failed to remove network", network, err)
+		}
+	}
+}
+
+/* stopOnSignal cancels everything in flight on SIGTERM, up then tears the
+ * project down */
+func (p *composeProject) stopOnSignal() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.c.Ctx = ctx
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig, ok := <-signals
+		if ok {
+			logInfo("Got", sig, "stopping project", p.Name)
+			cancel()
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+func (p *composeProject) up() error {
+	defer p.stopOnSignal()()
+	defer p.down()
+
+	err := p.createResources()
+	if err != nil {
+		return err
+	}
+
+	sendNotify(p.c, "STATUS=Pulling images")
+	err = p.pullImages()
+	if err != nil {
+		if cancelled(p.c) {
+			return nil
+		}
+		return err
+	}
+
+	for _, service := range p.Order {
+		sendNotify(p.c, fmt.Sprintf("STATUS=Starting service %s", service))
+		err = p.startService(service)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.waitReady()
+	if err != nil {
+		if cancelled(p.c) {
+			return nil
+		}
+		return err
+	}
+
+	sendNotify(p.c, fmt.Sprintf("MAINPID=%d\nREADY=1\nSTATUS=%d services running", os.Getpid(), len(p.Order)))
+	logInfo(fmt.Sprintf("Project %s is up", p.Name))
+
+	return p.watch()
+}
+
+func parseCompose(args []string) (*composeProject, error) {
+	c := &Context{
+		Logs:        true,
+		StderrLevel: -1,
+	}
+	var file, name, stderrLevel, policy string
+	var pulls int
+
+	flags := flag.NewFlagSet("systemd-docker compose", flag.ContinueOnError)
+	flags.StringVarP(&file, "file", "f", "docker-compose.yml", "compose file of the stack")
+	flags.StringVarP(&name, "project-name", "p", "", "project name, by default the compose file's name: or its directory")
+	flags.BoolVarP(&c.Logs, "logs", "l", true, "pipe the logs of all services")
+	flags.DurationVar(&c.PollInterval, "poll-interval", INTERVAL*time.Millisecond, "how often to poll the state of the services")
+	flags.DurationVar(&c.ApiTimeout, "api-timeout", 30*time.Second, "timeout of each docker api call, 0 waits forever")
+	flags.StringVar(&stderrLevel, "stderr-level", "err", "syslog level of service stderr lines without a level of their own, empty to leave them alone")
+	flags.StringVar(&policy, "image-policy", IMAGE_POLICY_FILE, "policy file restricting the images services may run, used if it exists")
+	flags.IntVar(&pulls, "pull-parallel", DEFAULT_PULL_PARALLEL, "how many missing images to pull at once")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() != 1 || flags.Arg(0) != "up" {
+		return nil, errors.New("Expected systemd-docker compose [-f file] up")
+	}
+
+	if len(stderrLevel) > 0 {
+		c.StderrLevel, err = parseLogLevel(stderrLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.NotifySocket = os.Getenv("NOTIFY_SOCKET")
+
+	p, err := loadCompose(file, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkImagePolicy(policy, p.serviceImages()...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.c = c
+	p.containers = map[string]*Context{}
+	p.pulls = pulls
+	return p, nil
+}
+
+func composeMain(args []string) error {
+	p, err := parseCompose(args)
+	if err != nil {
+		return err
+	}
+
+	_, err = getClient(p.c)
+	if err != nil {
+		return err
+	}
+
+	return p.up()
+}
@@ -0,0 +1,169 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const testCompose = `
+version: "3.8"
+services:
+  web:
+    image: nginx:1.25
+    command: nginx -g "daemon off;"
+    ports:
+      - 8080:80
+    volumes:
+      - ./html:/usr/share/nginx/html:ro
+      - cache:/var/cache/nginx
+    environment:
+      MODE: production
+      TOKEN:
+    networks:
+      front:
+      back:
+        aliases: [www]
+    depends_on:
+      db:
+        condition: service_healthy
+      migrate:
+        condition: service_completed_successfully
+  db:
+    image: postgres:16
+    networks: [back]
+    healthcheck:
+      test: ["CMD", "pg_isready", "-U", "app db"]
+      interval: 5s
+      retries: 3
+  migrate:
+    image: app:1
+    entrypoint: ["/bin/migrate", "--up"]
+    depends_on: [db]
+    networks: [back]
+networks:
+  front:
+  back:
+    external: true
+volumes:
+  cache:
+`
+
+func loadTestCompose(t *testing.T, content string) (*composeProject, error) {
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	dir = path.Join(dir, "My App")
+	os.Mkdir(dir, 0755)
+	file := path.Join(dir, "docker-compose.yml")
+	err = ioutil.WriteFile(file, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := loadCompose(file, "")
+	if p != nil {
+		p.c = &Context{}
+	}
+	return p, err
+}
+
+func TestLoadCompose(t *testing.T) {
+	p, err := loadTestCompose(t, testCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "myapp" {
+		t.Fatal("Bad project name", p.Name)
+	}
+
+	if strings.Join(p.Order, " ") != "db migrate web" {
+		t.Fatal("Bad order", p.Order)
+	}
+
+	if !p.completed("migrate") || p.completed("db") {
+		t.Fatal("Only migrate should be expected to complete")
+	}
+
+	if strings.Join(p.usedNetworks(), " ") != "back front" {
+		t.Fatal("Bad networks", p.usedNetworks())
+	}
+}
+
+func TestComposeRunArgs(t *testing.T) {
+	p, err := loadTestCompose(t, testCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := quoteArgs(p.runArgs("web"))
+	for _, expected := range []string{
+		"--name myapp-web",
+		"--label com.docker.compose.service=web",
+		"--network myapp_front --network-alias web",
+		"-e MODE=production -e TOKEN",
+		"-p 8080:80",
+		"-v " + quoteArgs([]string{p.Dir + "/html:/usr/share/nginx/html:ro"}),
+		"-v myapp_cache:/var/cache/nginx",
+		"nginx:1.25 nginx -g \"daemon off;\"",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Fatal("Expected", expected, "in", args)
+		}
+	}
+
+	args = quoteArgs(p.runArgs("db"))
+	if !strings.Contains(args, "--network back --network-alias db") {
+		t.Fatal("External network should keep its name", args)
+	}
+	if !strings.Contains(args, `--health-cmd "pg_isready -U \"app db\"" --health-interval 5s --health-retries 3`) {
+		t.Fatal("Bad healthcheck", args)
+	}
+
+	args = quoteArgs(p.runArgs("migrate"))
+	if !strings.HasSuffix(args, "--entrypoint /bin/migrate app:1 --up") {
+		t.Fatal("Bad entrypoint", args)
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	for content, expected := range map[string]string{
+		"services:\n  a:\n    image: x\n    depends_on: [b]\n  b:\n    image: x\n    depends_on: [a]\n": "Dependency cycle",
+		"services:\n  a:\n    image: x\n    depends_on: [c]\n":                                          "unknown service c",
+		"services:\n  a:\n    build: .\n":                                                               "not found in type",
+		"services:\n  a:\n    image: x\n    networks: [nope]\n":                                         "undefined network nope",
+	} {
+		_, err := loadTestCompose(t, content)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatal("Expected", expected, "got", err)
+		}
+	}
+}
+
+func TestShellSplit(t *testing.T) {
+	words, err := shellSplit(`sh -c 'echo "hi"' a\ b ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(words, "|") != `sh|-c|echo "hi"|a b|` {
+		t.Fatal("Bad split", words)
+	}
+
+	_, err = shellSplit(`echo "oops`)
+	if err == nil {
+		t.Fatal("Expected an unterminated quote to fail")
+	}
+}
+
+func TestParseCompose(t *testing.T) {
+	_, err := parseCompose([]string{"-f", "/nonexistent.yml", "down"})
+	if err == nil || !strings.Contains(err.Error(), "up") {
+		t.Fatal("Expected only up to be supported", err)
+	}
+}
@@ -0,0 +1,123 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* Left alone docker create pulls a missing image for each service in turn,
+ * on a cold boot of a stack with several images that adds up.  Missing images
+ * are pulled up front instead, --pull-parallel at a time. */
+
+const DEFAULT_PULL_PARALLEL = 3
+
+/* serviceImages are the distinct images the services of the project use */
+func (p *composeProject) serviceImages() []string {
+	seen := map[string]bool{}
+	images := []string{}
+	for _, service := range p.Order {
+		image := p.Services[service].Image
+		if len(image) == 0 || seen[image] {
+			continue
+		}
+		seen[image] = true
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+/* pullMissing pulls ref unless the daemon has it already */
+func pullMissing(c *Context, client dockerx.API, ref string) error {
+	image, err := localImage(c, client, ref)
+	if err != nil {
+		return err
+	}
+	if image != nil {
+		return nil
+	}
+
+	err = pullImage(c, client, ref)
+	if err != nil {
+		pullFailed(c, ref, err)
+		return withExitCode(EXIT_PULL_FAILED, errors.New(fmt.Sprintf("Failed to pull %s: %s", ref, err)))
+	}
+
+	image, err = localImage(c, client, ref)
+	if err != nil {
+		return err
+	}
+	if image == nil {
+		return errors.New(fmt.Sprintf("Image %s is missing after pulling it", ref))
+	}
+
+	logInfo(fmt.Sprintf("Pulled %s, %s", ref, shortImageId(image.ID)))
+	return nil
+}
+
+/* pullImages pulls the missing images of all services with a bounded pool
+ * of workers.  The first failure cancels the pulls still running. */
+func (p *composeProject) pullImages() error {
+	images := p.serviceImages()
+	workers := p.pulls
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(images) {
+		workers = len(images)
+	}
+
+	ctx, cancel := context.WithCancel(rootContext(p.c))
+	defer cancel()
+
+	pc := &Context{
+		Client:       p.c.Client,
+		Ctx:          ctx,
+		ApiTimeout:   p.c.ApiTimeout,
+		NotifySocket: p.c.NotifySocket,
+	}
+	client, err := getClient(pc)
+	if err != nil {
+		return err
+	}
+
+	var lock sync.Mutex
+	var failed error
+	var wg sync.WaitGroup
+
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ref := range queue {
+				if cancelled(pc) {
+					continue
+				}
+
+				err := pullMissing(pc, client, ref)
+				if err != nil {
+					lock.Lock()
+					if failed == nil {
+						failed = err
+						cancel()
+					}
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, ref := range images {
+		queue <- ref
+	}
+	close(queue)
+	wg.Wait()
+
+	return failed
+}
@@ -0,0 +1,129 @@
+package supervisor
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/* parallelPullServer has no images until they are pulled and records how
+ * many pulls ran at once */
+func parallelPullServer(t *testing.T, fail string) (*fakeDaemon, func() int) {
+	var lock sync.Mutex
+	present := map[string]bool{}
+	running, most := 0, 0
+
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			ref := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+			lock.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			lock.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+
+			lock.Lock()
+			running--
+			present[ref] = true
+			lock.Unlock()
+
+			if strings.Contains(ref, fail) {
+				w.Write([]byte(`{"error": "manifest unknown"}`))
+				return
+			}
+			w.Write([]byte(`{"status": "Downloaded newer image"}`))
+		case strings.Contains(r.URL.Path, "/images/") && strings.HasSuffix(r.URL.Path, "/json"):
+			ref := strings.TrimSuffix(strings.SplitN(r.URL.Path, "/images/", 2)[1], "/json")
+			lock.Lock()
+			found := present["docker.io/library/"+ref]
+			lock.Unlock()
+			if !found && !strings.HasPrefix(ref, "local") {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"Id": "sha256:0123456789abcdef"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	return daemon, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return most
+	}
+}
+
+const testPullCompose = `
+services:
+  a:
+    image: alpine:1
+  b:
+    image: alpine:2
+  c:
+    image: alpine:3
+  d:
+    image: alpine:1
+  e:
+    image: local:1
+`
+
+func TestServiceImages(t *testing.T) {
+	p, err := loadTestCompose(t, testPullCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := strings.Join(p.serviceImages(), " ")
+	if images != "alpine:1 alpine:2 alpine:3 local:1" {
+		t.Fatal("Bad images", images)
+	}
+}
+
+func TestPullImages(t *testing.T) {
+	p, err := loadTestCompose(t, testPullCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	daemon, most := parallelPullServer(t, "nothing")
+	p.c.Client = daemon.Client
+	p.pulls = 2
+
+	err = p.pullImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pulls := pulled(daemon)
+	sort.Strings(pulls)
+	if strings.Join(pulls, " ") != "docker.io/library/alpine:1 docker.io/library/alpine:2 docker.io/library/alpine:3" {
+		t.Fatal("Expected each missing image to be pulled once, got", pulls)
+	}
+	if most() != 2 {
+		t.Fatal("Expected two pulls at once, got", most())
+	}
+}
+
+func TestPullImagesFailure(t *testing.T) {
+	p, err := loadTestCompose(t, testPullCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	daemon, _ := parallelPullServer(t, "alpine:2")
+	p.c.Client = daemon.Client
+	p.pulls = 1
+
+	err = p.pullImages()
+	if err == nil || !strings.Contains(err.Error(), "alpine:2") {
+		t.Fatal("Expected the failed pull to be reported", err)
+	}
+}
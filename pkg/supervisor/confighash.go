@@ -0,0 +1,67 @@
+package supervisor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* The run arguments are hashed into a label, a named container left from an
+ * earlier start whose unit was edited since is recreated instead of started
+ * again with its old configuration */
+
+const LABEL_CONFIG = "io.systemd-docker.config"
+
+/* configHash normalizes the flags, -e X and --env=X hash the same, but keeps
+ * their order since later flags can win over earlier ones */
+func configHash(args []string) string {
+	flags, image := parseRunArgs(args)
+
+	normalized := []string{}
+	for _, f := range flags {
+		normalized = append(normalized, "--"+f.Name+"="+f.Value)
+	}
+	if image < len(args) {
+		normalized = append(normalized, args[image:]...)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(normalized, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func configLabels(c *Context) []string {
+	if len(c.ConfigHash) == 0 {
+		return nil
+	}
+	return []string{"--label", LABEL_CONFIG + "=" + c.ConfigHash}
+}
+
+/* configChanged is whether container was created from other arguments.
+ * Containers from before the label are left alone. */
+func configChanged(c *Context, container *dockerContainer.InspectResponse) bool {
+	if !c.Recreate || len(c.ConfigHash) == 0 || container.Config == nil {
+		return false
+	}
+
+	hash, ok := container.Config.Labels[LABEL_CONFIG]
+	return ok && hash != c.ConfigHash
+}
+
+/* recreateChanged removes a container whose configuration changed, so a new
+ * one is created in its place */
+func recreateChanged(c *Context, client dockerx.API, container *dockerContainer.InspectResponse) (bool, error) {
+	if !configChanged(c, container) {
+		return false, nil
+	}
+
+	logInfo(fmt.Sprintf("Run arguments of container %s changed, recreating it", shortId(container.ID)))
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	return true, client.ContainerRemove(ctx, container.ID, dockerContainer.RemoveOptions{Force: true})
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConfigHash(t *testing.T) {
+	hash := configHash([]string{"-e", "A=1", "--name", "web", "nginx", "-g", "daemon off;"})
+	if hash != configHash([]string{"--env=A=1", "--name=web", "nginx", "-g", "daemon off;"}) {
+		t.Fatal("Same arguments hash differently")
+	}
+
+	if hash == configHash([]string{"-e", "A=2", "--name", "web", "nginx", "-g", "daemon off;"}) {
+		t.Fatal("Changed env hashes the same")
+	}
+
+	if hash == configHash([]string{"-e", "A=1", "--name", "web", "nginx"}) {
+		t.Fatal("Changed command hashes the same")
+	}
+}
+
+func TestParseConfigHash(t *testing.T) {
+	c, err := Parse([]string{"run", "--name", "web", "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(c.Args, " "), "--label "+LABEL_CONFIG+"="+c.ConfigHash) {
+		t.Fatal("Missing config label", c.Args)
+	}
+
+	/* The invocation changes on every start */
+	t.Setenv("INVOCATION_ID", "123")
+	again, err := Parse([]string{"run", "--name", "web", "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ConfigHash != c.ConfigHash {
+		t.Fatal("Hash changed with the invocation")
+	}
+}
+
+func namedContainerServer(t *testing.T, labels string) (*Context, *fakeDaemon) {
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"Id": "abc", "State": {"Running": true, "Pid": 42}, "Config": {"Labels": ` + labels + `}}`))
+		}
+	})
+	return &Context{Name: "web", Client: daemon.Client, Recreate: true, ConfigHash: "new"}, daemon
+}
+
+func TestRecreateChanged(t *testing.T) {
+	c, daemon := namedContainerServer(t, `{"`+LABEL_CONFIG+`": "old"}`)
+
+	err := lookupNamedContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := daemon.requests()
+	if len(c.Id) > 0 || requests[len(requests)-1] != "DELETE /v1.41/containers/abc" {
+		t.Fatal("Changed container not removed", c.Id, requests)
+	}
+}
+
+func TestRecreateUnchanged(t *testing.T) {
+	for _, labels := range []string{`{"` + LABEL_CONFIG + `": "new"}`, `{}`} {
+		c, daemon := namedContainerServer(t, labels)
+
+		err := lookupNamedContainer(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Id != "abc" {
+			t.Fatal("Container not adopted with labels", labels, daemon.requests())
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+	"github.com/oott123/systemd-docker/pkg/runtime"
+	flag "github.com/spf13/pflag"
+)
+
+/* systemd-docker conformance exercises this host's daemon, cgroup setup and
+ * security options against our features and prints what is safe to use */
+
+const (
+	checkOk   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+type checkResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+/* checkReport collects the results of conformance and check */
+type checkReport struct {
+	Results []checkResult
+}
+
+func (s *checkReport) add(name, status, detail string) {
+	s.Results = append(s.Results, checkResult{name, status, detail})
+}
+
+func (s *checkReport) failed() bool {
+	for _, result := range s.Results {
+		if result.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *checkReport) print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, result := range s.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Name, result.Status, result.Detail)
+	}
+	w.Flush()
+}
+
+type conformance struct {
+	checkReport
+	Image string
+	/* Tests swap in a mock daemon, nil is the real one */
+	Client  dockerx.API
+	Runtime runtime.ContainerRuntime
+	info    map[string]bool
+	/* Stands in for systemd's, so readiness is waited for like in a unit */
+	notifySocket string
+}
+
+/* exitCase is a row of the exit status matrix, running the image with run
+ * and cmd has to make Main exit with code or die from signal.  Every case
+ * runs with --rm, only then do we stay around for the exit. */
+type exitCase struct {
+	name   string
+	flags  []string
+	run    []string
+	cmd    []string
+	code   int
+	signal syscall.Signal
+}
+
+func (s *conformance) exitCases() []exitCase {
+	return []exitCase{
+		{"exit 0", nil, nil, []string{"sh", "-c", "sleep 1"}, 0, 0},
+		{"exit code", nil, nil, []string{"sh", "-c", "sleep 1; exit 3"}, EXIT_CONTAINER_FAILED, 0},
+		/* Signals to pid 1 without a handler are ignored, --init makes sh a child */
+		{"signal TERM", nil, []string{"--init"}, []string{"sh", "-c", "sleep 1; kill -TERM $$"}, 128 + int(syscall.SIGTERM), syscall.SIGTERM},
+		{"signal KILL", nil, []string{"--init"}, []string{"sh", "-c", "sleep 1; kill -KILL $$"}, 128 + int(syscall.SIGKILL), syscall.SIGKILL},
+		{"oom kill", nil, []string{"--memory", "16m", "--memory-swap", "16m"}, []string{"sh", "-c", "sleep 1; tail /dev/zero"}, EXIT_OOM_KILLED, 0},
+		{"start timeout", []string{"--start-timeout", "1s", "--wait-device", "1m"}, []string{"--device", "/dev/systemd-docker-conformance"}, []string{"true"}, EXIT_START_TIMEOUT, 0},
+		{"not ready", []string{"--ready-http", "http://127.0.0.1:1/", "--ready-http-interval", "100ms"}, nil, []string{"sleep", "1"}, EXIT_NOT_READY, 0},
+	}
+}
+
+func cgroupVersion() string {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		return "v2"
+	}
+	return "v1"
+}
+
+func (s *conformance) checkDaemon() bool {
+	c := &Context{Client: s.Client, ApiTimeout: 30 * time.Second}
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	client, err := getClient(c)
+	if err == nil {
+		_, err = client.Ping(ctx)
+	}
+	if err != nil {
+		s.add("daemon", checkFail, err.Error())
+		return false
+	}
+
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		s.add("daemon", checkFail, err.Error())
+		return false
+	}
+	s.add("daemon", checkOk, fmt.Sprintf("docker %s, api %s", version.Version, version.APIVersion))
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		s.add("daemon info", checkFail, err.Error())
+		return false
+	}
+
+	s.add("cgroups", checkOk, fmt.Sprintf("%s, %s driver", cgroupVersion(), info.CgroupDriver))
+
+	s.info = map[string]bool{}
+	for _, opt := range info.SecurityOptions {
+		for _, name := range []string{"selinux", "rootless", "userns", "apparmor"} {
+			if strings.Contains(opt, "name="+name) || opt == name {
+				s.info[name] = true
+			}
+		}
+	}
+
+	if s.info["selinux"] {
+		s.add("selinux", checkWarn, "enforcing labels, --notify socket mounts may be denied")
+	} else {
+		s.add("selinux", checkOk, "not enabled")
+	}
+
+	if s.info["rootless"] {
+		s.add("rootless", checkWarn, "--cgroup-parent and container processes in the unit's cgroup are not supported")
+	} else {
+		s.add("rootless", checkOk, "rootful daemon")
+	}
+
+	if s.info["userns"] {
+		s.add("userns-remap", checkWarn, "--notify socket may not be writable by the container user")
+	}
+
+	if info.LoggingDriver == "journald" {
+		s.add("log driver", checkWarn, "journald, --logs duplicates every line in the journal")
+	} else {
+		s.add("log driver", checkOk, info.LoggingDriver)
+	}
+
+	return true
+}
+
+/* run is Run with our daemon and notification socket */
+func (s *conformance) run(args []string) (*Context, error) {
+	c, err := Parse(args)
+	if err != nil {
+		return c, err
+	}
+
+	c.Client = s.Client
+	c.Runtime = s.Runtime
+	c.NotifySocket = s.notifySocket
+	return supervise(c, time.Now())
+}
+
+/* remove takes away the containers a check created, by id and by name in
+ * case it never learned the id */
+func (s *conformance) remove(targets ...string) {
+	c := &Context{Client: s.Client, Runtime: s.Runtime, ApiTimeout: 30 * time.Second}
+	rt, err := getRuntime(c)
+	if err != nil {
+		s.add("cleanup", checkWarn, err.Error())
+		return
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	for _, target := range targets {
+		if len(target) == 0 {
+			continue
+		}
+		err := rt.Remove(ctx, target, true)
+		if err != nil && !runtime.IsNotFound(err) {
+			s.add("cleanup", checkWarn, fmt.Sprintf("failed to remove %s: %s", target, err))
+		}
+	}
+}
+
+func contextId(c *Context) string {
+	if c == nil {
+		return ""
+	}
+	return c.Id
+}
+
+func (s *conformance) containerName(check string) string {
+	return fmt.Sprintf("systemd-docker-conformance-%d-%s", os.Getpid(), strings.ReplaceAll(check, " ", "-"))
+}
+
+/* checkExits runs every case of the matrix end to end and compares what
+ * Main would exit with */
+func (s *conformance) checkExits() {
+	for _, test := range s.exitCases() {
+		if len(s.notifySocket) == 0 && test.code == EXIT_NOT_READY {
+			s.add(test.name, checkSkip, "no notification socket to wait for readiness with")
+			continue
+		}
+
+		name := s.containerName(test.name)
+		args := append(append([]string{}, test.flags...), "--logs=false", "run", "--rm", "--name", name)
+		args = append(append(append(args, test.run...), s.Image), test.cmd...)
+
+		c, err := s.run(args)
+		code, sig := runExitStatus(c, err)
+		s.remove(contextId(c), name)
+
+		if code == test.code && sig == test.signal {
+			s.add(test.name, checkOk, fmt.Sprintf("exit %d", code))
+			continue
+		}
+
+		detail := fmt.Sprintf("expected exit %d got %d", test.code, code)
+		if test.signal != 0 || sig != 0 {
+			detail = fmt.Sprintf("expected exit %d and signal %d got %d and %d", test.code, test.signal, code, sig)
+		}
+		if err != nil {
+			detail += ": " + err.Error()
+		}
+		s.add(test.name, checkFail, detail)
+	}
+}
+
+func (s *conformance) checkNamed() {
+	name := s.containerName("named")
+	args := []string{"--logs=false", "run", "--name", name, s.Image, "sleep", "30"}
+
+	first, err := s.run(args)
+	if err != nil {
+		s.add("named re-attach", checkFail, err.Error())
+		s.remove(contextId(first), name)
+		return
+	}
+
+	/* Without --rm the first run leaves the container running, the second
+	 * has to adopt it */
+	second, err := s.run(args)
+	defer s.remove(first.Id, contextId(second), name)
+	if err != nil {
+		s.add("named re-attach", checkFail, err.Error())
+		return
+	}
+
+	if first.Id != second.Id || first.Pid != second.Pid {
+		s.add("named re-attach", checkFail, "a second container was started")
+		return
+	}
+	s.add("named re-attach", checkOk, "")
+
+	/* first's context ended with its run */
+	_, err = containerStats(&Context{Client: s.Client, Id: first.Id, ApiTimeout: 30 * time.Second})
+	if err != nil {
+		s.add("stats", checkFail, err.Error())
+	} else {
+		s.add("stats", checkOk, "")
+	}
+}
+
+/* listenNotify sets up our notification socket, it only drains what the
+ * checks send.  The returned func closes it. */
+func (s *conformance) listenNotify() (func(), error) {
+	dir, err := ioutil.TempDir("", "systemd-docker-conformance")
+	if err != nil {
+		return nil, err
+	}
+
+	socket := path.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			_, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	s.notifySocket = socket
+	return func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func conformanceMain(args []string) error {
+	s := &conformance{}
+
+	flags := flag.NewFlagSet("systemd-docker conformance", flag.ContinueOnError)
+	flags.StringVar(&s.Image, "image", "busybox", "image used for the checks, needs sh, sleep and tail")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	/* Never tell the unit we might be running in about the test containers */
+	os.Unsetenv("NOTIFY_SOCKET")
+
+	stop, err := s.listenNotify()
+	if err != nil {
+		s.add("notify socket", checkWarn, err.Error())
+	} else {
+		defer stop()
+	}
+
+	if s.checkDaemon() {
+		s.checkExits()
+		s.checkNamed()
+	} else {
+		s.add("containers", checkSkip, "daemon not reachable")
+	}
+
+	s.print(os.Stdout)
+
+	if s.failed() {
+		return errors.New("Some conformance checks failed")
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package supervisor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConformanceReport(t *testing.T) {
+	s := &conformance{}
+	s.add("daemon", checkOk, "docker 1.2.3")
+	s.add("selinux", checkWarn, "enforcing")
+
+	if s.failed() {
+		t.Fatal("should not have failed")
+	}
+
+	out := &bytes.Buffer{}
+	s.print(out)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "daemon") || !strings.Contains(lines[2], "warn") {
+		t.Fatal("Bad report", out.String())
+	}
+
+	s.add("stats", checkFail, "broken")
+	if !s.failed() {
+		t.Fatal("should have failed")
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* The mock does what the image would for each case of the matrix, in the
+ * order the checks create containers */
+func TestConformanceExitsMock(t *testing.T) {
+	m := runtime.NewMock()
+	m.Processes = true
+	s := &conformance{Image: "busybox", Client: mockDaemon(t, m), Runtime: m}
+
+	stop, err := s.listenNotify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		exitWhenRunning(m, "created-1", 0, 200*time.Millisecond)
+		exitWhenRunning(m, "created-2", 3, 200*time.Millisecond)
+		exitWhenRunning(m, "created-3", 143, 200*time.Millisecond)
+		exitWhenRunning(m, "created-4", 137, 200*time.Millisecond)
+		for {
+			container, err := m.Inspect(context.Background(), "created-5")
+			if err == nil && container.State.Running {
+				time.Sleep(200 * time.Millisecond)
+				m.OOMKill("created-5")
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		/* The start timeout never gets to create one, the container that
+		 * never gets ready exits while the probe fails */
+		exitWhenRunning(m, "created-6", 0, 300*time.Millisecond)
+	}()
+
+	s.checkExits()
+	<-done
+	/* created-7 keeps running until it is cleaned up */
+	s.checkNamed()
+
+	for _, result := range s.Results {
+		if result.Status != checkOk {
+			t.Error(result.Name, result.Status, result.Detail)
+		}
+	}
+	if len(s.Results) != len(s.exitCases())+2 {
+		t.Fatal("Expected a row per case, named re-attach and stats", s.Results)
+	}
+
+	for i := 1; i <= 7; i++ {
+		id := fmt.Sprintf("created-%d", i)
+		if _, err := m.Inspect(context.Background(), id); !runtime.IsNotFound(err) {
+			t.Error("Container was not cleaned up", id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+var envNameInvalid = regexp.MustCompile(`[^A-Z0-9_]`)
+
+func envName(parts ...string) string {
+	return envNameInvalid.ReplaceAllString(strings.ToUpper(strings.Join(parts, "_")), "_")
+}
+
+/* containerEnv describes where the container can be reached, for units that
+ * pull it in with EnvironmentFile= */
+func containerEnv(container *dockerContainer.InspectResponse) []string {
+	env := []string{
+		"CONTAINER_ID=" + container.ID,
+		"CONTAINER_NAME=" + strings.TrimPrefix(container.Name, "/"),
+	}
+
+	settings := container.NetworkSettings
+	if settings == nil {
+		return env
+	}
+
+	/* The default bridge wins, like the old top level IPAddress */
+	ip := ""
+	if bridge := settings.Networks["bridge"]; bridge != nil {
+		ip = bridge.IPAddress
+	}
+
+	networks := make([]string, 0, len(settings.Networks))
+	for name := range settings.Networks {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+
+	for _, name := range networks {
+		network := settings.Networks[name]
+		if network == nil || len(network.IPAddress) == 0 {
+			continue
+		}
+		if len(ip) == 0 {
+			ip = network.IPAddress
+		}
+		env = append(env, fmt.Sprintf("%s=%s", envName("CONTAINER_IP", name), network.IPAddress))
+	}
+
+	if len(ip) > 0 {
+		env = append(env, "CONTAINER_IP="+ip)
+	}
+
+	ports := []string{}
+	for port, bindings := range settings.Ports {
+		if len(bindings) == 0 {
+			continue
+		}
+		ports = append(ports, fmt.Sprintf("%s=%s:%s", envName("CONTAINER_PORT", port.Port(), port.Proto()), bindings[0].HostIP, bindings[0].HostPort))
+	}
+	sort.Strings(ports)
+
+	return append(env, ports...)
+}
+
+func writeContainerEnv(c *Context) error {
+	if len(c.ContainerEnvFile) == 0 || len(c.Id) == 0 {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.ContainerEnvFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, line := range containerEnv(container) {
+		fmt.Fprintln(buf, line)
+	}
+
+	return writeFileAtomic(c.ContainerEnvFile, buf.Bytes(), 0644)
+}
+
+func removeContainerEnv(c *Context) {
+	if len(c.ContainerEnvFile) == 0 {
+		return
+	}
+
+	os.Remove(c.ContainerEnvFile)
+}
@@ -0,0 +1,45 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerNetwork "github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestContainerEnv(t *testing.T) {
+	container := &dockerContainer.InspectResponse{
+		ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+			ID:   "abc",
+			Name: "/web.service",
+		},
+		NetworkSettings: &dockerContainer.NetworkSettings{
+			NetworkSettingsBase: dockerContainer.NetworkSettingsBase{
+				Ports: nat.PortMap{
+					"80/tcp":  {{HostIP: "0.0.0.0", HostPort: "8080"}},
+					"443/tcp": {},
+				},
+			},
+			Networks: map[string]*dockerNetwork.EndpointSettings{
+				"my-net": {IPAddress: "10.0.0.2"},
+				"bridge": {IPAddress: "172.17.0.2"},
+			},
+		},
+	}
+
+	env := strings.Join(containerEnv(container), "\n")
+	expected := strings.Join([]string{
+		"CONTAINER_ID=abc",
+		"CONTAINER_NAME=web.service",
+		"CONTAINER_IP_BRIDGE=172.17.0.2",
+		"CONTAINER_IP_MY_NET=10.0.0.2",
+		"CONTAINER_IP=172.17.0.2",
+		"CONTAINER_PORT_80_TCP=0.0.0.0:8080",
+	}, "\n")
+
+	if env != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, env)
+	}
+}
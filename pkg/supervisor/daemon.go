@@ -0,0 +1,405 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/generator"
+	flag "github.com/spf13/pflag"
+)
+
+/* systemd-docker daemon runs the containers of the .container files in a
+ * directory under one unit, for small hosts that don't want a unit per
+ * container.  Each container gets a systemd-docker of its own as our child,
+ * with a notify socket of ours, and is started again after it exits as the
+ * Restart= and RestartSec= of its file say. */
+
+const DAEMON_CONFIG_DIR = "/etc/systemd-docker/containers.d"
+
+const (
+	RESTART_NO         = "no"
+	RESTART_ALWAYS     = "always"
+	RESTART_ON_FAILURE = "on-failure"
+)
+
+type daemonChild struct {
+	*generator.Container
+	restartSec time.Duration
+	socket     string
+	conn       *net.UnixConn
+	cmd        *exec.Cmd
+	running    bool
+	up         bool
+	settled    bool
+
+	removed     bool
+	replacement *daemonChild
+}
+
+type daemonEvent struct {
+	child *daemonChild
+	ready bool
+	err   error
+}
+
+type daemon struct {
+	c          *Context
+	dir        string
+	binary     string
+	restartSec time.Duration
+	children   []*daemonChild
+	socketDir  string
+	ready      bool
+	stopping   bool
+	events     chan daemonEvent
+	done       chan struct{}
+	logs       sync.Mutex
+}
+
+/* childArgs names the container after its file unless it has a name */
+func childArgs(child *daemonChild) []string {
+	i := findRunArg(child.Args)
+	if i < 0 {
+		return child.Args
+	}
+
+	named := false
+	removeRunFlags(child.Args[i+1:], func(f runFlag) bool {
+		named = named || f.Name == "name"
+		return false
+	})
+	if named {
+		return child.Args
+	}
+
+	args := append([]string{}, child.Args[:i+1]...)
+	args = append(args, "--name", containerName(child.Name))
+	return append(args, child.Args[i+1:]...)
+}
+
+/* childEnv points NOTIFY_SOCKET at our socket for the child, the watchdog
+ * and socket activation are ours */
+func childEnv(socket string) []string {
+	env := []string{}
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "NOTIFY_SOCKET=") || strings.HasPrefix(e, "WATCHDOG_") || strings.HasPrefix(e, "LISTEN_") {
+			continue
+		}
+		env = append(env, e)
+	}
+	return append(env, "NOTIFY_SOCKET="+socket)
+}
+
+/* shouldRestart applies Restart= to an exit, err is nil for exit code 0 */
+func shouldRestart(policy string, err error) bool {
+	switch policy {
+	case RESTART_ALWAYS:
+		return true
+	case RESTART_NO:
+		return false
+	}
+	return err != nil
+}
+
+func (d *daemon) send(event daemonEvent) {
+	select {
+	case d.events <- event:
+	case <-d.done:
+	}
+}
+
+/* listen reads what the child tells systemd, only READY=1 matters to us */
+func (d *daemon) listen(child *daemonChild) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := child.conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line == "READY=1" {
+				d.send(daemonEvent{child: child, ready: true})
+			}
+		}
+	}
+}
+
+func (d *daemon) openSocket(child *daemonChild) error {
+	child.socket = path.Join(d.socketDir, child.Name)
+	os.Remove(child.socket)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: child.socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	/* With --notify the container writes to it, and may not run as root */
+	err = os.Chmod(child.socket, 0777)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	child.conn = conn
+	go d.listen(child)
+	return nil
+}
+
+func (d *daemon) start(child *daemonChild) {
+	logInfo("Starting container", child.Name)
+
+	cmd := exec.Command(d.binary, childArgs(child)...)
+	cmd.Env = childEnv(child.socket)
+	prefix := child.Name + " | "
+	cmd.Stdout = &prefixWriter{out: os.Stdout, prefix: prefix, lock: &d.logs, afterLevel: true}
+	cmd.Stderr = &prefixWriter{out: os.Stderr, prefix: prefix, lock: &d.logs, afterLevel: true}
+
+	child.cmd = cmd
+	child.running = true
+
+	err := cmd.Start()
+	if err != nil {
+		go d.send(daemonEvent{child: child, err: err})
+		return
+	}
+	go func() {
+		d.send(daemonEvent{child: child, err: cmd.Wait()})
+	}()
+}
+
+func (d *daemon) status() string {
+	up := 0
+	for _, child := range d.children {
+		if child.up {
+			up++
+		}
+	}
+	return fmt.Sprintf("STATUS=%d of %d containers up", up, len(d.children))
+}
+
+func (d *daemon) settled() bool {
+	for _, child := range d.children {
+		if !child.settled {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *daemon) run() error {
+	d.socketDir = path.Join(path.Dir(notifyProxyPath()), "daemon")
+	err := os.MkdirAll(d.socketDir, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(path.Dir(d.socketDir))
+
+	d.events = make(chan daemonEvent)
+	d.done = make(chan struct{})
+	defer close(d.done)
+
+	defer func() {
+		for _, child := range d.children {
+			if child.conn != nil {
+				child.conn.Close()
+			}
+		}
+	}()
+	for _, child := range d.children {
+		err = d.openSocket(child)
+		if err != nil {
+			return err
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	defer signal.Stop(hups)
+
+	for _, child := range d.children {
+		d.start(child)
+	}
+
+	restarts := make(chan *daemonChild)
+	pending := 0
+	failed := []string{}
+
+	for {
+		select {
+		case sig := <-signals:
+			logInfo("Got", sig, "stopping all containers")
+			d.stopping = true
+			sendNotify(d.c, "STOPPING=1")
+			for _, child := range d.children {
+				if child.running && child.cmd.Process != nil {
+					child.cmd.Process.Signal(syscall.SIGTERM)
+				}
+			}
+		case <-hups:
+			if !d.stopping {
+				d.reload()
+			}
+		case child := <-restarts:
+			pending--
+			if !d.stopping && !child.removed {
+				d.start(child)
+			}
+		case event := <-d.events:
+			child := event.child
+			if event.ready {
+				child.up = child.running
+				child.settled = true
+				break
+			}
+
+			child.running = false
+			child.up = false
+			child.settled = true
+			if event.err != nil {
+				logWarn(fmt.Sprintf("Container %s exited: %s", child.Name, event.err))
+			} else {
+				logInfo(fmt.Sprintf("Container %s exited", child.Name))
+			}
+
+			if child.removed {
+				d.drop(child)
+				break
+			}
+			if d.stopping {
+				break
+			}
+			if !shouldRestart(child.Restart, event.err) {
+				if event.err != nil {
+					failed = append(failed, child.Name)
+				}
+				break
+			}
+
+			logInfo(fmt.Sprintf("Restarting container %s in %s", child.Name, child.restartSec))
+			pending++
+			time.AfterFunc(child.restartSec, func() {
+				select {
+				case restarts <- child:
+				case <-d.done:
+				}
+			})
+		}
+
+		if !d.ready && d.settled() {
+			d.ready = true
+			sendNotify(d.c, "READY=1")
+		}
+		sendNotify(d.c, d.status())
+
+		running := 0
+		for _, child := range d.children {
+			if child.running {
+				running++
+			}
+		}
+		if running > 0 || (pending > 0 && !d.stopping) {
+			continue
+		}
+		if len(failed) > 0 && !d.stopping {
+			return errors.New(fmt.Sprintf("Containers %s failed", strings.Join(failed, ", ")))
+		}
+		return nil
+	}
+}
+
+/* load reads the .container files of the config directory, a broken file
+ * is left out and its error returned */
+func (d *daemon) load() ([]*daemonChild, []error) {
+	containers, errs := generator.LoadContainers(d.dir)
+
+	children := []*daemonChild{}
+	for _, container := range containers {
+		child := &daemonChild{Container: container, restartSec: d.restartSec}
+
+		switch container.Restart {
+		case "":
+			child.Restart = RESTART_ON_FAILURE
+		case RESTART_NO, RESTART_ALWAYS, RESTART_ON_FAILURE:
+		default:
+			errs = append(errs, errors.New(fmt.Sprintf("%s: Restart=%s is not supported, use no, always or on-failure", container.Name, container.Restart)))
+			continue
+		}
+
+		if len(container.RestartSec) > 0 {
+			restartSec := container.RestartSec
+			if _, err := strconv.Atoi(restartSec); err == nil {
+				/* Plain seconds, as systemd takes them */
+				restartSec += "s"
+			}
+
+			var err error
+			child.restartSec, err = time.ParseDuration(restartSec)
+			if err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("%s: invalid RestartSec=%s", container.Name, container.RestartSec)))
+				continue
+			}
+		}
+
+		children = append(children, child)
+	}
+
+	return children, errs
+}
+
+func parseDaemon(args []string) (*daemon, error) {
+	d := &daemon{
+		c: &Context{NotifySocket: os.Getenv("NOTIFY_SOCKET")},
+	}
+
+	flags := flag.NewFlagSet("systemd-docker daemon", flag.ContinueOnError)
+	flags.StringVar(&d.dir, "config-dir", DAEMON_CONFIG_DIR, "directory of the .container files to run")
+	flags.DurationVar(&d.restartSec, "restart-sec", 10*time.Second, "how long to wait before restarting a container without RestartSec=")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, errors.New("Expected systemd-docker daemon [--config-dir dir]")
+	}
+
+	var errs []error
+	d.children, errs = d.load()
+	for _, err := range errs {
+		logError("Skipping", err)
+	}
+
+	if len(d.children) == 0 {
+		return nil, errors.New(fmt.Sprintf("No containers to run in %s", d.dir))
+	}
+
+	d.binary, err = os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func daemonMain(args []string) error {
+	d, err := parseDaemon(args)
+	if err != nil {
+		return err
+	}
+
+	return d.run()
+}
@@ -0,0 +1,120 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/generator"
+)
+
+func TestChildArgs(t *testing.T) {
+	child := &daemonChild{Container: &generator.Container{Name: "web@1", Args: []string{"--notify", "run", "--rm", "nginx"}}}
+	if args := strings.Join(childArgs(child), " "); args != "--notify run --name web_1 --rm nginx" {
+		t.Fatal("Expected the container to be named after its file, got", args)
+	}
+
+	child.Args = []string{"run", "--name=api", "nginx"}
+	if args := strings.Join(childArgs(child), " "); args != "run --name=api nginx" {
+		t.Fatal("Expected the name to be kept, got", args)
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	failure := os.ErrInvalid
+	if !shouldRestart(RESTART_ON_FAILURE, failure) || shouldRestart(RESTART_ON_FAILURE, nil) {
+		t.Fatal("on-failure should only restart failures")
+	}
+	if !shouldRestart(RESTART_ALWAYS, nil) || shouldRestart(RESTART_NO, failure) {
+		t.Fatal("Bad always or no")
+	}
+}
+
+func writeDaemonConfig(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		err = ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseDaemon(t *testing.T) {
+	dir := writeDaemonConfig(t, map[string]string{
+		"web.container":    "[Container]\nImage=nginx\n[Service]\nRestartSec=3\n",
+		"job.container":    "[Container]\nImage=busybox\n[Service]\nRestart=always\nRestartSec=500ms\n",
+		"odd.container":    "[Container]\nImage=busybox\n[Service]\nRestart=on-abort\n",
+		"broken.container": "[Container]\n",
+	})
+
+	d, err := parseDaemon([]string{"--config-dir", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.children) != 2 {
+		t.Fatal("Expected the broken and unsupported files to be skipped", d.children)
+	}
+
+	job, web := d.children[0], d.children[1]
+	if job.Restart != RESTART_ALWAYS || job.restartSec != 500*time.Millisecond {
+		t.Fatal("Bad job", job.Restart, job.restartSec)
+	}
+	if web.Restart != RESTART_ON_FAILURE || web.restartSec != 3*time.Second {
+		t.Fatal("Bad web", web.Restart, web.restartSec)
+	}
+
+	_, err = parseDaemon([]string{"--config-dir", writeDaemonConfig(t, nil)})
+	if err == nil {
+		t.Fatal("Expected an empty directory to fail")
+	}
+}
+
+func TestDaemonRestarts(t *testing.T) {
+	runtimeDir, err := ioutil.TempDir("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+	os.Setenv("RUNTIME_DIRECTORY", runtimeDir)
+	defer os.Unsetenv("RUNTIME_DIRECTORY")
+
+	dir := writeDaemonConfig(t, map[string]string{
+		"once.container":  "[Container]\nImage=busybox\n[Service]\nRestart=no\n",
+		"flaky.container": "[Container]\nImage=busybox\n[Service]\nRestartSec=10ms\n",
+	})
+
+	/* Fails the first time it runs flaky, succeeds after */
+	script := path.Join(dir, "fake-systemd-docker")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\n"+
+		"echo \"$@\" >> "+path.Join(dir, "runs")+"\n"+
+		"case \"$*\" in *flaky*) [ -e "+path.Join(dir, "failed")+" ] && exit 0; touch "+path.Join(dir, "failed")+"; exit 1;; esac\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := parseDaemon([]string{"--config-dir", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.binary = script
+
+	err = d.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs, _ := ioutil.ReadFile(path.Join(dir, "runs"))
+	if strings.Count(string(runs), "--name flaky") != 2 || strings.Count(string(runs), "--name once") != 1 {
+		t.Fatal("Expected flaky to be restarted once, got", string(runs))
+	}
+}
@@ -0,0 +1,101 @@
+package supervisor
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+/* On SIGHUP, systemctl reload with ExecReload=kill -HUP $MAINPID, daemon
+ * mode reads its config directory again and converges: added containers are
+ * started, removed ones stopped, and those whose arguments changed are stopped
+ * and started again.  A new Restart= or RestartSec= just applies to the next
+ * exit.  If any file is broken nothing changes, the running set is kept
+ * rather than stopping a container over a typo. */
+
+func (d *daemon) reload() {
+	logInfo("Reloading", d.dir)
+	sendNotify(d.c, "RELOADING=1", "STATUS=Reloading "+d.dir)
+
+	/* READY=1 again once the containers started meanwhile are up */
+	d.ready = false
+
+	children, errs := d.load()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			logError("Not reloading:", err)
+		}
+		return
+	}
+
+	wanted := map[string]*daemonChild{}
+	for _, child := range children {
+		wanted[child.Name] = child
+	}
+
+	for _, child := range append([]*daemonChild{}, d.children...) {
+		next, ok := wanted[child.Name]
+		delete(wanted, child.Name)
+
+		switch {
+		case child.removed:
+			/* Still stopping from an earlier reload */
+			child.replacement = next
+		case !ok:
+			logInfo("Removing container", child.Name)
+			d.retire(child, nil)
+		case strings.Join(child.Args, "\x00") != strings.Join(next.Args, "\x00"):
+			logInfo(fmt.Sprintf("Recreating container %s, its configuration changed", child.Name))
+			d.retire(child, next)
+		default:
+			child.Restart = next.Restart
+			child.restartSec = next.restartSec
+		}
+	}
+
+	for _, child := range children {
+		if _, ok := wanted[child.Name]; ok {
+			logInfo("Adding container", child.Name)
+			d.add(child)
+		}
+	}
+}
+
+/* retire stops a removed or changed container, its replacement starts once
+ * it is gone */
+func (d *daemon) retire(child, replacement *daemonChild) {
+	child.removed = true
+	child.replacement = replacement
+	if child.running {
+		if child.cmd.Process != nil {
+			child.cmd.Process.Signal(syscall.SIGTERM)
+		}
+		return
+	}
+	d.drop(child)
+}
+
+/* drop forgets a retired container that is no longer running */
+func (d *daemon) drop(child *daemonChild) {
+	child.conn.Close()
+	for i, other := range d.children {
+		if other == child {
+			d.children = append(d.children[:i], d.children[i+1:]...)
+			break
+		}
+	}
+
+	if child.replacement != nil && !d.stopping {
+		d.add(child.replacement)
+	}
+}
+
+func (d *daemon) add(child *daemonChild) {
+	err := d.openSocket(child)
+	if err != nil {
+		logError("Failed to add container", child.Name, err)
+		return
+	}
+	d.children = append(d.children, child)
+	d.start(child)
+}
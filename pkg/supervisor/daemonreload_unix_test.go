@@ -0,0 +1,105 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitForFile(t *testing.T, file string, done func(string) bool) string {
+	for i := 0; i < 200; i++ {
+		data, _ := ioutil.ReadFile(file)
+		if done(string(data)) {
+			return string(data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	data, _ := ioutil.ReadFile(file)
+	t.Fatal("Timed out, got", string(data))
+	return ""
+}
+
+func TestDaemonReload(t *testing.T) {
+	runtimeDir, err := ioutil.TempDir("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+	os.Setenv("RUNTIME_DIRECTORY", runtimeDir)
+	defer os.Unsetenv("RUNTIME_DIRECTORY")
+
+	dir := writeDaemonConfig(t, map[string]string{
+		"keep.container":   "[Container]\nImage=busybox:1\n",
+		"change.container": "[Container]\nImage=busybox:1\n",
+		"drop.container":   "[Container]\nImage=busybox:1\n",
+	})
+
+	/* Runs until SIGTERM, logging its starts and stops */
+	runs := path.Join(dir, "runs")
+	script := path.Join(dir, "fake-systemd-docker")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\n"+
+		"echo \"start $3 $*\" >> "+runs+"\n"+
+		"trap 'echo \"stop $3\" >> "+runs+"; exit 0' TERM\n"+
+		"while :; do sleep 0.01; done\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := parseDaemon([]string{"--config-dir", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.binary = script
+
+	result := make(chan error)
+	go func() {
+		result <- d.run()
+	}()
+
+	waitForFile(t, runs, func(s string) bool { return strings.Count(s, "start") == 3 })
+
+	ioutil.WriteFile(path.Join(dir, "change.container"), []byte("[Container]\nImage=busybox:2\n"), 0644)
+	os.Remove(path.Join(dir, "drop.container"))
+	ioutil.WriteFile(path.Join(dir, "new.container"), []byte("[Container]\nImage=busybox:1\n"), 0644)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	log := waitForFile(t, runs, func(s string) bool { return strings.Count(s, "start") == 5 && strings.Contains(s, "stop drop") })
+	for _, line := range []string{"stop change", "stop drop", "start change run --name change --rm busybox:2", "start new"} {
+		if !strings.Contains(log, line) {
+			t.Fatal("Expected", line, "in", log)
+		}
+	}
+	if strings.Contains(log, "stop keep") {
+		t.Fatal("Expected the unchanged container to keep running", log)
+	}
+	if strings.Index(log, "stop change") > strings.Index(log, "start change run --name change --rm busybox:2") {
+		t.Fatal("Expected the changed container to stop before it starts again", log)
+	}
+
+	/* A broken file keeps everything as it is */
+	ioutil.WriteFile(path.Join(dir, "broken.container"), []byte("[Container]\n"), 0644)
+	os.Remove(path.Join(dir, "new.container"))
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	time.Sleep(100 * time.Millisecond)
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case err = <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the daemon to stop")
+	}
+
+	data, _ := ioutil.ReadFile(runs)
+	if strings.Count(string(data), "stop new") != 1 || strings.Count(string(data), "start") != 5 {
+		t.Fatal("Expected the broken reload to change nothing", string(data))
+	}
+}
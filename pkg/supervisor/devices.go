@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+/* --wait-device gives udev time to create the device nodes of --device
+ * before the container is started, docker fails the start on a missing one */
+
+var devicePollInterval = 100 * time.Millisecond
+
+func missingDevices(devices []string) []string {
+	missing := []string{}
+	for _, device := range devices {
+		if _, err := os.Stat(device); err != nil {
+			missing = append(missing, device)
+		}
+	}
+	return missing
+}
+
+func waitDevices(c *Context) error {
+	if c.WaitDevice <= 0 {
+		return nil
+	}
+
+	missing := missingDevices(runDevices(c.Args))
+	if len(missing) == 0 {
+		return nil
+	}
+
+	logInfo("Waiting for devices", missing)
+	deadline := time.Now().Add(c.WaitDevice)
+	for len(missing) > 0 {
+		if time.Now().After(deadline) {
+			return errors.New(fmt.Sprintf("Device %s did not appear within %s", missing[0], c.WaitDevice))
+		}
+
+		select {
+		case <-rootContext(c).Done():
+			return rootContext(c).Err()
+		case <-time.After(devicePollInterval):
+		}
+		missing = missingDevices(missing)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitDevices(t *testing.T) {
+	device := path.Join(t.TempDir(), "ttyUSB0")
+	c := &Context{Args: []string{"--device", device + ":/dev/ttyUSB0", "busybox"}, WaitDevice: 5 * time.Second}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		ioutil.WriteFile(device, nil, 0600)
+	}()
+
+	if err := waitDevices(c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitDevicesTimeout(t *testing.T) {
+	device := path.Join(t.TempDir(), "ttyUSB0")
+	c := &Context{Args: []string{"--device=" + device, "busybox"}, WaitDevice: 200 * time.Millisecond}
+
+	err := waitDevices(c)
+	if err == nil || !strings.Contains(err.Error(), device) {
+		t.Fatal("Expected timeout for", device, err)
+	}
+
+	c.WaitDevice = 0
+	if err := waitDevices(c); err != nil {
+		t.Fatal("Waited without --wait-device", err)
+	}
+}
@@ -0,0 +1,87 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+const LABEL_DIGEST = "io.systemd-docker.digest"
+
+/* imageRef returns the image given in the docker run args */
+func imageRef(args []string) string {
+	image := imageIndex(args)
+	if image >= len(args) {
+		return ""
+	}
+	return args[image]
+}
+
+/* imageDigest returns the digest of a name@sha256:... reference */
+func imageDigest(ref string) string {
+	i := strings.LastIndex(ref, "@")
+	if i < 0 {
+		return ""
+	}
+	return ref[i+1:]
+}
+
+func checkDigestRef(c *Context) error {
+	if !c.RequireDigest {
+		return nil
+	}
+
+	ref := imageRef(c.Args)
+	if !strings.HasPrefix(imageDigest(ref), "sha256:") {
+		return errors.New(fmt.Sprintf("--require-digest needs an image pinned by digest (name@sha256:...), got %s", ref))
+	}
+
+	return nil
+}
+
+func digestLabels(c *Context) []string {
+	digest := imageDigest(imageRef(c.Args))
+	if len(digest) == 0 {
+		return nil
+	}
+	return []string{"--label", LABEL_DIGEST + "=" + digest}
+}
+
+/* verifyDigest makes sure the container runs the image the reference was
+ * pinned to, a container left over under the same name may not */
+func verifyDigest(c *Context, container *dockerContainer.InspectResponse) error {
+	digest := imageDigest(imageRef(c.Args))
+	if len(digest) == 0 {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	image, err := client.ImageInspect(ctx, container.Image)
+	if err != nil {
+		return err
+	}
+
+	if !hasDigest(image.RepoDigests, digest) {
+		return errors.New(fmt.Sprintf("Container %s runs image %s, which does not match %s", shortId(container.ID), container.Image, digest))
+	}
+
+	return nil
+}
+
+func hasDigest(repoDigests []string, digest string) bool {
+	for _, repoDigest := range repoDigests {
+		if imageDigest(repoDigest) == digest {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:1f8c5de0b1b2d5e2ec2f7d43e9de2d8df3e6d2f5b6c1c9e4b0f0a1a3b1d2c3e4"
+
+func TestImageDigest(t *testing.T) {
+	cases := map[string]string{
+		"busybox":                          "",
+		"busybox:latest":                   "",
+		"busybox@" + testDigest:            testDigest,
+		"localhost:5000/app@" + testDigest: testDigest,
+	}
+
+	for ref, expected := range cases {
+		if imageDigest(ref) != expected {
+			t.Fatal("Expected", expected, "got", imageDigest(ref), "for", ref)
+		}
+	}
+}
+
+func TestParseRequireDigest(t *testing.T) {
+	_, err := Parse([]string{"--require-digest", "run", "--name", "test", "busybox:latest", "sh"})
+	if err == nil {
+		t.Fatal("Expected an unpinned image to be rejected")
+	}
+
+	c, err := Parse([]string{"--require-digest", "run", "--name", "test", "busybox@" + testDigest, "sh"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !strings.Contains(strings.Join(c.Args, " "), "--label "+LABEL_DIGEST+"="+testDigest) {
+		t.Fatal("Missing digest label", c.Args)
+	}
+}
+
+func TestHasDigest(t *testing.T) {
+	repoDigests := []string{"busybox@sha256:0000", "mirror/busybox@" + testDigest}
+
+	if !hasDigest(repoDigests, testDigest) {
+		t.Fatal("Digest not found")
+	}
+
+	if hasDigest(repoDigests, "sha256:1111") {
+		t.Fatal("Unexpected digest found")
+	}
+}
@@ -0,0 +1,256 @@
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if len(arg) == 0 || strings.ContainsAny(arg, " \t\n\"'\\$") {
+			arg = strconv.Quote(arg)
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+/* plan describes what Run would do for c, without talking to the daemon */
+func plan(c *Context) []string {
+	steps := []string{}
+
+	if c.LinkLifetime {
+		steps = append(steps, fmt.Sprintf("kill running containers labeled %s=true a previous run of the unit left behind", LABEL_LINKED))
+	}
+
+	if c.Gc {
+		steps = append(steps, fmt.Sprintf("remove stopped containers labeled %s=%s left from other names or run arguments", LABEL_UNIT, unitName(c)))
+	}
+
+	if len(c.Name) > 0 {
+		stopped := "start it again"
+		if c.Rm {
+			stopped = "remove it"
+		}
+		recreate := ""
+		if len(c.ConfigHash) > 0 && c.Recreate {
+			recreate = "remove it if it was created from other run arguments, "
+		}
+		steps = append(steps, fmt.Sprintf("look up container %s, %sre-attach if it is running, %s if it is stopped", c.Name, recreate, stopped))
+		steps = append(steps, "if no container was found:")
+	} else if unit := unitName(c); len(unit) > 0 {
+		steps = append(steps, fmt.Sprintf("re-adopt a running container labeled %s=%s", LABEL_UNIT, unit))
+		steps = append(steps, "if no container was found:")
+	}
+
+	if c.OomScoreSet {
+		steps = append(steps, fmt.Sprintf("lower our OOM score adjustment to %d, below the container's", ownOomScore(c)))
+	}
+
+	steps = appendHookSteps(c, steps, "pre-start")
+	if devices := runDevices(c.Args); c.WaitDevice > 0 && len(devices) > 0 {
+		steps = append(steps, fmt.Sprintf("wait up to %s for devices to appear: %s", c.WaitDevice, strings.Join(devices, ", ")))
+	}
+	if sources := bindSources(c.Args); c.MkdirVolumes && len(sources) > 0 {
+		steps = append(steps, fmt.Sprintf("create missing volume directories with mode %#o: %s", c.MkdirMode, strings.Join(sources, ", ")))
+	}
+	switch c.PullPolicy {
+	case PULL_ALWAYS:
+		steps = append(steps, "pull "+imageRef(c.Args))
+	case PULL_MISSING:
+		steps = append(steps, "pull "+imageRef(c.Args)+" if it is not present")
+	case PULL_NEVER:
+		steps = append(steps, "fail if "+imageRef(c.Args)+" is not present")
+	}
+	if c.Foreground {
+		steps = append(steps, "docker run "+quoteArgs(createArgs(c.Args))+" in the foreground with our stdin, stdout and stderr")
+		steps = append(steps, "read the container id from the cidfile once it is created")
+		if digest := imageDigest(imageRef(c.Args)); len(digest) > 0 {
+			steps = append(steps, "check the container's image matches "+digest)
+		}
+	} else {
+		steps = appendCreateSteps(c, steps)
+	}
+
+	if c.StartTimeout > 0 {
+		steps = append(steps, fmt.Sprintf("remove the container and exit %d if it has no pid after %s", EXIT_START_TIMEOUT, c.StartTimeout))
+	}
+
+	if len(c.NotifySocket) > 0 {
+		mainPid := "container pid"
+		if c.OnSuccess != "exit" {
+			mainPid = "systemd-docker pid"
+		}
+		msg := fmt.Sprintf("notify systemd at %s: MAINPID=<%s>", c.NotifySocket, mainPid)
+		if c.Notify && len(c.NotifyProxy) > 0 {
+			msg += ", READY=1 is left to the container, relayed through " + c.NotifyProxy
+		} else if c.Notify {
+			msg += ", READY=1 is left to the container"
+		} else if len(c.ReadyNetwork.Network) > 0 || len(c.ReadyHttp.Url) > 0 || len(c.ReadyGrpc.Target) > 0 || c.NotifyMode == NOTIFY_HEALTHY {
+			conditions := []string{}
+			if len(c.ReadyNetwork.Network) > 0 {
+				conditions = append(conditions, "the container has an address on "+c.ReadyNetwork.Network)
+				if c.ReadyNetwork.Ping {
+					conditions[0] += " that answers ping"
+				}
+			}
+			if len(c.ReadyHttp.Url) > 0 {
+				conditions = append(conditions, fmt.Sprintf("%s returns %d", c.ReadyHttp.Url, c.ReadyHttp.Status))
+			}
+			if len(c.ReadyGrpc.Target) > 0 {
+				conditions = append(conditions, c.ReadyGrpc.Target+" reports SERVING")
+			}
+			if c.NotifyMode == NOTIFY_HEALTHY {
+				conditions = append(conditions, "the container is healthy")
+			}
+			msg += ", READY=1 once " + strings.Join(conditions, " and ")
+		} else {
+			msg += ", READY=1"
+		}
+		steps = append(steps, msg)
+	} else if c.NotifyMode == NOTIFY_OFF {
+		steps = append(steps, "systemd will not be notified, --notify=off")
+	} else {
+		steps = append(steps, "NOTIFY_SOCKET is not set, systemd will not be notified")
+	}
+
+	steps = appendHookSteps(c, steps, "post-start")
+
+	if len(c.PidFile) > 0 {
+		steps = append(steps, "write container pid to "+c.PidFile)
+	}
+
+	if len(c.CidFile) > 0 {
+		steps = append(steps, "write container id to "+c.CidFile)
+	}
+	if c.Machine {
+		steps = append(steps, "register the container with systemd-machined, unregister it once it stops")
+	}
+
+	if c.Logs {
+		msg := "pipe container logs to stdout/stderr"
+		if !c.LogsForced {
+			msg += " unless the container logs to journald"
+		}
+		if c.LogLevel >= 0 {
+			msg += fmt.Sprintf(", dropping lines less severe than level %d", c.LogLevel)
+		}
+		if len(c.LogFilters) > 0 {
+			msg += fmt.Sprintf(", dropping lines caught by %d --log-filter", len(c.LogFilters))
+		}
+		steps = append(steps, msg)
+	}
+
+	if c.Logs && len(c.LogSinkCmd) > 0 {
+		steps = append(steps, "send container log records to "+c.LogSinkCmd)
+	}
+
+	if len(c.AutoUpdate) > 0 {
+		where := "at the registry"
+		if c.AutoUpdate == AUTO_UPDATE_LOCAL {
+			where = "in the local images"
+		}
+		steps = append(steps, fmt.Sprintf("every %s look up %s %s, and recreate the container when it moved", c.UpdateInterval, imageRef(c.Args), where))
+	}
+
+	if staysAround(c) {
+		steps = append(steps, "wait for the container to exit")
+		if timeout := stopTimeout(c); timeout >= 0 {
+			steps = append(steps, fmt.Sprintf("on SIGTERM give the container %s to stop before it is killed", timeout))
+		}
+		if c.Checkpoint {
+			steps = append(steps, "on SIGTERM checkpoint the container to "+checkpointDir(c)+", or stop it if that fails")
+		}
+		if hooks := c.Hooks.Commands["pre-stop"]; hooks != nil && len(*hooks) > 0 {
+			steps = append(steps, "on SIGTERM run pre-stop: "+strings.Join(*hooks, "; ")+", then stop the container")
+		}
+		if len(c.PreStopExec) > 0 {
+			steps = append(steps, "on SIGTERM run in the container: "+strings.Join(c.PreStopExec, "; ")+", then stop it")
+		}
+		if c.UnhealthyTimeout > 0 {
+			steps = append(steps, fmt.Sprintf("stop the container and exit %d once it has been unhealthy for %s", EXIT_UNHEALTHY, c.UnhealthyTimeout))
+		}
+		switch c.OnSuccess {
+		case "restart":
+			steps = append(steps, "start the container again whenever it exits with code 0")
+		case "remain":
+			steps = append(steps, "stay running after the container exits with code 0 until stopped")
+		}
+	} else {
+		steps = append(steps, "exit, leaving the container running")
+	}
+
+	if c.LinkLifetime {
+		steps = append(steps, "stop the container if it is still running when systemd-docker exits")
+	}
+
+	if c.RmVolumes {
+		steps = append(steps, "remove the container and its anonymous volumes")
+	} else if c.Rm {
+		steps = append(steps, "remove the container")
+	}
+	if c.PruneImage {
+		steps = append(steps, "remove the container's image unless another container or tag uses it")
+	}
+
+	steps = appendHookSteps(c, steps, "post-stop")
+
+	return steps
+}
+
+func appendHookSteps(c *Context, steps []string, phase string) []string {
+	commands := c.Hooks.Commands[phase]
+	if commands == nil {
+		return steps
+	}
+
+	for _, command := range *commands {
+		steps = append(steps, fmt.Sprintf("run %s hook: %s", phase, command))
+	}
+	return steps
+}
+
+/* appendCreateSteps adds docker create and the start through the API */
+func appendCreateSteps(c *Context, steps []string) []string {
+	steps = append(steps, "docker create "+quoteArgs(createArgs(c.Args)))
+	if digest := imageDigest(imageRef(c.Args)); len(digest) > 0 {
+		steps = append(steps, "check the container's image matches "+digest)
+	}
+	if verifySigning(c) {
+		methods := []string{}
+		for _, key := range c.VerifyKeys {
+			methods = append(methods, "cosign with key "+key)
+		}
+		if len(c.VerifyIdentity) > 0 {
+			methods = append(methods, "cosign keyless as "+c.VerifyIdentity)
+		}
+		if c.VerifyNotation {
+			methods = append(methods, "notation")
+		}
+		steps = append(steps, "verify the signature of the container's image with "+strings.Join(methods, " or ")+", remove the container if it fails")
+	}
+	if c.Attach {
+		steps = append(steps, "attach our stdin, stdout and stderr to the container")
+	} else if c.Stdin && c.Logs {
+		steps = append(steps, "attach our stdin and the container's output")
+	} else if c.Stdin {
+		steps = append(steps, "attach our stdin to the container")
+	} else if c.Logs {
+		steps = append(steps, "attach to the container's output")
+	}
+	if c.Checkpoint {
+		steps = append(steps, "start the container, restored from the checkpoint in "+checkpointDir(c)+" if there is one")
+	} else {
+		steps = append(steps, "start the container")
+	}
+	return steps
+}
+
+func printPlan(c *Context, out io.Writer) {
+	for i, step := range plan(c) {
+		fmt.Fprintf(out, "%d. %s\n", i+1, step)
+	}
+}
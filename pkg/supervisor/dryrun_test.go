@@ -0,0 +1,44 @@
+package supervisor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	c, err := Parse([]string{"--dry-run", "--pid-file", "/run/test.pid", "run", "--rm", "--name", "test", "busybox", "sh", "-c", "echo hi"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !c.DryRun {
+		t.Fatal("dry-run should be set")
+	}
+
+	out := &bytes.Buffer{}
+	printPlan(c, out)
+
+	for _, expected := range []string{
+		"look up container test",
+		"docker create --label " + LABEL_CONFIG + "=" + c.ConfigHash + ` --name test busybox sh -c "echo hi"`,
+		"write container pid to /run/test.pid",
+		"remove the container",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("Expected %q in plan:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestPlanAdoptsUnitContainer(t *testing.T) {
+	c, err := Parse([]string{"--unit", "web.service", "--default-name=false", "--dry-run", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := strings.Join(plan(c), "\n")
+	if !strings.Contains(steps, "re-adopt a running container labeled io.systemd.unit=web.service") {
+		t.Fatal("Missing adoption step", steps)
+	}
+}
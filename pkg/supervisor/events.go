@@ -0,0 +1,388 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+type containerState int
+
+const (
+	stateRunning containerState = iota
+	statePaused
+	stateRestarting
+	stateExited
+)
+
+/* RESTARTING_POLLS bounds how many polls an exited container is taken to be
+ * between its die and the daemon marking it restarting */
+const RESTARTING_POLLS = 3
+
+func (s containerState) String() string {
+	switch s {
+	case stateRunning:
+		return "running"
+	case statePaused:
+		return "paused"
+	case stateRestarting:
+		return "restarting"
+	}
+	return "exited"
+}
+
+func classifyState(state runtime.State) containerState {
+	switch {
+	case state.Restarting:
+		return stateRestarting
+	case state.Paused:
+		return statePaused
+	case state.Running:
+		return stateRunning
+	}
+	return stateExited
+}
+
+/* stateMachine follows the container through daemon side transitions so a
+ * pause, or a die the restart policy will recover from, isn't taken as the
+ * container exiting */
+type stateMachine struct {
+	state    containerState
+	policy   runtime.RestartPolicy
+	restarts int
+	stopping bool
+}
+
+func newStateMachine(container *runtime.Container) *stateMachine {
+	m := &stateMachine{}
+	m.reset(container)
+	return m
+}
+
+func (m *stateMachine) reset(container *runtime.Container) {
+	m.state = classifyState(container.State)
+	m.restarts = container.RestartCount
+	m.policy = container.RestartPolicy
+}
+
+func (m *stateMachine) willRestart(exitCode int) bool {
+	if m.stopping {
+		return false
+	}
+
+	switch m.policy.Name {
+	case "always", "unless-stopped":
+		return true
+	case "on-failure":
+		return exitCode != 0 && (m.policy.MaxRetries == 0 || m.restarts < m.policy.MaxRetries)
+	}
+
+	return false
+}
+
+func (m *stateMachine) handle(action string, exitCode int) containerState {
+	switch action {
+	case "stop":
+		/* docker stop disables the restart policy.  dockerd sends kill, die,
+		 * stop, so the die has already been taken for a restart. */
+		m.stopping = true
+		if m.state == stateRestarting {
+			m.restarts--
+			m.state = stateExited
+		}
+	case "die":
+		if m.willRestart(exitCode) {
+			m.restarts++
+			m.state = stateRestarting
+		} else {
+			m.state = stateExited
+		}
+	case "start", "restart", "unpause":
+		m.stopping = false
+		m.state = stateRunning
+	case "pause":
+		m.state = statePaused
+	case "destroy":
+		m.state = stateExited
+	}
+
+	return m.state
+}
+
+/* The daemon restarted the container under us (restart policy, live-restore,
+ * docker restart), so the pid systemd is tracking is stale.  Returns true if
+ * the pid changed. */
+func containerRestarted(c *Context) (bool, error) {
+	pid, err := getContainerPid(c)
+	if err != nil {
+		return false, err
+	}
+
+	if pid == c.Pid {
+		return false, nil
+	}
+
+	logInfo(fmt.Sprintf("Container %s restarted, pid %d -> %d", shortId(c.Id), c.Pid, pid))
+	c.identity.Lock()
+	c.Pid = pid
+	c.identity.Unlock()
+	trackCgroup(c)
+
+	err = sendNotify(c, fmt.Sprintf("MAINPID=%d", mainPid(c)), statusMessage(c))
+	if err != nil {
+		return true, err
+	}
+
+	err = notifyBarrier(c)
+	if err != nil {
+		logWarn("Notify barrier failed:", err)
+	}
+
+	err = pidFile(c)
+	if err != nil {
+		return true, err
+	}
+
+	/* The ip can change with the restart */
+	return true, writeContainerEnv(c)
+}
+
+func containerStarted(c *Context) {
+	changed, err := containerRestarted(c)
+	if err != nil {
+		logWarn("Failed to update container pid:", err)
+	}
+
+	if changed {
+		startedEvent(c)
+		go pipeLogs(c)
+		registerMachine(c)
+	}
+}
+
+/* pollInterval is --poll-interval with up to 10% jitter, so the units of a
+ * host don't all poll the daemon in lockstep */
+func pollInterval(c *Context) time.Duration {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = INTERVAL * time.Millisecond
+	}
+	return interval + time.Duration(rand.Int63n(int64(interval/10)+1))
+}
+
+/* pollTicks fires every poll interval, and right away once the container's
+ * cgroup empties */
+func pollTicks(c *Context) (<-chan struct{}, func()) {
+	ctx, cancel := context.WithCancel(rootContext(c))
+	emptied, stopWatching := watchCgroup(c)
+
+	polls := make(chan struct{})
+	go func() {
+		defer stopWatching()
+		for {
+			select {
+			case <-time.After(pollInterval(c)):
+			case <-emptied:
+				logDebug("Container", shortId(c.Id), "has no processes left")
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case polls <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return polls, cancel
+}
+
+/* waitForExit returns once the container has really exited.  Events drive the
+ * state machine, polling every --poll-interval catches anything the event stream
+ * missed. */
+func waitForExit(c *Context) (*runtime.Container, error) {
+	rt, err := getRuntime(c)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, stopListening := listenEvents(c, rt)
+	defer func() {
+		stopListening()
+	}()
+
+	polls, stopPolling := pollTicks(c)
+	defer stopPolling()
+
+	container, err := reinspect(c, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newStateMachine(container)
+	restartingPolls := 0
+
+	for {
+		if m.state == stateExited {
+			/* A die followed by a start (docker restart) looks like an exit
+			 * for a moment, give it one interval to come back */
+			time.Sleep(pollInterval(c))
+
+			container, err = reinspect(c, rt)
+			if err != nil {
+				return nil, err
+			}
+
+			if classifyState(container.State) == stateExited {
+				return container, nil
+			}
+
+			m.reset(container)
+			containerStarted(c)
+			continue
+		}
+
+		select {
+		case event, ok := <-listener:
+			if !ok {
+				/* The stream broke, poll until we can listen again */
+				logWarn("Lost the docker event stream, polling only")
+				stopListening()
+				listener = nil
+				continue
+			}
+
+			if event.ContainerID != c.Id {
+				continue
+			}
+
+			action := event.Action
+			if status, ok := healthStatus(action); ok {
+				setHealth(c, status)
+				continue
+			}
+
+			before := m.state
+			after := m.handle(action, event.ExitCode)
+			if before != after {
+				logDebug(fmt.Sprintf("Container %s %s: %s -> %s", shortId(c.Id), action, before, after))
+			}
+
+			if action == "start" {
+				containerStarted(c)
+			}
+		case <-polls:
+			container, err = reinspect(c, rt)
+			if err != nil {
+				return nil, err
+			}
+
+			if listener == nil {
+				listener, stopListening = listenEvents(c, rt)
+			}
+
+			if status := container.State.Health; status != "" {
+				setHealth(c, status)
+			}
+
+			state := classifyState(container.State)
+			if state == stateExited && m.state == stateRestarting && restartingPolls < RESTARTING_POLLS {
+				/* Between the die and the daemon marking it restarting */
+				restartingPolls++
+				continue
+			}
+			restartingPolls = 0
+
+			if state != m.state {
+				logDebug(fmt.Sprintf("Container %s polled: %s -> %s", shortId(c.Id), m.state, state))
+				m.reset(container)
+			}
+
+			if state == stateRunning && container.State.Pid != c.Pid {
+				containerStarted(c)
+			}
+		}
+	}
+}
+
+/* listenEvents follows the events of our container until the returned func
+ * is called.  The channel is closed if the stream breaks. */
+func listenEvents(c *Context, rt runtime.ContainerRuntime) (chan runtime.Event, func()) {
+	ctx, cancel := context.WithCancel(rootContext(c))
+	messages, errs := rt.Events(ctx, c.Id)
+
+	listener := make(chan runtime.Event, 10)
+	go func() {
+		defer close(listener)
+		for {
+			select {
+			case message := <-messages:
+				select {
+				case listener <- message:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-errs:
+				if ctx.Err() == nil {
+					logDebug("Docker event stream ended:", err)
+				}
+				return
+			}
+		}
+	}()
+
+	return listener, cancel
+}
+
+/* reinspect inspects the container, riding out restarts of the daemon.  With
+ * live-restore the container keeps running meanwhile, only our connections
+ * to the daemon are lost. */
+func reinspect(c *Context, rt runtime.ContainerRuntime) (*runtime.Container, error) {
+	container, err := inspectRuntime(c, rt, c.Id)
+	if err == nil || runtime.IsNotFound(err) || cancelled(c) {
+		return container, err
+	}
+
+	lost := time.Now()
+	backoff := pollInterval(c)
+	logWarn("Lost connection to the docker daemon, reconnecting:", err)
+	sendNotify(c, "STATUS=Waiting for the docker daemon")
+
+	for {
+		if c.DaemonTimeout > 0 && time.Since(lost) > c.DaemonTimeout {
+			return nil, withExitCode(EXIT_DAEMON_UNREACHABLE, errors.New(fmt.Sprintf("Docker daemon unreachable for %s: %s", c.DaemonTimeout, err)))
+		}
+
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+
+		container, err = inspectRuntime(c, rt, c.Id)
+		if err == nil || runtime.IsNotFound(err) || cancelled(c) {
+			break
+		}
+		logDebug("Docker daemon still unreachable:", err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	logInfo("Reconnected to the docker daemon")
+	sendNotify(c, statusMessage(c))
+
+	/* The log stream broke with the connection, a new pid gets a new one
+	 * from containerStarted */
+	if container.State.Running && container.State.Pid == c.Pid {
+		go pipeLogsSince(c, lost)
+	}
+
+	return container, nil
+}
@@ -0,0 +1,268 @@
+package supervisor
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+func testMachine(policy string, max int) *stateMachine {
+	return newStateMachine(&runtime.Container{
+		State:         runtime.State{Running: true},
+		RestartPolicy: runtime.RestartPolicy{Name: policy, MaxRetries: max},
+	})
+}
+
+func TestStateMachinePause(t *testing.T) {
+	m := testMachine("", 0)
+
+	if m.handle("pause", -1) != statePaused {
+		t.Fatal("should be paused", m.state)
+	}
+
+	if m.handle("unpause", -1) != stateRunning {
+		t.Fatal("should be running", m.state)
+	}
+}
+
+func TestStateMachineNoPolicy(t *testing.T) {
+	m := testMachine("no", 0)
+
+	if m.handle("die", 1) != stateExited {
+		t.Fatal("should have exited", m.state)
+	}
+}
+
+func TestStateMachineAlways(t *testing.T) {
+	m := testMachine("always", 0)
+
+	if m.handle("die", 0) != stateRestarting {
+		t.Fatal("should be restarting", m.state)
+	}
+
+	if m.handle("start", -1) != stateRunning {
+		t.Fatal("should be running", m.state)
+	}
+
+	/* dockerd's order for docker stop */
+	m.handle("kill", -1)
+	m.handle("die", 137)
+	if m.handle("stop", -1) != stateExited {
+		t.Fatal("docker stop should not restart", m.state)
+	}
+	if m.restarts != 1 {
+		t.Fatal("docker stop should not count as a restart", m.restarts)
+	}
+
+	if m.handle("start", -1) != stateRunning {
+		t.Fatal("should be running", m.state)
+	}
+	if m.handle("die", 0) != stateRestarting {
+		t.Fatal("a start should restore the restart policy", m.state)
+	}
+}
+
+func TestStateMachineOnFailure(t *testing.T) {
+	m := testMachine("on-failure", 2)
+
+	if m.handle("die", 0) != stateExited {
+		t.Fatal("success should not restart", m.state)
+	}
+
+	m = testMachine("on-failure", 2)
+	for i := 0; i < 2; i++ {
+		if m.handle("die", 1) != stateRestarting {
+			t.Fatal("failure should restart", i, m.state)
+		}
+		m.handle("start", -1)
+	}
+
+	if m.handle("die", 1) != stateExited {
+		t.Fatal("should give up after max retries", m.state)
+	}
+}
+
+func TestClassifyState(t *testing.T) {
+	cases := map[containerState]runtime.State{
+		stateRunning:    {Running: true},
+		statePaused:     {Running: true, Paused: true},
+		stateRestarting: {Running: true, Restarting: true},
+		stateExited:     {ExitCode: 1},
+	}
+
+	for expected, state := range cases {
+		if classifyState(state) != expected {
+			t.Fatal("Expected", expected, "for", state)
+		}
+	}
+}
+
+func TestReinspectRidesOutDaemonRestart(t *testing.T) {
+	requests := 0
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Id": "abc", "State": {"Running": true, "Pid": 42}}`))
+	}).Client
+
+	c := &Context{Id: "abc", Pid: 42, Client: client, DaemonTimeout: 10 * time.Second}
+	container, err := reinspect(c, runtime.NewDocker(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if container.State.Pid != 42 || requests != 3 {
+		t.Fatal("Unexpected container", container.State.Pid, requests)
+	}
+}
+
+func TestReinspectGivesUp(t *testing.T) {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}).Client
+
+	c := &Context{Id: "abc", Client: client, DaemonTimeout: 150 * time.Millisecond}
+	_, err := reinspect(c, runtime.NewDocker(client))
+	if err == nil {
+		t.Fatal("Expected reinspect to give up")
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	c := &Context{PollInterval: time.Second}
+	for i := 0; i < 100; i++ {
+		interval := pollInterval(c)
+		if interval < time.Second || interval > 1100*time.Millisecond {
+			t.Fatal("Interval out of range", interval)
+		}
+	}
+
+	_, err := Parse([]string{"--poll-interval=0", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected a zero poll interval to be rejected")
+	}
+}
+
+/* exitWhenRunning makes container id exit with code once it ran for after */
+func exitWhenRunning(m *runtime.Mock, id string, code int, after time.Duration) {
+	for {
+		container, err := m.Inspect(context.Background(), id)
+		if err == nil && container.State.Running {
+			time.Sleep(after)
+			m.Exit(id, code)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWaitForExit(t *testing.T) {
+	c, m := mockContext("")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.SetHealth("abc", "unhealthy")
+		m.Exit("abc", 3)
+	}()
+
+	container, err := waitForExit(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.State.ExitCode != 3 {
+		t.Fatal("Expected exit code 3, got", container.State.ExitCode)
+	}
+	if !isUnhealthy(c) {
+		t.Fatal("Expected the health event to be followed")
+	}
+}
+
+func TestWaitForExitFollowsRestarts(t *testing.T) {
+	c, m := mockContext("always")
+	pid := c.Pid
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		/* The restart policy brings it back with a new pid */
+		m.Exit("abc", 1)
+		m.Start(context.Background(), "abc")
+		time.Sleep(100 * time.Millisecond)
+		m.Stop(context.Background(), "abc", time.Second)
+	}()
+
+	container, err := waitForExit(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.State.Running || c.Pid == pid {
+		t.Fatal("Expected the restarted container to be followed until stopped", c.Pid, pid)
+	}
+}
+
+func TestWaitForExitStopAfterDie(t *testing.T) {
+	c, m := mockContext("always")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Stop(context.Background(), "abc", time.Second)
+	}()
+
+	container, err := waitForExit(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.State.Running {
+		t.Fatal("Expected docker stop to end the wait")
+	}
+}
+
+func TestWaitForExitMissedStop(t *testing.T) {
+	c, m := mockContext("always")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		/* Only the die made it, the container never comes back */
+		m.Exit("abc", 0)
+	}()
+
+	done := make(chan error)
+	go func() {
+		_, err := waitForExit(c)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Waited forever on a container that won't restart")
+	}
+}
+
+func TestRestartContainerMock(t *testing.T) {
+	c, m := mockContext("")
+	m.Exit("abc", 0)
+
+	err := restartContainer(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Rm = true
+	err = rmContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(m.Calls, ", ") != "start abc, remove abc" {
+		t.Fatal("Unexpected calls", m.Calls)
+	}
+}
@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* Each class of failure exits with a code of its own, so units can tune
+ * RestartPreventExitStatus= and SuccessExitStatus= per failure.  The codes
+ * stay clear of 1, of 125-127 that docker run uses and of 128 and up that
+ * shells use for signals.  They are part of the interface, don't renumber. */
+
+const (
+	EXIT_DAEMON_UNREACHABLE = 116
+	EXIT_PULL_FAILED        = 117
+	EXIT_START_FAILED       = 118
+	EXIT_NOT_READY          = 119
+	EXIT_CONTAINER_FAILED   = 120
+	EXIT_CLEANUP_FAILED     = 121
+	EXIT_OOM_KILLED         = 122
+	EXIT_UNHEALTHY          = 123
+	EXIT_START_TIMEOUT      = 124
+)
+
+/* exitError is an error that knows the code to exit with */
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+/* withExitCode classifies err, unless it was classified closer to where it
+ * happened or the daemon couldn't be reached at all */
+func withExitCode(code int, err error) error {
+	var classified *exitError
+	if errors.As(err, &classified) || dockerx.IsUnreachable(err) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+/* exitCode is the code to exit with for err, 1 if it wasn't classified */
+func exitCode(err error) int {
+	var classified *exitError
+	switch {
+	case err == ErrStartTimeout:
+		return EXIT_START_TIMEOUT
+	case err == ErrOOMKilled:
+		return EXIT_OOM_KILLED
+	case err == ErrUnhealthy:
+		return EXIT_UNHEALTHY
+	case errors.As(err, &classified):
+		return classified.code
+	case dockerx.IsUnreachable(err):
+		return EXIT_DAEMON_UNREACHABLE
+	}
+	return 1
+}
+
+/* runExitStatus is what Main exits with after Run returned c and err, with
+ * the signal to die from instead for a container killed by one */
+func runExitStatus(c *Context, err error) (int, syscall.Signal) {
+	if err != nil {
+		return exitCode(err), 0
+	}
+	if sig, ok := exitSignal(c.ExitCode); ok {
+		return 128 + int(sig), sig
+	}
+	if c.ExitCode != 0 {
+		return EXIT_CONTAINER_FAILED, 0
+	}
+	return 0, 0
+}
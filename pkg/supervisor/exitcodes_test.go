@@ -0,0 +1,93 @@
+package supervisor
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	err := errors.New("Boom")
+	if code := exitCode(err); code != 1 {
+		t.Fatal("Expected 1 for an unclassified error, got", code)
+	}
+	if code := exitCode(ErrStartTimeout); code != EXIT_START_TIMEOUT {
+		t.Fatal("Expected", EXIT_START_TIMEOUT, "got", code)
+	}
+	if code := exitCode(ErrOOMKilled); code != EXIT_OOM_KILLED {
+		t.Fatal("Expected", EXIT_OOM_KILLED, "got", code)
+	}
+
+	pull := withExitCode(EXIT_PULL_FAILED, err)
+	if pull.Error() != "Boom" || !errors.Is(pull, err) {
+		t.Fatal("Classifying should keep the error", pull)
+	}
+	if code := exitCode(pull); code != EXIT_PULL_FAILED {
+		t.Fatal("Expected", EXIT_PULL_FAILED, "got", code)
+	}
+
+	/* A pull failing while the container starts is still a pull failure */
+	if code := exitCode(withExitCode(EXIT_START_FAILED, pull)); code != EXIT_PULL_FAILED {
+		t.Fatal("Expected the first class to stick, got", code)
+	}
+}
+
+func TestExitCodePullFailed(t *testing.T) {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/images/create") {
+			http.Error(w, `{"message": "manifest unknown"}`, http.StatusNotFound)
+			return
+		}
+		http.NotFound(w, r)
+	}).Client
+
+	c := &Context{Client: client, PullPolicy: PULL_MISSING, Args: []string{"busybox"}}
+	err := ensureImage(c)
+	if err == nil {
+		t.Fatal("Expected the pull to fail")
+	}
+	if code := exitCode(err); code != EXIT_PULL_FAILED {
+		t.Fatal("Expected", EXIT_PULL_FAILED, "got", code, err)
+	}
+}
+
+func TestExitCodeDaemonUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	client, err := newTestClient(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	_, err = client.Ping(rootContext(&Context{}))
+	if err == nil {
+		t.Fatal("Expected the daemon to be unreachable")
+	}
+	if code := exitCode(withExitCode(EXIT_START_FAILED, err)); code != EXIT_DAEMON_UNREACHABLE {
+		t.Fatal("Expected", EXIT_DAEMON_UNREACHABLE, "got", code, err)
+	}
+}
+
+func TestRunExitStatus(t *testing.T) {
+	if code, sig := runExitStatus(&Context{}, nil); code != 0 || sig != 0 {
+		t.Fatal("Expected a clean exit, got", code, sig)
+	}
+	if code, sig := runExitStatus(&Context{ExitCode: 3}, nil); code != EXIT_CONTAINER_FAILED || sig != 0 {
+		t.Fatal("Expected", EXIT_CONTAINER_FAILED, "got", code, sig)
+	}
+	if code, _ := runExitStatus(&Context{ExitCode: 137}, ErrOOMKilled); code != EXIT_OOM_KILLED {
+		t.Fatal("Expected", EXIT_OOM_KILLED, "got", code)
+	}
+	if code, _ := runExitStatus(&Context{}, ErrStartTimeout); code != EXIT_START_TIMEOUT {
+		t.Fatal("Expected", EXIT_START_TIMEOUT, "got", code)
+	}
+
+	/* Windows has no signals to die from */
+	if expected, ok := exitSignal(137); ok {
+		if code, sig := runExitStatus(&Context{ExitCode: 137}, nil); code != 137 || sig != expected {
+			t.Fatal("Expected to die from", expected, "got", code, sig)
+		}
+	}
+}
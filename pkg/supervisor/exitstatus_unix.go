@@ -0,0 +1,53 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+/* Docker reports a container killed by signal N as exit code 128+N.  We die
+ * from the same signal, so systemd records signal=KILL instead of a plain
+ * failure and Restart=on-abnormal and friends work as expected. */
+
+func exitSignal(code int) (syscall.Signal, bool) {
+	if code <= 128 || code > 128+64 {
+		return 0, false
+	}
+
+	sig := syscall.Signal(code - 128)
+	switch sig {
+	case syscall.SIGCHLD, syscall.SIGURG, syscall.SIGWINCH, syscall.SIGCONT,
+		syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+		/* Wouldn't terminate us */
+		return 0, false
+	}
+
+	return sig, true
+}
+
+/* killedBy is whether the go runtime lets sig kill us once nobody is
+ * notified of it.  It ignores the others or turns them into a traceback and
+ * exit code 2, those exit with docker's 128+N instead. */
+func killedBy(sig syscall.Signal) bool {
+	switch sig {
+	case unix.SIGHUP, unix.SIGINT, unix.SIGTERM, unix.SIGKILL:
+		return true
+	}
+	return false
+}
+
+func dieFromSignal(sig syscall.Signal) {
+	if killedBy(sig) {
+		signal.Reset(sig)
+		unix.Kill(unix.Getpid(), sig)
+		time.Sleep(time.Second)
+	}
+
+	os.Exit(128 + int(sig))
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestExitSignal(t *testing.T) {
+	sig, ok := exitSignal(137)
+	if !ok || sig != syscall.SIGKILL {
+		t.Fatal("Expected SIGKILL, got", sig)
+	}
+
+	sig, ok = exitSignal(139)
+	if !ok || sig != syscall.SIGSEGV {
+		t.Fatal("Expected SIGSEGV, got", sig)
+	}
+
+	for _, code := range []int{0, 1, 128, 128 + int(syscall.SIGCHLD), 255} {
+		if _, ok := exitSignal(code); ok {
+			t.Fatal("Exit code is not a signal", code)
+		}
+	}
+}
+
+/* dieInHelper runs dieFromSignal(sig) in a copy of the test binary */
+func dieInHelper(t *testing.T, sig syscall.Signal) syscall.WaitStatus {
+	cmd := exec.Command(os.Args[0], "-test.run=TestExitSignalDie")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("TEST_DIE_FROM_SIGNAL=%d", sig))
+	err := cmd.Run()
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatal("Expected the helper to die, got", err)
+	}
+	return exitErr.Sys().(syscall.WaitStatus)
+}
+
+func TestExitSignalDie(t *testing.T) {
+	if sig, err := strconv.Atoi(os.Getenv("TEST_DIE_FROM_SIGNAL")); err == nil {
+		dieFromSignal(syscall.Signal(sig))
+		return
+	}
+
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGKILL} {
+		status := dieInHelper(t, sig)
+		if !status.Signaled() || status.Signal() != sig {
+			t.Fatal("Expected death by", sig, "got", status)
+		}
+	}
+
+	/* The go runtime would print a traceback for it */
+	status := dieInHelper(t, syscall.SIGSEGV)
+	if status.Signaled() || status.ExitStatus() != 128+int(syscall.SIGSEGV) {
+		t.Fatal("Expected exit code 139, got", status)
+	}
+}
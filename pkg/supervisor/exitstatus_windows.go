@@ -0,0 +1,17 @@
+package supervisor
+
+import (
+	"os"
+	"syscall"
+)
+
+/* Windows has no signals to die from, a container killed by one exits with
+ * docker's 128+N like any other exit code */
+
+func exitSignal(code int) (syscall.Signal, bool) {
+	return 0, false
+}
+
+func dieFromSignal(sig syscall.Signal) {
+	os.Exit(128 + int(sig))
+}
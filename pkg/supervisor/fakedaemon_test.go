@@ -0,0 +1,170 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerImage "github.com/docker/docker/api/types/image"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* Fake daemons for the tests.  Code that goes through ContainerRuntime is
+ * tested against runtime.Mock, fakeDaemon answers what still needs the
+ * client. */
+
+/* newTestClient talks to a fake daemon at a fixed API version, without
+ * negotiating first */
+func newTestClient(server *httptest.Server) (*dockerClient.Client, error) {
+	return dockerClient.NewClientWithOpts(
+		dockerClient.WithHost("tcp://"+server.Listener.Addr().String()),
+		dockerClient.WithVersion("1.41"),
+	)
+}
+
+/* fakeRequest is a request as the fake daemon received it */
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   string
+}
+
+/* fakeDaemon records every request and answers it with the test's handler,
+ * without one every request succeeds with no content */
+type fakeDaemon struct {
+	Client *dockerClient.Client
+
+	lock     sync.Mutex
+	received []fakeRequest
+}
+
+func newFakeDaemon(t *testing.T, handler http.HandlerFunc) *fakeDaemon {
+	d := &fakeDaemon{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		d.lock.Lock()
+		d.received = append(d.received, fakeRequest{r.Method, r.URL.Path, r.URL.Query(), string(body)})
+		d.lock.Unlock()
+
+		if handler == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := newTestClient(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Client = client
+	return d
+}
+
+/* requests are the requests so far as "METHOD path" */
+func (d *fakeDaemon) requests() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	requests := []string{}
+	for _, request := range d.received {
+		requests = append(requests, request.Method+" "+request.Path)
+	}
+	return requests
+}
+
+func (d *fakeDaemon) calls() []fakeRequest {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]fakeRequest{}, d.received...)
+}
+
+/* pulled lists the images pulled from daemon as name:tag */
+func pulled(daemon *fakeDaemon) []string {
+	pulls := []string{}
+	for _, call := range daemon.calls() {
+		if strings.HasSuffix(call.Path, "/images/create") {
+			pulls = append(pulls, call.Query.Get("fromImage")+":"+call.Query.Get("tag"))
+		}
+	}
+	return pulls
+}
+
+func mockContext(policy string) (*Context, *runtime.Mock) {
+	m := runtime.NewMock()
+	m.Add(&runtime.Container{ID: "abc", State: runtime.State{Running: true}, RestartPolicy: runtime.RestartPolicy{Name: policy}})
+	container, _ := m.Inspect(context.Background(), "abc")
+	return &Context{Id: "abc", Pid: container.State.Pid, Runtime: m, PollInterval: 20 * time.Millisecond}, m
+}
+
+/* mockDaemon answers the API calls the supervisor makes through the client
+ * rather than the runtime, inspect, start, stats and image inspect, from the
+ * containers of m */
+func mockDaemon(t *testing.T, m *runtime.Mock) *dockerClient.Client {
+	return newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1.41/images/") && strings.HasSuffix(r.URL.Path, "/json") {
+			image := m.Image()
+			if len(image) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(dockerImage.InspectResponse{ID: image})
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1.41/containers/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+
+		id := parts[0]
+		switch parts[1] {
+		case "json":
+			container, err := m.Inspect(r.Context(), id)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(dockerContainer.InspectResponse{
+				ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+					ID:    container.ID,
+					Image: container.Image,
+					State: &dockerContainer.State{
+						Running:   container.State.Running,
+						OOMKilled: container.State.OOMKilled,
+						Pid:       container.State.Pid,
+						ExitCode:  container.State.ExitCode,
+					},
+					HostConfig: &dockerContainer.HostConfig{},
+				},
+				Config: &dockerContainer.Config{},
+			})
+		case "stats":
+			w.Write([]byte("{}"))
+		case "start":
+			err := m.Start(r.Context(), id)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}).Client
+}
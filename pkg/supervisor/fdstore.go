@@ -0,0 +1,146 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+	"github.com/oott123/systemd-docker/pkg/notify"
+)
+
+/* If the unit has FileDescriptorStoreMax= set, systemd keeps a descriptor
+ * holding our state across restarts of systemd-docker itself.  On start we
+ * look for it and re-adopt the container instead of launching a new one.
+ *
+ * Only the state goes into the store.  The attach and events streams are
+ * HTTP responses the docker client reads through its own buffers, a new
+ * process can't pick one up mid-frame, so they are opened again. */
+
+const stateFdName = "state"
+
+/* SD_LISTEN_FDS_START, tests move it past the descriptors they have open */
+var listenFdsStart = 3
+
+type storedState struct {
+	Id   string
+	Name string
+}
+
+func storeState(c *Context) error {
+	if len(c.NotifySocket) == 0 || len(c.Id) == 0 {
+		return nil
+	}
+
+	/* FDSTORE=1 adds another descriptor under the same name, a recreated
+	 * container would leave the old state to be restored */
+	err := forgetState(c)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "systemd-docker-state")
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	os.Remove(f.Name())
+
+	err = json.NewEncoder(f).Encode(storedState{
+		Id:   c.Id,
+		Name: c.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendNotifyFds(c, []int{int(f.Fd())}, "FDSTORE=1\nFDNAME="+stateFdName)
+}
+
+func forgetState(c *Context) error {
+	return sendNotify(c, "FDSTOREREMOVE=1\nFDNAME="+stateFdName)
+}
+
+func sendNotifyFds(c *Context, fds []int, message string) error {
+	logDebug("Notify:", message, "fds", fds)
+	return notify.SendFds(c.NotifySocket, fds, message)
+}
+
+/* notifyBarrier waits until systemd has processed everything we sent so far.
+ * systemd closes the pipe it gets with BARRIER=1 once it is through the
+ * messages before it, older versions close it right away. */
+func notifyBarrier(c *Context) error {
+	return notify.Barrier(c.NotifySocket, NOTIFY_BARRIER_TIMEOUT)
+}
+
+/* listenFd is the descriptor systemd passed us under name.  Only that one
+ * gets an *os.File, whose finalizer would close it, the others are left be. */
+func listenFd(name string) *os.File {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil
+	}
+
+	var f *os.File
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		closeOnExec(fd)
+
+		if f == nil && i < len(names) && names[i] == name {
+			f = os.NewFile(uintptr(fd), name)
+		}
+	}
+
+	return f
+}
+
+func restoreState(c *Context) error {
+	f := listenFd(stateFdName)
+	if f == nil {
+		return nil
+	}
+
+	defer f.Close()
+
+	_, err := f.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+
+	state := storedState{}
+	err = json.NewDecoder(f).Decode(&state)
+	if err != nil {
+		return err
+	}
+
+	if len(c.Name) > 0 && state.Name != c.Name {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, state.Id)
+	if dockerx.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if container.State.Running {
+		adoptContainer(c, container)
+	}
+
+	return nil
+}
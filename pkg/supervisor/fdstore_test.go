@@ -0,0 +1,145 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* notifyListener stands in for systemd's notification socket */
+func notifyListener(t *testing.T) (*net.UnixConn, string) {
+	socket := path.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, socket
+}
+
+/* readNotify returns the next message and the descriptors passed with it */
+func readNotify(t *testing.T, conn *net.UnixConn) (string, []int) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(4*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds := []int{}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		rights, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds = append(fds, rights...)
+	}
+	return string(buf[:n]), fds
+}
+
+/* passFds sets the environment systemd starts us with, fds[i] shows up as
+ * listenFdsStart+i */
+func passFds(t *testing.T, fds []int, names string) {
+	start := 100
+	for i, fd := range fds {
+		err := syscall.Dup2(fd, start+i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { syscall.Close(start + i) })
+	}
+
+	old := listenFdsStart
+	listenFdsStart = start
+	t.Cleanup(func() { listenFdsStart = old })
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", strconv.Itoa(len(fds)))
+	t.Setenv("LISTEN_FDNAMES", names)
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	conn, socket := notifyListener(t)
+
+	c := &Context{NotifySocket: socket, Id: "abc", Name: "web"}
+	err := storeState(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, fds := readNotify(t, conn)
+	if msg != "FDSTOREREMOVE=1\nFDNAME=state" || len(fds) != 0 {
+		t.Fatal("Expected the old state to be removed first, got", msg, fds)
+	}
+	msg, fds = readNotify(t, conn)
+	if msg != "FDSTORE=1\nFDNAME=state" || len(fds) != 1 {
+		t.Fatal("Expected the state to be stored, got", msg, fds)
+	}
+	defer syscall.Close(fds[0])
+
+	/* An unrelated descriptor ahead of ours must stay open */
+	other, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	passFds(t, []int{int(other.Fd()), fds[0]}, "other:state")
+
+	m := runtime.NewMock()
+	m.Add(&runtime.Container{ID: "abc", State: runtime.State{Running: true}})
+	c = &Context{Name: "web", Client: mockDaemon(t, m)}
+	err = restoreState(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Id != "abc" || c.Pid == 0 {
+		t.Fatal("Expected the container to be re-adopted", c.Id, c.Pid)
+	}
+
+	var stat syscall.Stat_t
+	if syscall.Fstat(listenFdsStart, &stat) != nil {
+		t.Fatal("The other passed descriptor was closed")
+	}
+}
+
+func TestStateOtherName(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(`{"Id":"abc","Name":"web"}`)
+	passFds(t, []int{int(f.Fd())}, "state")
+
+	m := runtime.NewMock()
+	m.Add(&runtime.Container{ID: "abc", State: runtime.State{Running: true}})
+	c := &Context{Name: "db", Client: mockDaemon(t, m)}
+	err = restoreState(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Id) > 0 {
+		t.Fatal("Adopted the container of another name", c.Id)
+	}
+}
+
+func TestListenFdMissing(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "state")
+	if listenFd(stateFdName) != nil {
+		t.Fatal("Descriptors passed to another pid are not ours")
+	}
+}
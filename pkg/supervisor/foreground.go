@@ -0,0 +1,136 @@
+package supervisor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* --foreground runs docker run without -d instead of docker create and a
+ * start through the API.  The docker CLI stays our child, proxying signals
+ * and writing the container's output itself, and we find its container
+ * through the cidfile. */
+
+var foregroundPollInterval = 50 * time.Millisecond
+
+func checkForeground(c *Context) error {
+	if !c.Foreground {
+		return nil
+	}
+	if c.Attach {
+		return errors.New("--foreground and --attach can't be used together")
+	}
+	if c.Checkpoint {
+		return errors.New("--foreground and --checkpoint can't be used together")
+	}
+	return nil
+}
+
+func readCidFile(file string) string {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes))
+}
+
+func runForeground(c *Context) error {
+	args := append(cgroupParentArgs(c), restartArgs(c)...)
+	args = append(args, createArgs(c.Args)...)
+
+	cidfile, ok := argValue(args, "--cidfile")
+	if !ok {
+		dir, err := ioutil.TempDir("", "systemd-docker")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		cidfile = path.Join(dir, "cid")
+		args = append([]string{"--cidfile", cidfile}, args...)
+	}
+
+	c.Cmd = exec.Command("docker", append([]string{"run"}, args...)...)
+	c.Cmd.Env = append(os.Environ(), "DOCKER_HOST="+dockerHost())
+	c.Cmd.Stdout = os.Stdout
+	c.Cmd.Stderr = os.Stderr
+	if c.Stdin {
+		c.Cmd.Stdin = os.Stdin
+	}
+
+	err := c.Cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	var runErr error
+	done := make(chan struct{})
+	go func() {
+		runErr = c.Cmd.Wait()
+		close(done)
+	}()
+
+	/* docker run writes the cidfile once the container is created, a failed
+	 * pull or create exits without one */
+	for len(c.Id) == 0 {
+		select {
+		case <-done:
+			c.Id = readCidFile(cidfile)
+			if len(c.Id) == 0 {
+				if runErr == nil {
+					runErr = errors.New("docker run exited without creating a container")
+				}
+				return runErr
+			}
+		case <-rootContext(c).Done():
+			return rootContext(c).Err()
+		case <-time.After(foregroundPollInterval):
+			c.Id = readCidFile(cidfile)
+		}
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	for {
+		container, err := inspectContainer(c, client, c.Id)
+		if err != nil {
+			return err
+		}
+
+		if container.State.Running || !dockerx.StartedAt(container).IsZero() {
+			err = verifyDigest(c, container)
+			if err != nil {
+				return err
+			}
+
+			setContainerState(c, container)
+			if !container.State.Running {
+				c.Exited = true
+				c.ExitCode = container.State.ExitCode
+				c.Pid = 0
+			}
+			c.Attached = true
+			return nil
+		}
+
+		select {
+		case <-done:
+			if runErr == nil {
+				runErr = errors.New("docker run exited without starting the container")
+			}
+			return runErr
+		case <-rootContext(c).Done():
+			return rootContext(c).Err()
+		case <-time.After(foregroundPollInterval):
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeDocker(t *testing.T, script string) string {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	err := ioutil.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\necho \"$@\" > "+calls+"\n"+script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+func foregroundContext(t *testing.T, args ...string) *Context {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id": "abc", "State": {"Running": true, "Pid": 42, "StartedAt": "2024-01-01T00:00:00Z"}}`))
+	}).Client
+
+	return &Context{Client: client, Args: args, Foreground: true}
+}
+
+func TestRunForeground(t *testing.T) {
+	calls := fakeDocker(t, `while [ $# -gt 0 ]; do
+	[ "$1" = "--cidfile" ] && echo abc > "$2"
+	shift
+done
+sleep 0.2
+`)
+
+	c := foregroundContext(t, "-d", "busybox")
+	err := runForeground(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Id != "abc" || c.Pid != 42 || !c.Attached {
+		t.Fatal("Bad container state", c.Id, c.Pid, c.Attached)
+	}
+
+	bytes, _ := ioutil.ReadFile(calls)
+	args := strings.TrimSpace(string(bytes))
+	if !strings.HasPrefix(args, "run --cidfile ") || !strings.HasSuffix(args, " busybox") || strings.Contains(args, " -d ") {
+		t.Fatal("Bad docker run", args)
+	}
+}
+
+func TestRunForegroundFailed(t *testing.T) {
+	fakeDocker(t, "exit 125\n")
+
+	err := runForeground(foregroundContext(t, "busybox"))
+	if err == nil {
+		t.Fatal("Expected error from docker run")
+	}
+}
+
+func TestParseForeground(t *testing.T) {
+	c, err := Parse([]string{"--foreground", "--default-name=false", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findRunFlag(c.Args, "detach"); ok {
+		t.Fatal("-d added in the foreground", c.Args)
+	}
+
+	if _, err := Parse([]string{"--foreground", "--attach", "run", "busybox"}); err == nil {
+		t.Fatal("Expected error for --foreground with --attach")
+	}
+}
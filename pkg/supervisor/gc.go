@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"fmt"
+	"strings"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerFilters "github.com/docker/docker/api/types/filters"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* Renaming a container or a template instance leaves the old stopped
+ * container behind, nothing looks it up by its old name again.  With --gc
+ * stopped containers labeled with the unit are removed at start, unless they
+ * are the one we would start again: same name, same run arguments.  Without
+ * --name every start creates a new container, so all of them go. */
+
+/* garbage are the stopped containers of the unit we would never use again */
+func garbage(containers []dockerContainer.Summary, name string, hash string) []string {
+	ids := []string{}
+	for _, container := range containers {
+		if container.State == "running" || container.State == "paused" || container.State == "restarting" {
+			continue
+		}
+
+		named := false
+		for _, n := range container.Names {
+			named = named || (len(name) > 0 && strings.TrimPrefix(n, "/") == name)
+		}
+		current, ok := container.Labels[LABEL_CONFIG]
+		if named && (!ok || current == hash) {
+			continue
+		}
+
+		ids = append(ids, container.ID)
+	}
+	return ids
+}
+
+func collectGarbage(c *Context) error {
+	if !c.Gc {
+		return nil
+	}
+
+	unit := unitName(c)
+	if len(unit) == 0 {
+		logWarn("Not running in a unit, can't look for containers --gc would remove")
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	containers, err := client.ContainerList(ctx, dockerContainer.ListOptions{
+		All:     true,
+		Filters: dockerFilters.NewArgs(dockerFilters.Arg("label", LABEL_UNIT+"="+unit)),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range garbage(containers, c.Name, c.ConfigHash) {
+		logInfo(fmt.Sprintf("Removing container %s a previous configuration of %s left behind", shortId(id), unit))
+		err = client.ContainerRemove(ctx, id, dockerContainer.RemoveOptions{})
+		if err != nil && !dockerx.IsNotFound(err) {
+			logWarn("Failed to remove container", shortId(id), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func TestGarbage(t *testing.T) {
+	containers := []dockerContainer.Summary{
+		{ID: "current", Names: []string{"/web"}, State: "exited", Labels: map[string]string{LABEL_CONFIG: "new"}},
+		{ID: "renamed", Names: []string{"/web-old"}, State: "exited", Labels: map[string]string{LABEL_CONFIG: "new"}},
+		{ID: "changed", Names: []string{"/web"}, State: "created", Labels: map[string]string{LABEL_CONFIG: "old"}},
+		{ID: "unlabeled", Names: []string{"/web"}, State: "exited"},
+		{ID: "running", Names: []string{"/web-old"}, State: "running"},
+	}
+
+	ids := garbage(containers, "web", "new")
+	if strings.Join(ids, ",") != "renamed,changed" {
+		t.Fatal("Expected renamed and changed, got", ids)
+	}
+
+	ids = garbage(containers, "", "")
+	if strings.Join(ids, ",") != "current,renamed,changed,unlabeled" {
+		t.Fatal("Without a name every stopped container is garbage, got", ids)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/containers/json") {
+			if !strings.Contains(r.URL.Query().Get("filters"), LABEL_UNIT+"=web.service") {
+				t.Error("Expected a filter on the unit label", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode([]dockerContainer.Summary{
+				{ID: "old", Names: []string{"/web-1"}, State: "exited"},
+				{ID: "ours", Names: []string{"/web"}, State: "exited"},
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	c := &Context{Client: daemon.Client, Unit: "web.service", Name: "web"}
+	err := collectGarbage(c)
+	if err != nil || len(daemon.requests()) > 0 {
+		t.Fatal("Expected nothing without --gc", daemon.requests(), err)
+	}
+
+	c.Gc = true
+	err = collectGarbage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(daemon.requests(), ",") != "GET /v1.41/containers/json,DELETE /v1.41/containers/old" {
+		t.Fatal("Expected only the old container to be removed", daemon.requests())
+	}
+}
@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+/* GPU containers fail with opaque errors when the driver isn't loaded yet
+ * (early at boot) or the runtime isn't set up, check first */
+
+var (
+	nvidiaDevice = "/dev/nvidiactl"
+	nvidiaHook   = "nvidia-container-runtime-hook"
+)
+
+/* gpuRequirements returns whether the run args ask for GPUs and which
+ * runtime they need, if any */
+func gpuRequirements(args []string) (bool, string) {
+	flags, _ := parseRunArgs(args)
+
+	gpus := false
+	runtime := ""
+	for _, f := range flags {
+		switch f.Name {
+		case "gpus":
+			gpus = true
+		case "runtime":
+			runtime = f.Value
+		}
+	}
+
+	return gpus || runtime == "nvidia", runtime
+}
+
+func checkGpu(c *Context, gpus bool, runtime string) error {
+	if len(runtime) > 0 {
+		client, err := getClient(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := apiContext(c)
+		info, err := client.Info(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := info.Runtimes[runtime]; !ok {
+			return errors.New(fmt.Sprintf("The docker daemon has no %s runtime", runtime))
+		}
+	}
+
+	if !gpus {
+		return nil
+	}
+
+	if _, err := os.Stat(nvidiaDevice); err != nil {
+		return errors.New(fmt.Sprintf("The GPU driver is not loaded, %s is missing", nvidiaDevice))
+	}
+
+	if runtime != "nvidia" {
+		if _, err := exec.LookPath(nvidiaHook); err != nil {
+			return errors.New(fmt.Sprintf("--gpus needs the NVIDIA container toolkit, %s is missing", nvidiaHook))
+		}
+	}
+
+	return nil
+}
+
+/* gpuPreflight fails if the GPU setup isn't there, after waiting up to
+ * --gpu-wait for it to appear */
+func gpuPreflight(c *Context) error {
+	gpus, runtime := gpuRequirements(c.Args)
+	if !gpus && len(runtime) == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(c.GpuWait)
+	for {
+		err := checkGpu(c, gpus, runtime)
+		if err == nil || !time.Now().Before(deadline) {
+			return err
+		}
+
+		sendNotify(c, "STATUS=Waiting for GPU: "+err.Error())
+		logDebug("Waiting for GPU:", err)
+		if sleepContext(c, pollInterval(c)) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGpuRequirements(t *testing.T) {
+	gpus, runtime := gpuRequirements([]string{"--gpus", "all", "cuda", "--runtime=nvidia"})
+	if !gpus || runtime != "" {
+		t.Fatal("Bad requirements", gpus, runtime)
+	}
+
+	gpus, runtime = gpuRequirements([]string{"--runtime=nvidia", "cuda"})
+	if !gpus || runtime != "nvidia" {
+		t.Fatal("Bad requirements", gpus, runtime)
+	}
+
+	gpus, runtime = gpuRequirements([]string{"--runtime", "runsc", "busybox"})
+	if gpus || runtime != "runsc" {
+		t.Fatal("Bad requirements", gpus, runtime)
+	}
+}
+
+func TestGpuPreflight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Runtimes": {"runc": {"path": "runc"}, "nvidia": {"path": "nvidia-container-runtime"}}}`))
+	}).Client
+
+	device, hook := nvidiaDevice, nvidiaHook
+	defer func() {
+		nvidiaDevice, nvidiaHook = device, hook
+	}()
+	nvidiaDevice = dir + "/nvidiactl"
+	nvidiaHook = "sh"
+
+	c := &Context{Args: []string{"--gpus", "all", "cuda"}, Client: client}
+	if gpuPreflight(c) == nil {
+		t.Fatal("Expected a missing driver to fail")
+	}
+
+	/* The driver shows up while we wait */
+	c.GpuWait = 5 * time.Second
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		ioutil.WriteFile(nvidiaDevice, nil, 0644)
+	}()
+	if err := gpuPreflight(c); err != nil {
+		t.Fatal(err)
+	}
+
+	c = &Context{Args: []string{"--runtime=kata", "busybox"}, Client: client}
+	if gpuPreflight(c) == nil {
+		t.Fatal("Expected a missing runtime to fail")
+	}
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+/* With a HEALTHCHECK the output of its latest run goes to STATUS=, so
+ * systemctl status shows why a container is (un)healthy */
+
+const HEALTH_STATUS_LENGTH = 80
+
+/* lastOutputLine is the last non empty line the health check printed,
+ * truncated to fit a status line */
+func lastOutputLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+
+	if utf8.RuneCountInString(line) > HEALTH_STATUS_LENGTH {
+		line = string([]rune(line)[:HEALTH_STATUS_LENGTH-3]) + "..."
+	}
+	return line
+}
+
+func healthStatusMessage(container *dockerContainer.InspectResponse) (string, bool) {
+	if container.State == nil || container.State.Health == nil || len(container.State.Health.Log) == 0 {
+		return "", false
+	}
+
+	health := container.State.Health
+	probe := health.Log[len(health.Log)-1]
+
+	output := lastOutputLine(probe.Output)
+	if len(output) == 0 {
+		output = fmt.Sprintf("exit code %d", probe.ExitCode)
+	}
+
+	took := ""
+	if !probe.Start.IsZero() && probe.End.After(probe.Start) {
+		took = " in " + probe.End.Sub(probe.Start).Round(time.Millisecond).String()
+	}
+
+	return fmt.Sprintf("%s: %s%s", health.Status, output, took), true
+}
+
+/* runHealthStatus keeps STATUS= up to date with the health check, with
+ * --notify the container owns its status */
+func runHealthStatus(c *Context) {
+	if !c.HealthStatus || c.Notify || len(c.NotifySocket) == 0 {
+		return
+	}
+
+	for {
+		client, err := getClient(c)
+		if err == nil {
+			var container *dockerContainer.InspectResponse
+			c.identity.RLock()
+			container, err = inspectContainer(c, client, c.Id)
+			c.identity.RUnlock()
+			if err == nil && container.State.Running {
+				if msg, ok := healthStatusMessage(container); ok {
+					c.status.setHealth(c, msg)
+				}
+			}
+		}
+		if err != nil {
+			logDebug("Failed to read health check output:", err)
+		}
+
+		if sleepContext(c, c.HealthInterval) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func healthContainer(status string, probes ...*dockerContainer.HealthcheckResult) *dockerContainer.InspectResponse {
+	return &dockerContainer.InspectResponse{ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+		State: &dockerContainer.State{Running: true, Health: &dockerContainer.Health{Status: status, Log: probes}},
+	}}
+}
+
+func TestHealthStatusMessage(t *testing.T) {
+	start := time.Unix(1000, 0)
+	container := healthContainer("healthy",
+		&dockerContainer.HealthcheckResult{Output: "old"},
+		&dockerContainer.HealthcheckResult{Start: start, End: start.Add(12 * time.Millisecond), Output: "  % Total\n200 OK\n\n"})
+
+	msg, ok := healthStatusMessage(container)
+	if !ok || msg != "healthy: 200 OK in 12ms" {
+		t.Fatal("Bad status", msg)
+	}
+
+	msg, _ = healthStatusMessage(healthContainer("unhealthy", &dockerContainer.HealthcheckResult{ExitCode: 1}))
+	if msg != "unhealthy: exit code 1" {
+		t.Fatal("Bad status without output", msg)
+	}
+
+	_, ok = healthStatusMessage(healthContainer("starting"))
+	if ok {
+		t.Fatal("Status without a health check run")
+	}
+}
+
+func TestHealthStatusTruncated(t *testing.T) {
+	line := lastOutputLine(strings.Repeat("é", 200))
+	if len([]rune(line)) != HEALTH_STATUS_LENGTH || !strings.HasSuffix(line, "...") {
+		t.Fatal("Bad truncation", line)
+	}
+}
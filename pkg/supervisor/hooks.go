@@ -0,0 +1,163 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+/* Host side commands run at each lifecycle phase.  Like ExecStartPre=, a
+ * command prefixed with - may fail without failing the unit. */
+
+var hookPhases = []string{"pre-start", "post-start", "pre-stop", "post-stop"}
+
+type Hooks struct {
+	Commands map[string]*[]string
+	Timeouts map[string]*time.Duration
+}
+
+func addHookFlags(flags *flag.FlagSet, hooks *Hooks) {
+	hooks.Commands = map[string]*[]string{}
+	hooks.Timeouts = map[string]*time.Duration{}
+
+	for _, phase := range hookPhases {
+		hooks.Commands[phase] = flags.StringArray(phase, nil, "host command to run at "+phase+", prefix with - to ignore failures")
+		hooks.Timeouts[phase] = flags.Duration(phase+"-timeout", 30*time.Second, "timeout for each "+phase+" command")
+	}
+}
+
+func hookEnv(c *Context, phase string) []string {
+	env := append(os.Environ(), "SYSTEMD_DOCKER_PHASE="+phase)
+	if len(c.Id) > 0 {
+		env = append(env, "CONTAINER_ID="+c.Id)
+	}
+	if len(c.Name) > 0 {
+		env = append(env, "CONTAINER_NAME="+c.Name)
+	}
+	if c.Pid > 0 {
+		env = append(env, "CONTAINER_PID="+strconv.Itoa(c.Pid))
+	}
+	return env
+}
+
+func runHook(c *Context, phase string, command string, timeout time.Duration) error {
+	ignoreFailure := strings.HasPrefix(command, "-")
+	command = strings.TrimPrefix(command, "-")
+
+	/* Own process group, so a timeout kills whatever the hook started too */
+	cmd := shellCommand(command)
+	cmd.Env = hookEnv(c, phase)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	logDebug("Running", phase, "hook:", command)
+	err := cmd.Start()
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s hook %q failed: %s", phase, command, err))
+	}
+
+	timedOut := make(chan bool, 1)
+	timer := time.AfterFunc(timeout, func() {
+		timedOut <- true
+		killProcessGroup(cmd)
+	})
+
+	/* Stopping the unit while it starts cuts the start hooks short */
+	starting := phase == "pre-start" || phase == "post-start"
+	done := make(chan struct{})
+	if starting {
+		go func() {
+			select {
+			case <-rootContext(c).Done():
+				killProcessGroup(cmd)
+			case <-done:
+			}
+		}()
+	}
+
+	err = cmd.Wait()
+	timer.Stop()
+	close(done)
+
+	select {
+	case <-timedOut:
+		err = errors.New(fmt.Sprintf("timed out after %s", timeout))
+	default:
+		if starting && err != nil && cancelled(c) {
+			err = rootContext(c).Err()
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	err = errors.New(fmt.Sprintf("%s hook %q failed: %s", phase, command, err))
+	if ignoreFailure {
+		logWarn(err)
+		return nil
+	}
+
+	return err
+}
+
+func runHooks(c *Context, phase string) error {
+	commands := c.Hooks.Commands[phase]
+	if commands == nil {
+		return nil
+	}
+
+	for _, command := range *commands {
+		err := runHook(c, phase, command, *c.Hooks.Timeouts[phase])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* stopOnSignal runs the pre-stop hooks and stops the container when we are
+ * asked to stop, keepAlive then sees the exit and finishes up as usual */
+func stopOnSignal(c *Context, sig os.Signal) {
+	logInfo("Received", sig, "stopping container")
+
+	/* A stop during an update must not bring the container back */
+	atomic.StoreInt32(&c.updating, 0)
+
+	c.identity.RLock()
+	defer c.identity.RUnlock()
+
+	err := runHooks(c, "pre-stop")
+	if err != nil {
+		logError(err)
+	}
+	runPreStopExec(c)
+
+	err = stopContainer(c)
+	if err != nil {
+		logError("Failed to stop container:", err)
+	}
+}
+
+func stopContainer(c *Context) error {
+	rt, err := getRuntime(c)
+	if err != nil {
+		return err
+	}
+
+	timeout := stopTimeout(c)
+	grace := stopGrace(c, timeout)
+
+	if c.Checkpoint && checkpointContainer(c, grace+10*time.Second) {
+		return nil
+	}
+
+	return stopEscalating(c, rt, timeout, grace)
+}
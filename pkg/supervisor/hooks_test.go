@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+
+	c, err := Parse([]string{
+		"--post-start", "echo $SYSTEMD_DOCKER_PHASE $CONTAINER_ID >> " + out,
+		"--post-start", "-exit 1",
+		"--pre-stop", "exit 1",
+		"--pre-stop-timeout", "1s",
+		"run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	c.Id = "abc"
+
+	err = runHooks(c, "post-start")
+	if err != nil {
+		t.Fatal("post-start should pass", err)
+	}
+
+	bytes, _ := ioutil.ReadFile(out)
+	if string(bytes) != "post-start abc\n" {
+		t.Fatal("Bad hook output", string(bytes))
+	}
+
+	if runHooks(c, "pre-stop") == nil {
+		t.Fatal("pre-stop should fail")
+	}
+
+	if runHooks(c, "pre-start") != nil {
+		t.Fatal("no pre-start hooks should pass")
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	c, err := Parse([]string{"--pre-start", "sleep 5", "--pre-start-timeout", "10ms", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if runHooks(c, "pre-start") == nil {
+		t.Fatal("pre-start should time out")
+	}
+}
+
+func TestHookCancelled(t *testing.T) {
+	c, err := Parse([]string{"--pre-start", "sleep 5", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Ctx = ctx
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = runHooks(c, "pre-start")
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatal("pre-start should be cancelled, got", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("Cancelled hook kept running for", time.Since(start))
+	}
+}
@@ -0,0 +1,124 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* An image policy restricts the images units may run, for fleets where units
+ * come from many hands.  It is read from --image-policy, or from
+ * /etc/systemd-docker/image-policy.yml if that exists:
+ *
+ *   allow:
+ *     - ghcr.io/myorg/*
+ *     - docker.io/library/nginx:1.*
+ *   require_digest: true
+ *
+ * Patterns are matched against the full image reference, * matches anything.
+ * A pattern without a tag or digest allows any of them. */
+
+const IMAGE_POLICY_FILE = "/etc/systemd-docker/image-policy.yml"
+
+type imagePolicy struct {
+	Allow         []string
+	RequireDigest bool `yaml:"require_digest"`
+}
+
+/* loadImagePolicy returns nil if there is no policy, a missing file is only
+ * an error if it was asked for */
+func loadImagePolicy(file string) (*imagePolicy, error) {
+	if len(file) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) && file == IMAGE_POLICY_FILE {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	policy := &imagePolicy{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(policy)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid image policy %s: %s", file, err))
+	}
+
+	for _, pattern := range policy.Allow {
+		if len(pattern) == 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid image policy %s: empty allow pattern", file))
+		}
+	}
+
+	return policy, nil
+}
+
+/* normalizeRef spells out what docker fills in for a short reference,
+ * nginx is docker.io/library/nginx:latest */
+func normalizeRef(ref string) string {
+	if registryHost(ref) == dockerHubAuth {
+		if !strings.Contains(ref, "/") {
+			ref = "library/" + ref
+		}
+		ref = "docker.io/" + strings.TrimPrefix(ref, "docker.io/")
+	}
+
+	if len(imageDigest(ref)) == 0 && strings.LastIndex(ref, ":") < strings.LastIndex(ref, "/") {
+		ref += ":latest"
+	}
+	return ref
+}
+
+func patternRegexp(pattern string) *regexp.Regexp {
+	expr := strings.Replace(regexp.QuoteMeta(pattern), `\*`, `.*`, -1)
+
+	/* Without a tag or digest, any of them */
+	last := pattern[strings.LastIndex(pattern, "/")+1:]
+	if !strings.ContainsAny(last, ":@") {
+		expr += `([:@].*)?`
+	}
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+func (policy *imagePolicy) check(ref string) error {
+	if policy.RequireDigest && !strings.HasPrefix(imageDigest(ref), "sha256:") {
+		return errors.New(fmt.Sprintf("Image %s is not pinned by digest (name@sha256:...), which the image policy requires", ref))
+	}
+
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+
+	normalized := normalizeRef(ref)
+	for _, pattern := range policy.Allow {
+		if patternRegexp(pattern).MatchString(normalized) || patternRegexp(pattern).MatchString(ref) {
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("Image %s is not allowed by the image policy", normalized))
+}
+
+func checkImagePolicy(file string, refs ...string) error {
+	policy, err := loadImagePolicy(file)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		err = policy.check(ref)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s, see %s", err, file))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeImagePolicy(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := path.Join(dir, "image-policy.yml")
+	err = ioutil.WriteFile(file, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestNormalizeRef(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                     "docker.io/library/nginx:latest",
+		"nginx:1.25":                "docker.io/library/nginx:1.25",
+		"myorg/app@sha256:abc":      "docker.io/myorg/app@sha256:abc",
+		"docker.io/myorg/app:2":     "docker.io/myorg/app:2",
+		"registry.local:5000/app":   "registry.local:5000/app:latest",
+		"ghcr.io/myorg/team/app:v1": "ghcr.io/myorg/team/app:v1",
+	}
+
+	for ref, expected := range tests {
+		if normalized := normalizeRef(ref); normalized != expected {
+			t.Fatal("Expected", expected, "for", ref, "got", normalized)
+		}
+	}
+}
+
+func TestImagePolicy(t *testing.T) {
+	policy := &imagePolicy{Allow: []string{"ghcr.io/myorg/*", "docker.io/library/nginx:1.*", "registry.local:5000/app"}}
+
+	for _, ref := range []string{"ghcr.io/myorg/app:1", "ghcr.io/myorg/team/app@sha256:abc", "nginx:1.25", "registry.local:5000/app", "registry.local:5000/app:2"} {
+		if err := policy.check(ref); err != nil {
+			t.Fatal("Expected", ref, "to be allowed", err)
+		}
+	}
+
+	for _, ref := range []string{"ghcr.io/other/app:1", "nginx", "nginx:2", "busybox", "registry.local:5000/application"} {
+		if err := policy.check(ref); err == nil {
+			t.Fatal("Expected", ref, "to be refused")
+		}
+	}
+
+	policy.RequireDigest = true
+	if err := policy.check("ghcr.io/myorg/app:1"); err == nil {
+		t.Fatal("Expected a tag to be refused with require_digest")
+	}
+	if err := policy.check("ghcr.io/myorg/app@sha256:abc"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseImagePolicy(t *testing.T) {
+	file := writeImagePolicy(t, "allow:\n  - ghcr.io/myorg/*\n")
+
+	_, err := Parse([]string{"--image-policy", file, "run", "busybox"})
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatal("Expected busybox to be refused", err)
+	}
+
+	_, err = Parse([]string{"--image-policy", file, "run", "--rm", "ghcr.io/myorg/app:1", "sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Parse([]string{"--image-policy", "/nonexistent.yml", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected a missing policy given explicitly to fail")
+	}
+
+	_, err = Parse([]string{"--image-policy", writeImagePolicy(t, "allowed: []\n"), "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected unknown keys to be refused")
+	}
+}
+
+func TestComposeImagePolicy(t *testing.T) {
+	p, err := loadTestCompose(t, testCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := writeImagePolicy(t, "allow:\n  - nginx\n  - postgres:16\n")
+	err = checkImagePolicy(file, p.serviceImages()...)
+	if err == nil || !strings.Contains(err.Error(), "docker.io/library/app:1") {
+		t.Fatal("Expected app:1 to be refused", err)
+	}
+}
@@ -0,0 +1,134 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var journalSocket = "/run/systemd/journal/socket"
+
+/* journalSend writes a structured entry using journald's native protocol,
+ * fields are upper case KEY=value pairs, MESSAGE and PRIORITY included */
+func journalSend(fields map[string]string) error {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write(journalEntry(fields))
+	return err
+}
+
+func journalEntry(fields map[string]string) []byte {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	for _, key := range keys {
+		value := fields[key]
+		if !strings.Contains(value, "\n") {
+			buf.WriteString(key + "=" + value + "\n")
+			continue
+		}
+
+		/* Multi line values are sent as KEY\n<64 bit little endian length>value\n */
+		buf.WriteString(key + "\n")
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+/* Key events carry a fixed MESSAGE_ID, like the entries of systemd's
+ * catalog, so monitoring can match them however the message is worded:
+ * journalctl MESSAGE_ID=2ac5e25fbc3dff139aa05dfa53c9d30d */
+const (
+	MESSAGE_CONTAINER_STARTED = "2ac5e25fbc3dff139aa05dfa53c9d30d"
+	MESSAGE_CONTAINER_EXITED  = "fba9f2e4c3265cd321f4d01b43b3159c"
+	MESSAGE_PULL_FAILED       = "92b81209f3ddccbefcb6ab7f5e836dec"
+	MESSAGE_NOTIFY_FAILED     = "0a6c83c8935bdcd99f5fbaef08e951a3"
+	MESSAGE_OOM_KILLED        = "03806f44339b6a1f3bed1d2b6c8950ac"
+)
+
+/* syslog priorities of our log levels */
+var journalPriorities = []string{"3", "4", "6", "7"}
+
+/* journalEvent logs msg at level as a structured entry carrying messageId
+ * and the container fields.  Only when our stderr goes to the journal
+ * anyway, otherwise and if the journal can't be reached msg is logged as
+ * usual. */
+func journalEvent(c *Context, level int, messageId string, msg string, fields map[string]string) {
+	if level > selfLogLevel {
+		return
+	}
+
+	entry := map[string]string{
+		"MESSAGE":           msg,
+		"MESSAGE_ID":        messageId,
+		"PRIORITY":          journalPriorities[level],
+		"SYSLOG_IDENTIFIER": "systemd-docker",
+	}
+	if len(c.Id) > 0 {
+		entry["CONTAINER_ID"] = c.Id
+	}
+	if len(c.Name) > 0 {
+		entry["CONTAINER_NAME"] = c.Name
+	}
+	if image := imageRef(c.Args); len(image) > 0 {
+		entry["IMAGE"] = image
+	}
+	for key, value := range fields {
+		entry[key] = value
+	}
+
+	if len(os.Getenv("JOURNAL_STREAM")) == 0 || journalSend(entry) != nil {
+		logAt(level, msg)
+	}
+}
+
+func startedEvent(c *Context) {
+	journalEvent(c, LOG_INFO, MESSAGE_CONTAINER_STARTED, fmt.Sprintf("Container %s running with pid %d", shortId(c.Id), c.Pid), map[string]string{
+		"CONTAINER_PID": strconv.Itoa(c.Pid),
+	})
+}
+
+func exitedEvent(c *Context, msg string) {
+	level := LOG_INFO
+	if c.ExitCode != 0 {
+		level = LOG_WARN
+	}
+	journalEvent(c, level, MESSAGE_CONTAINER_EXITED, msg, map[string]string{
+		"CONTAINER_EXIT_CODE": strconv.Itoa(c.ExitCode),
+	})
+}
+
+/* pullFailed is the event, the error itself is still returned */
+func pullFailed(c *Context, ref string, err error) {
+	if cancelled(c) {
+		return
+	}
+	journalEvent(c, LOG_ERROR, MESSAGE_PULL_FAILED, fmt.Sprintf("Pulling %s failed", ref), map[string]string{
+		"IMAGE": ref,
+		"ERROR": err.Error(),
+	})
+}
+
+func notifyFailed(c *Context, err error) error {
+	journalEvent(c, LOG_ERROR, MESSAGE_NOTIFY_FAILED, fmt.Sprintf("Notifying systemd through %s failed", c.NotifySocket), map[string]string{
+		"NOTIFY_SOCKET": c.NotifySocket,
+		"ERROR":         err.Error(),
+	})
+	return err
+}
@@ -0,0 +1,73 @@
+package supervisor
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalEntry(t *testing.T) {
+	entry := journalEntry(map[string]string{
+		"MESSAGE":  "two\nlines",
+		"PRIORITY": "3",
+	})
+
+	expected := "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\nPRIORITY=3\n"
+	if string(entry) != expected {
+		t.Fatalf("Expected %q got %q", expected, entry)
+	}
+}
+
+func TestJournalEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := journalSocket
+	journalSocket = path.Join(dir, "socket")
+	defer func() { journalSocket = old }()
+
+	os.Setenv("JOURNAL_STREAM", "8:1234")
+	defer os.Unsetenv("JOURNAL_STREAM")
+
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	c := &Context{Id: "0123456789abcdef", Name: "web", Pid: 42, ExitCode: 3, Args: []string{"--rm", "nginx:stable"}}
+	startedEvent(c)
+	exitedEvent(c, "Container 0123456789ab exited with code 3")
+	pullFailed(c, "nginx:stable", errors.New("manifest unknown"))
+	notifyFailed(c, errors.New("connection refused"))
+
+	expected := [][]string{
+		{"MESSAGE_ID=" + MESSAGE_CONTAINER_STARTED, "PRIORITY=6", "CONTAINER_PID=42", "CONTAINER_ID=0123456789abcdef", "IMAGE=nginx:stable"},
+		{"MESSAGE_ID=" + MESSAGE_CONTAINER_EXITED, "PRIORITY=4", "CONTAINER_EXIT_CODE=3", "CONTAINER_NAME=web"},
+		{"MESSAGE_ID=" + MESSAGE_PULL_FAILED, "PRIORITY=3", "ERROR=manifest unknown"},
+		{"MESSAGE_ID=" + MESSAGE_NOTIFY_FAILED, "PRIORITY=3", "ERROR=connection refused"},
+	}
+
+	buf := make([]byte, 4096)
+	for _, fields := range expected {
+		journal.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := journal.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := string(buf[:n])
+		for _, field := range fields {
+			if !strings.Contains(entry, field+"\n") {
+				t.Fatalf("Expected %s in %q", field, entry)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+/* --log-journal writes the container's lines straight to journald instead of
+ * to our stdout, tagged with the container name as SYSLOG_IDENTIFIER, so
+ * journalctl -t <name> finds them.  They still belong to the unit. */
+
+/* One connection for every stream, logWriters runs again on each restart */
+var (
+	journalLock sync.Mutex
+	journalConn net.Conn
+)
+
+func dialJournal() (net.Conn, error) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+
+	if journalConn == nil {
+		conn, err := net.Dial("unixgram", journalSocket)
+		if err != nil {
+			return nil, err
+		}
+		journalConn = conn
+	}
+	return journalConn, nil
+}
+
+func syslogIdentifier(c *Context) string {
+	if len(c.SyslogIdentifier) > 0 {
+		return c.SyslogIdentifier
+	}
+	if len(c.Name) > 0 {
+		return c.Name
+	}
+	return shortId(c.Id)
+}
+
+/* newJournalWriter sends each line as an entry of priority fallback, or of
+ * the priority of its <N> prefix.  Lines journald can't take go to out. */
+func newJournalWriter(c *Context, out io.Writer, fallback int) io.Writer {
+	conn, err := dialJournal()
+	if err != nil {
+		logWarn("Failed to connect to the journal, logging to stdout:", err)
+		return out
+	}
+
+	identifier := syslogIdentifier(c)
+	id := c.Id
+
+	return &lineWriter{
+		fn: func(line []byte) error {
+			priority := fallback
+			if m := levelPrefix.FindSubmatch(line); m != nil {
+				priority = int(m[1][0] - '0')
+				line = line[len(m[0]):]
+			}
+
+			entry := map[string]string{
+				"MESSAGE":           string(line),
+				"PRIORITY":          strconv.Itoa(priority),
+				"SYSLOG_IDENTIFIER": identifier,
+				"CONTAINER_ID":      id,
+			}
+			if len(c.Name) > 0 {
+				entry["CONTAINER_NAME"] = c.Name
+			}
+
+			_, err := conn.Write(journalEntry(entry))
+			if err != nil {
+				/* Too big for a datagram, for one */
+				_, err = fmt.Fprintf(out, "<%d>%s\n", priority, line)
+			}
+			return err
+		},
+	}
+}
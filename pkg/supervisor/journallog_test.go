@@ -0,0 +1,62 @@
+package supervisor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestJournalWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := journalSocket
+	journalSocket = path.Join(dir, "socket")
+	defer func() {
+		journalSocket = old
+		journalConn = nil
+	}()
+
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	c := &Context{Id: "0123456789abcdef", Name: "web"}
+	out := &bytes.Buffer{}
+	w := newJournalWriter(c, out, 6)
+	w.Write([]byte("plain\n<3>broken\n"))
+
+	buf := make([]byte, 1024)
+	for _, expected := range []string{"MESSAGE=plain\nPRIORITY=6\n", "MESSAGE=broken\nPRIORITY=3\n"} {
+		n, err := journal.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := string(buf[:n])
+		if !strings.Contains(entry, expected) || !strings.Contains(entry, "SYSLOG_IDENTIFIER=web\n") || !strings.Contains(entry, "CONTAINER_NAME=web\n") {
+			t.Fatalf("Bad entry %q", entry)
+		}
+	}
+
+	if out.Len() != 0 {
+		t.Fatal("Lines written to stdout", out.String())
+	}
+}
+
+func TestSyslogIdentifier(t *testing.T) {
+	if syslogIdentifier(&Context{Id: "0123456789abcdef"}) != "0123456789ab" {
+		t.Fatal("Unnamed container not identified by its id")
+	}
+	if syslogIdentifier(&Context{Name: "web", SyslogIdentifier: "frontend"}) != "frontend" {
+		t.Fatal("--syslog-identifier not honored")
+	}
+}
@@ -0,0 +1,104 @@
+package supervisor
+
+import (
+	"fmt"
+	"os"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerFilters "github.com/docker/docker/api/types/filters"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* With --link-lifetime the container must not outlive us.  We stop it on
+ * every way out of Run, for the ways out we don't see (SIGKILL, a
+ * crash of the machine's systemd-docker binary) the container is labeled
+ * and the next invocation of the unit kills it before starting. */
+
+const LABEL_LINKED = "io.systemd-docker.linked"
+
+func lifetimeLabels(c *Context) []string {
+	if !c.LinkLifetime {
+		return []string{}
+	}
+	return []string{"--label", LABEL_LINKED + "=true"}
+}
+
+/* orphans are linked containers of the unit started by another invocation */
+func orphans(containers []dockerContainer.Summary, invocation string) []string {
+	ids := []string{}
+	for _, container := range containers {
+		if container.Labels[LABEL_LINKED] != "true" {
+			continue
+		}
+		if len(invocation) > 0 && container.Labels[LABEL_INVOCATION] == invocation {
+			continue
+		}
+		ids = append(ids, container.ID)
+	}
+	return ids
+}
+
+func killOrphans(c *Context) error {
+	if !c.LinkLifetime {
+		return nil
+	}
+
+	unit := unitName(c)
+	if len(unit) == 0 {
+		logWarn("Not running in a unit, can't look for containers left behind by --link-lifetime")
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	containers, err := client.ContainerList(ctx, dockerContainer.ListOptions{
+		Filters: dockerFilters.NewArgs(
+			dockerFilters.Arg("label", LABEL_UNIT+"="+unit),
+			dockerFilters.Arg("label", LABEL_LINKED+"=true"),
+			dockerFilters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range orphans(containers, os.Getenv("INVOCATION_ID")) {
+		logWarn(fmt.Sprintf("Killing container %s left behind by a previous run of %s", shortId(id), unit))
+		err = client.ContainerKill(ctx, id, "KILL")
+		if err != nil && !dockerx.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* stopLinked stops the container if it is still running as we exit */
+func stopLinked(c *Context) {
+	if !c.LinkLifetime || len(c.Id) == 0 {
+		return
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		logWarn("Failed to stop container", shortId(c.Id), err)
+		return
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil || !container.State.Running {
+		return
+	}
+
+	logInfo(fmt.Sprintf("Stopping container %s, it must not outlive systemd-docker", shortId(c.Id)))
+	err = stopContainer(c)
+	if err != nil {
+		logWarn("Failed to stop container", shortId(c.Id), err)
+	}
+}
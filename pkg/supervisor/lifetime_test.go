@@ -0,0 +1,42 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func TestOrphans(t *testing.T) {
+	containers := []dockerContainer.Summary{
+		{ID: "old", Labels: map[string]string{LABEL_LINKED: "true", LABEL_INVOCATION: "a"}},
+		{ID: "ours", Labels: map[string]string{LABEL_LINKED: "true", LABEL_INVOCATION: "b"}},
+		{ID: "unlinked", Labels: map[string]string{LABEL_INVOCATION: "a"}},
+	}
+
+	ids := orphans(containers, "b")
+	if len(ids) != 1 || ids[0] != "old" {
+		t.Fatal("Expected only old, got", ids)
+	}
+
+	ids = orphans(containers, "")
+	if len(ids) != 2 {
+		t.Fatal("Without an invocation every linked container is an orphan, got", ids)
+	}
+}
+
+func TestParseLinkLifetime(t *testing.T) {
+	c, err := Parse([]string{"--link-lifetime", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.LinkLifetime || !strings.Contains(strings.Join(c.Args, " "), "--label "+LABEL_LINKED+"=true") {
+		t.Fatal("Expected the linked label", c.Args)
+	}
+
+	steps := strings.Join(plan(c), "\n")
+	if !strings.Contains(steps, "wait for the container to exit") {
+		t.Fatal("--link-lifetime has to wait for the container", steps)
+	}
+}
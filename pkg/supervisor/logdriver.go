@@ -0,0 +1,45 @@
+package supervisor
+
+import (
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* A container logging to journald already has every line in the journal,
+ * piping its logs to our stdout would add each of them a second time.  An
+ * explicit --logs or --logs=false decides either way. */
+
+func logDriver(c *Context, client dockerx.API, container *dockerContainer.InspectResponse) string {
+	if container.HostConfig != nil && len(container.HostConfig.LogConfig.Type) > 0 {
+		return container.HostConfig.LogConfig.Type
+	}
+
+	/* Older daemons leave the daemon's default out of HostConfig */
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		logDebug("Failed to read the daemon's log driver:", err)
+		return ""
+	}
+	return info.LoggingDriver
+}
+
+func detectJournald(c *Context, client dockerx.API, container *dockerContainer.InspectResponse) {
+	if !c.Logs || c.LogsForced {
+		return
+	}
+
+	if logDriver(c, client, container) == "journald" {
+		logInfo("Container logs to journald, not piping its logs")
+		c.JournaldLogs = true
+	}
+}
+
+/* pipingLogs is whether we copy the container's output, c.Logs alone also
+ * decides whether we wait for the container.  In the foreground the docker
+ * CLI copies it. */
+func pipingLogs(c *Context) bool {
+	return c.Logs && !c.JournaldLogs && !c.Foreground
+}
@@ -0,0 +1,62 @@
+package supervisor
+
+import (
+	"net/http"
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func logDriverContainer(driver string) *dockerContainer.InspectResponse {
+	return &dockerContainer.InspectResponse{ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+		HostConfig: &dockerContainer.HostConfig{LogConfig: dockerContainer.LogConfig{Type: driver}},
+	}}
+}
+
+func TestDetectJournald(t *testing.T) {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"LoggingDriver": "journald"}`))
+	}).Client
+
+	c := &Context{Logs: true}
+	detectJournald(c, client, logDriverContainer("json-file"))
+	if !pipingLogs(c) {
+		t.Fatal("json-file logs not piped")
+	}
+
+	detectJournald(c, client, logDriverContainer("journald"))
+	if pipingLogs(c) {
+		t.Fatal("journald logs piped")
+	}
+
+	/* The daemon's default */
+	c = &Context{Logs: true}
+	detectJournald(c, client, logDriverContainer(""))
+	if pipingLogs(c) {
+		t.Fatal("journald logs piped")
+	}
+
+	c = &Context{Logs: true, LogsForced: true}
+	detectJournald(c, client, logDriverContainer("journald"))
+	if !pipingLogs(c) {
+		t.Fatal("--logs not honored")
+	}
+}
+
+func TestParseLogsForced(t *testing.T) {
+	c, err := Parse([]string{"run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.LogsForced {
+		t.Fatal("Default --logs forced")
+	}
+
+	c, err = Parse([]string{"--logs=false", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.LogsForced || c.Logs {
+		t.Fatal("--logs=false not forced")
+	}
+}
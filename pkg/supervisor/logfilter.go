@@ -0,0 +1,75 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+/* --log-filter drops container log lines matching a regular expression, or
+ * with a leading ! those not matching it.  Like --log-level-filter this only
+ * applies to what goes to the journal, --log-sink still gets every line. */
+
+type logFilter struct {
+	pattern *regexp.Regexp
+	keep    bool
+}
+
+func parseLogFilters(values []string) ([]logFilter, error) {
+	filters := []logFilter{}
+	for _, value := range values {
+		keep := strings.HasPrefix(value, "!")
+		pattern, err := regexp.Compile(strings.TrimPrefix(value, "!"))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid --log-filter %s: %s", value, err))
+		}
+		filters = append(filters, logFilter{pattern, keep})
+	}
+	return filters, nil
+}
+
+func filterLine(filters []logFilter, line []byte) bool {
+	for _, f := range filters {
+		if f.pattern.Match(line) != f.keep {
+			return false
+		}
+	}
+	return true
+}
+
+/* newFilterWriter passes on the lines all filters let through and counts
+ * the others in dropped */
+func newFilterWriter(out io.Writer, filters []logFilter, dropped *uint64) io.Writer {
+	return &lineWriter{
+		fn: func(line []byte) error {
+			if !filterLine(filters, line) {
+				atomic.AddUint64(dropped, 1)
+				return nil
+			}
+
+			_, err := fmt.Fprintf(out, "%s\n", line)
+			return err
+		},
+	}
+}
+
+/* reportFiltered says every interval how many lines were dropped, so a
+ * filter that is too eager doesn't go unnoticed */
+func reportFiltered(c *Context) {
+	if c.LogFilterReport <= 0 || (len(c.LogFilters) == 0 && c.LogLevel < 0) {
+		return
+	}
+
+	for {
+		if sleepContext(c, c.LogFilterReport) != nil {
+			return
+		}
+
+		if dropped := atomic.SwapUint64(&c.LogsDropped, 0); dropped > 0 {
+			logInfo(fmt.Sprintf("Dropped %d container log lines in the last %s", dropped, c.LogFilterReport))
+		}
+	}
+}
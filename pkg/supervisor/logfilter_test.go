@@ -0,0 +1,37 @@
+package supervisor
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFilterWriter(t *testing.T) {
+	filters, err := parseLogFilters([]string{`GET /health`, `!^\[`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	dropped := uint64(0)
+	w := newFilterWriter(out, filters, &dropped)
+	w.Write([]byte("[web] GET /health 200\n[web] GET / 200\nunprefixed\n"))
+
+	if out.String() != "[web] GET / 200\n" || dropped != 2 {
+		t.Fatal("Bad filtering", out.String(), dropped)
+	}
+}
+
+func TestParseLogFilter(t *testing.T) {
+	c, err := Parse([]string{"--log-filter", "a,b", "--log-filter", "!c", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.LogFilters) != 2 || c.LogFilters[0].pattern.String() != "a,b" || !c.LogFilters[1].keep {
+		t.Fatal("Bad filters", c.LogFilters)
+	}
+
+	_, err = Parse([]string{"--log-filter", "(", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Invalid regular expression accepted")
+	}
+}
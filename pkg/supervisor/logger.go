@@ -0,0 +1,140 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Levels for systemd-docker's own logging, container logs are not affected */
+const (
+	LOG_ERROR = iota
+	LOG_WARN
+	LOG_INFO
+	LOG_DEBUG
+)
+
+var selfLogLevel = LOG_INFO
+
+var selfLogLevelNames = []string{"error", "warn", "info", "debug"}
+
+/* With --log-format=json every message is a JSON object on its own line with
+ * the fields below plus whatever was added with setLogField.  Fields change
+ * while other goroutines log, so logFieldsLock guards them. */
+var (
+	selfLogJson   bool
+	logFields     = map[string]string{}
+	logFieldsLock sync.RWMutex
+	logStart      = time.Now()
+)
+
+func setSelfLogFormat(format string) error {
+	switch format {
+	case "text":
+		selfLogJson = false
+	case "json":
+		selfLogJson = true
+	default:
+		return errors.New(fmt.Sprintf("Invalid --log-format %s, expected text or json", format))
+	}
+	return nil
+}
+
+func setLogField(key, value string) {
+	logFieldsLock.Lock()
+	defer logFieldsLock.Unlock()
+	logFields[key] = value
+}
+
+func formatJsonLog(level int, msg string) string {
+	entry := map[string]interface{}{}
+	logFieldsLock.RLock()
+	for k, v := range logFields {
+		entry[k] = v
+	}
+	logFieldsLock.RUnlock()
+
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = selfLogLevelNames[level]
+	entry["msg"] = msg
+	entry["elapsed"] = time.Since(logStart).Seconds()
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return msg
+	}
+	return string(bytes)
+}
+
+func parseSelfLogLevel(value string) (int, error) {
+	for level, name := range selfLogLevelNames {
+		if name == value {
+			return level, nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Invalid --log-level %s, expected error, warn, info or debug", value))
+}
+
+func logAt(level int, v ...interface{}) {
+	if level > selfLogLevel {
+		return
+	}
+
+	msg := fmt.Sprintln(v...)
+	if selfLogJson {
+		os.Stderr.WriteString(formatJsonLog(level, strings.TrimSuffix(msg, "\n")) + "\n")
+		return
+	}
+
+	log.Output(3, msg)
+}
+
+func logError(v ...interface{}) {
+	logAt(LOG_ERROR, v...)
+}
+
+func logWarn(v ...interface{}) {
+	logAt(LOG_WARN, v...)
+}
+
+func logInfo(v ...interface{}) {
+	logAt(LOG_INFO, v...)
+}
+
+func logDebug(v ...interface{}) {
+	logAt(LOG_DEBUG, v...)
+}
+
+/* tracingTransport logs every Docker API request when debugging */
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		logDebug("Docker API", req.Method, req.URL.Path, "failed after", time.Since(start), err)
+		return resp, err
+	}
+
+	logDebug("Docker API", req.Method, req.URL.RequestURI(), resp.StatusCode, time.Since(start))
+	return resp, err
+}
+
+/* traceDocker traces docker API calls at debug level */
+func traceDocker() func(http.RoundTripper) http.RoundTripper {
+	if selfLogLevel < LOG_DEBUG {
+		return nil
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &tracingTransport{next: next}
+	}
+}
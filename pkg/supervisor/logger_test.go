@@ -0,0 +1,45 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJsonLog(t *testing.T) {
+	setLogField("container", "abc")
+	defer delete(logFields, "container")
+
+	entry := map[string]interface{}{}
+	err := json.Unmarshal([]byte(formatJsonLog(LOG_WARN, "something happened")), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry["level"] != "warn" || entry["msg"] != "something happened" || entry["container"] != "abc" {
+		t.Fatal("Bad log entry", entry)
+	}
+
+	if _, ok := entry["elapsed"].(float64); !ok {
+		t.Fatal("Missing elapsed", entry)
+	}
+
+	if setSelfLogFormat("xml") == nil {
+		t.Fatal("xml should be rejected")
+	}
+}
+
+func TestJsonLogConcurrentFields(t *testing.T) {
+	defer delete(logFields, "container")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			formatJsonLog(LOG_INFO, "relayed")
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		setLogField("container", "abc")
+	}
+	<-done
+}
@@ -0,0 +1,131 @@
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/* syslog priorities, as understood by journald in <N> line prefixes */
+var logLevels = map[string]int{
+	"emerg":   0,
+	"alert":   1,
+	"crit":    2,
+	"err":     3,
+	"warning": 4,
+	"notice":  5,
+	"info":    6,
+	"debug":   7,
+}
+
+const defaultLogLevel = 6
+
+var (
+	levelPrefix = regexp.MustCompile(`^<([0-7])>`)
+	levelWord   = regexp.MustCompile(`(?i)\b(emerg|alert|fatal|panic|crit|critical|err|error|warn|warning|notice|info|debug|trace)\b`)
+)
+
+/* Only look at the start of the line, "error" in the middle of a message
+ * doesn't make it an error */
+const levelScanLength = 64
+
+func parseLogLevel(value string) (int, error) {
+	if level, ok := logLevels[value]; ok {
+		return level, nil
+	}
+
+	level, err := strconv.Atoi(value)
+	if err != nil || level < 0 || level > 7 {
+		return 0, errors.New(fmt.Sprintf("Invalid log level %s, expected 0-7 or one of emerg, alert, crit, err, warning, notice, info, debug", value))
+	}
+
+	return level, nil
+}
+
+func detectLogLevel(line []byte, fallback int) int {
+	if m := levelPrefix.FindSubmatch(line); m != nil {
+		return int(m[1][0] - '0')
+	}
+
+	if len(line) > levelScanLength {
+		line = line[:levelScanLength]
+	}
+
+	m := levelWord.FindSubmatch(line)
+	if m == nil {
+		return fallback
+	}
+
+	switch strings.ToLower(string(m[1])) {
+	case "emerg":
+		return 0
+	case "alert":
+		return 1
+	case "fatal", "panic", "crit", "critical":
+		return 2
+	case "err", "error":
+		return 3
+	case "warn", "warning":
+		return 4
+	case "notice":
+		return 5
+	case "debug", "trace":
+		return 7
+	}
+
+	return 6
+}
+
+/* lineWriter splits a stream into lines and hands them to fn one at a time */
+type lineWriter struct {
+	fn   func(line []byte) error
+	buf  []byte
+	lock sync.Mutex
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		err := w.fn(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+/* newLevelWriter drops lines less severe than max, counting them in dropped,
+ * and prefixes the rest with <N> so journald records their priority and the
+ * unit's LogLevelMax= applies to them */
+func newLevelWriter(out io.Writer, max, fallback int, dropped *uint64) io.Writer {
+	return &lineWriter{
+		fn: func(line []byte) error {
+			level := detectLogLevel(line, fallback)
+			if level > max {
+				atomic.AddUint64(dropped, 1)
+				return nil
+			}
+
+			line = levelPrefix.ReplaceAll(line, nil)
+			_, err := fmt.Fprintf(out, "<%d>%s\n", level, line)
+			return err
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package supervisor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := parseLogLevel("warning")
+	if err != nil || level != 4 {
+		t.Fatal("failed to parse warning", level, err)
+	}
+
+	level, err = parseLogLevel("7")
+	if err != nil || level != 7 {
+		t.Fatal("failed to parse 7", level, err)
+	}
+
+	_, err = parseLogLevel("loud")
+	if err == nil {
+		t.Fatal("parse should fail")
+	}
+}
+
+func TestLevelWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	dropped := uint64(0)
+	w := newLevelWriter(out, 4, defaultLogLevel, &dropped)
+
+	w.Write([]byte("2020-01-01 DEBUG noise\n2020-01-01 ERROR bro"))
+	w.Write([]byte("ken\nplain line\n<4>already prefixed\nINFO the error was ignored\n"))
+
+	expected := "<3>2020-01-01 ERROR broken\n<4>already prefixed\n"
+	if out.String() != expected {
+		t.Fatalf("Expected %q got %q", expected, out.String())
+	}
+	if dropped != 3 {
+		t.Fatal("Expected 3 dropped lines, got", dropped)
+	}
+}
+
+/* Under systemd every line gets a priority, so LogLevelMax= can tell them
+ * apart without --log-level-filter */
+func TestLogWritersJournalPriorities(t *testing.T) {
+	t.Setenv("JOURNAL_STREAM", "8:1234")
+
+	capture := func(f **os.File) *os.File {
+		read, write, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := *f
+		*f = write
+		t.Cleanup(func() { *f = old })
+		return read
+	}
+	readOut := capture(&os.Stdout)
+	readErr := capture(&os.Stderr)
+
+	c := &Context{LogLevel: -1, StderrLevel: 3}
+	stdout, stderr := logWriters(c)
+	stdout.Write([]byte("ERROR: disk full\nlistening on :80\n<7>chatter\n"))
+	stderr.Write([]byte("panic: oops\nINFO: retrying\n"))
+	os.Stdout.Close()
+	os.Stderr.Close()
+
+	for _, expected := range []struct {
+		read *os.File
+		out  string
+	}{
+		{readOut, "<3>ERROR: disk full\n<6>listening on :80\n<7>chatter\n"},
+		{readErr, "<2>panic: oops\n<6>INFO: retrying\n"},
+	} {
+		written, err := ioutil.ReadAll(expected.read)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != expected.out {
+			t.Fatalf("Expected %q got %q", expected.out, written)
+		}
+	}
+	if c.LogsDropped != 0 {
+		t.Fatal("Nothing should be dropped without a filter", c.LogsDropped)
+	}
+}
+
+func TestParseStderrLevel(t *testing.T) {
+	c, err := Parse([]string{"run", "busybox"})
+	if err != nil || c.StderrLevel != 3 {
+		t.Fatal("Expected stderr at err by default", c, err)
+	}
+
+	c, err = Parse([]string{"--stderr-level=", "run", "busybox"})
+	if err != nil || c.StderrLevel != -1 {
+		t.Fatal("Expected stderr level to be disabled", c, err)
+	}
+}
@@ -0,0 +1,187 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* A LogSink receives every container log line, in addition to the journal.
+ * Shipping logs to other systems is left to exec plugins so we don't have to
+ * implement every backend ourselves. */
+type LogSink interface {
+	WriteRecord(record *LogRecord) error
+	Close() error
+}
+
+type LogRecord struct {
+	Time      time.Time `json:"time"`
+	Stream    string    `json:"stream"`
+	Container string    `json:"container"`
+	Name      string    `json:"name,omitempty"`
+	Message   string    `json:"message"`
+}
+
+/* How many records wait for a slow sink before we drop lines, the journal
+ * still gets them */
+const LOG_SINK_BUFFER = 1024
+
+/* execSink runs a helper and writes one JSON record per line to its stdin.
+ * A helper that can't keep up loses records instead of stalling the log
+ * stream, the count is logged when the sink closes. */
+type execSink struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	records chan *LogRecord
+	written chan struct{}
+	dropped uint64
+	lock    sync.Mutex
+	closed  bool
+	err     error
+}
+
+func newExecSink(command string) (*execSink, error) {
+	args, err := shellSplit(command)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad log sink command %s: %s", command, err))
+	}
+	if len(args) == 0 {
+		return nil, errors.New("Empty log sink command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &execSink{
+		cmd:     cmd,
+		stdin:   stdin,
+		records: make(chan *LogRecord, LOG_SINK_BUFFER),
+		written: make(chan struct{}),
+	}
+	go s.write()
+	return s, nil
+}
+
+func (s *execSink) write() {
+	defer close(s.written)
+
+	encoder := json.NewEncoder(s.stdin)
+	for record := range s.records {
+		err := encoder.Encode(record)
+		if err != nil {
+			s.lock.Lock()
+			s.err = err
+			s.lock.Unlock()
+			return
+		}
+	}
+}
+
+/* WriteRecord only fails once the helper did, a full buffer drops the record */
+func (s *execSink) WriteRecord(record *LogRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.closed {
+		return errors.New("Log sink is closed")
+	}
+
+	select {
+	case s.records <- record:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+func (s *execSink) Close() error {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.records)
+	}
+	s.lock.Unlock()
+
+	/* The records still buffered go out first */
+	<-s.written
+	s.stdin.Close()
+
+	if dropped := atomic.LoadUint64(&s.dropped); dropped > 0 {
+		logWarn(fmt.Sprintf("Dropped %d container log lines the log sink couldn't keep up with", dropped))
+	}
+	return s.cmd.Wait()
+}
+
+func openLogSink(c *Context) error {
+	if len(c.LogSinkCmd) == 0 {
+		return nil
+	}
+
+	sink, err := newExecSink(c.LogSinkCmd)
+	if err != nil {
+		return err
+	}
+
+	c.LogSink = sink
+	return nil
+}
+
+func closeLogSink(c *Context) {
+	if c.LogSink == nil {
+		return
+	}
+
+	err := c.LogSink.Close()
+	if err != nil {
+		logWarn("Log sink failed:", err)
+	}
+}
+
+/* newSinkWriter never fails the log stream, a broken sink must not stop logs
+ * from reaching the journal */
+func newSinkWriter(c *Context, stream string) io.Writer {
+	failed := false
+	id := c.Id
+
+	return &lineWriter{
+		fn: func(line []byte) error {
+			if failed {
+				return nil
+			}
+
+			err := c.LogSink.WriteRecord(&LogRecord{
+				Time:      time.Now(),
+				Stream:    stream,
+				Container: id,
+				Name:      c.Name,
+				Message:   string(line),
+			})
+			if err != nil {
+				logWarn("Failed to write to log sink, disabling it:", err)
+				failed = true
+			}
+
+			return nil
+		},
+	}
+}
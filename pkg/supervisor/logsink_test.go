@@ -0,0 +1,111 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "records")
+
+	c := &Context{
+		Id:         "abc",
+		Name:       "test",
+		LogSinkCmd: "tee " + out,
+	}
+
+	err = openLogSink(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newSinkWriter(c, "stderr")
+	w.Write([]byte("hello\nwor"))
+	w.Write([]byte("ld\n"))
+	closeLogSink(c)
+
+	bytes, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	for _, expected := range []string{"hello", "world"} {
+		record := LogRecord{}
+		err = decoder.Decode(&record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if record.Message != expected || record.Stream != "stderr" || record.Container != "abc" || record.Name != "test" {
+			t.Fatal("Bad record", record)
+		}
+	}
+}
+
+func TestExecSinkQuoted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "log records")
+	c := &Context{Id: "abc", LogSinkCmd: `tee "` + out + `"`}
+	err = openLogSink(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSinkWriter(c, "stdout").Write([]byte("hello\n"))
+	closeLogSink(c)
+
+	bytes, err := ioutil.ReadFile(out)
+	if err != nil || !strings.Contains(string(bytes), "hello") {
+		t.Fatal("Expected the quoted path to be one argument", err)
+	}
+}
+
+func TestExecSinkDrops(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	/* Stalls long enough to fill the pipe and the buffer */
+	out := filepath.Join(dir, "records")
+	sink, err := newExecSink("sh -c 'sleep 1; cat > " + out + "'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 5 * LOG_SINK_BUFFER
+	for i := 0; i < total; i++ {
+		err := sink.WriteRecord(&LogRecord{Message: strings.Repeat("x", 100)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = sink.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, _ := ioutil.ReadFile(out)
+	written := strings.Count(string(bytes), "\n")
+	if sink.dropped == 0 || written+int(sink.dropped) != total {
+		t.Fatal("Expected every record to be written or counted as dropped, got", written, sink.dropped)
+	}
+}
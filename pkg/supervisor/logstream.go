@@ -0,0 +1,94 @@
+package supervisor
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/* A SIGHUP closes the container's log stream and opens a new one from where
+ * the last output arrived, for a stream that got stuck or a log pipe that
+ * was swapped under us.  Only one stream runs at a time. */
+
+type logStream struct {
+	lock   sync.Mutex
+	stop   func()
+	cursor time.Time
+}
+
+/* replace makes stop the way to end the current stream, ending the previous */
+func (s *logStream) replace(stop func()) {
+	s.lock.Lock()
+	previous := s.stop
+	s.stop = stop
+	s.lock.Unlock()
+
+	if previous != nil {
+		previous()
+	}
+}
+
+func (s *logStream) touch() {
+	s.lock.Lock()
+	s.cursor = time.Now()
+	s.lock.Unlock()
+}
+
+func (s *logStream) since() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cursor
+}
+
+/* cursorWriter remembers when output last went through it */
+type cursorWriter struct {
+	out    io.Writer
+	stream *logStream
+}
+
+func (w *cursorWriter) Write(p []byte) (int, error) {
+	w.stream.touch()
+	return w.out.Write(p)
+}
+
+/* restartLogs resumes the log stream from the cursor, or from the start of
+ * the current run if nothing was logged yet */
+func restartLogs(c *Context) {
+	since := c.logs.since()
+	if since.IsZero() {
+		logInfo("Restarting the log stream from the start of the container")
+	} else {
+		logInfo("Restarting the log stream from", since.Format(time.RFC3339Nano))
+	}
+	go pipeLogsSince(c, since)
+}
+
+func handleHup(c *Context) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			if pipingLogs(c) {
+				restartLogs(c)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+/* streamContext is the context of a new log stream, it replaces the
+ * current one */
+func streamContext(c *Context) context.Context {
+	ctx, cancel := context.WithCancel(rootContext(c))
+	c.logs.replace(cancel)
+	return ctx
+}
@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+func TestLogStreamReplace(t *testing.T) {
+	s := &logStream{}
+	stopped := 0
+	s.replace(func() { stopped++ })
+	s.replace(func() { stopped += 10 })
+	if stopped != 1 {
+		t.Fatal("Previous stream not stopped", stopped)
+	}
+}
+
+func TestCursorWriter(t *testing.T) {
+	s := &logStream{}
+	out := &bytes.Buffer{}
+	w := &cursorWriter{out, s}
+
+	if !s.since().IsZero() {
+		t.Fatal("Cursor set before any output")
+	}
+
+	before := time.Now()
+	w.Write([]byte("line\n"))
+	if s.since().Before(before) || out.String() != "line\n" {
+		t.Fatal("Cursor not moved", s.since(), out.String())
+	}
+}
+
+func TestStreamContextCancelsPrevious(t *testing.T) {
+	c := &Context{}
+	first := streamContext(c)
+	second := streamContext(c)
+
+	select {
+	case <-first.Done():
+	case <-time.After(time.Second):
+		t.Fatal("First stream still running")
+	}
+	if second.Err() != nil {
+		t.Fatal("Second stream cancelled", second.Err())
+	}
+}
+
+func TestRestartLogs(t *testing.T) {
+	mock := runtime.NewMock()
+	mock.Add(&runtime.Container{ID: "abc", State: runtime.State{Running: true}})
+	mock.Output["abc"] = "again\n"
+
+	c := &Context{Id: "abc", Runtime: mock, LogLevel: -1, StderrLevel: -1}
+	out := &bytes.Buffer{}
+	err := streamLogs(c, time.Time{}, &cursorWriter{out, &c.logs}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor := c.logs.since()
+	if cursor.IsZero() || out.String() != "again\n" {
+		t.Fatal("Output not streamed", out.String())
+	}
+
+	err = streamLogs(c, cursor, out, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "again\nagain\n" {
+		t.Fatal("Stream not re-established", out.String())
+	}
+}
@@ -0,0 +1,73 @@
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+/* --log-max-line cuts lines longer than the limit, so a container dumping
+ * megabytes of JSON on one line doesn't flood the journal.  Lines are cut as
+ * they stream through, an endless line isn't buffered. */
+
+type truncateWriter struct {
+	out     io.Writer
+	max     int
+	length  int
+	dropped int
+	lock    sync.Mutex
+}
+
+func newTruncateWriter(out io.Writer, max int) io.Writer {
+	return &truncateWriter{out: out, max: max}
+}
+
+func (w *truncateWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	buf := &bytes.Buffer{}
+	rest := p
+	for len(rest) > 0 {
+		end := bytes.IndexByte(rest, '\n')
+		line := rest
+		if end >= 0 {
+			line = rest[:end]
+		}
+
+		room := w.max - w.length
+		if room < 0 {
+			room = 0
+		}
+		if len(line) > room {
+			/* Don't split a UTF-8 character */
+			cut := room
+			for cut > 0 && cut < len(line) && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			buf.Write(line[:cut])
+			w.dropped += len(line) - cut
+			w.length = w.max
+		} else {
+			buf.Write(line)
+			w.length += len(line)
+		}
+
+		if end < 0 {
+			break
+		}
+
+		if w.dropped > 0 {
+			fmt.Fprintf(buf, "... [truncated %d bytes]", w.dropped)
+		}
+		buf.WriteByte('\n')
+		w.length = 0
+		w.dropped = 0
+		rest = rest[end+1:]
+	}
+
+	_, err := w.out.Write(buf.Bytes())
+	return len(p), err
+}
@@ -0,0 +1,32 @@
+package supervisor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTruncateWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := newTruncateWriter(out, 10)
+
+	w.Write([]byte("short\n0123456789abc"))
+	w.Write([]byte("def\nexactly 10\n"))
+
+	expected := "short\n0123456789... [truncated 6 bytes]\nexactly 10\n"
+	if out.String() != expected {
+		t.Fatalf("Expected %q got %q", expected, out.String())
+	}
+}
+
+func TestTruncateWriterUtf8(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := newTruncateWriter(out, 4)
+
+	/* é is two bytes, the third one doesn't fit whole */
+	w.Write([]byte(strings.Repeat("é", 3) + "\n"))
+
+	if out.String() != "éé... [truncated 2 bytes]\n" {
+		t.Fatalf("Bad cut %q", out.String())
+	}
+}
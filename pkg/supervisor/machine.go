@@ -0,0 +1,86 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* --machine registers the container with systemd-machined, so machinectl
+ * list shows it and machinectl shell gets into it.  machined is reached with
+ * busctl rather than a D-Bus library of our own. */
+
+const (
+	MACHINE_SERVICE    = "systemd-docker"
+	MACHINE_NAME_LIMIT = 64
+)
+
+var machineCall = func(method string, args ...string) error {
+	out, err := exec.Command("busctl", append([]string{"call", "org.freedesktop.machine1", "/org/freedesktop/machine1",
+		"org.freedesktop.machine1.Manager", method}, args...)...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+var invalidMachineChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+/* machineName turns the container name into a host name as machined wants */
+func machineName(c *Context) string {
+	name := c.Name
+	if len(name) == 0 {
+		name = shortId(c.Id)
+	}
+
+	name = strings.Trim(invalidMachineChars.ReplaceAllString(name, "-"), "-.")
+	if len(name) > MACHINE_NAME_LIMIT {
+		name = name[:MACHINE_NAME_LIMIT]
+	}
+	return name
+}
+
+/* machineRoot is where the container's root filesystem is on the host */
+func machineRoot(c *Context) string {
+	client, err := getClient(c)
+	if err != nil {
+		return ""
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil || container.GraphDriver.Data == nil {
+		return ""
+	}
+	return container.GraphDriver.Data["MergedDir"]
+}
+
+func registerMachine(c *Context) {
+	if !c.Machine || c.Pid == 0 {
+		return
+	}
+
+	name := machineName(c)
+	/* A machine left from an earlier pid would make the name taken */
+	machineCall("UnregisterMachine", "s", name)
+
+	err := machineCall("RegisterMachine", "sayssus", name, "0", MACHINE_SERVICE, "container", strconv.Itoa(c.Pid), machineRoot(c))
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to register machine %s: %s", name, err))
+		return
+	}
+	logDebug("Registered machine", name, "with leader", c.Pid)
+}
+
+func unregisterMachine(c *Context) {
+	if !c.Machine || len(c.Id) == 0 {
+		return
+	}
+
+	err := machineCall("UnregisterMachine", "s", machineName(c))
+	if err != nil {
+		logDebug("Failed to unregister machine:", err)
+	}
+}
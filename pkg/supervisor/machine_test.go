@@ -0,0 +1,62 @@
+package supervisor
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMachineName(t *testing.T) {
+	if name := machineName(&Context{Name: "web_1@prod"}); name != "web-1-prod" {
+		t.Fatal("Bad machine name", name)
+	}
+
+	if name := machineName(&Context{Id: "0123456789abcdef"}); name != "0123456789ab" {
+		t.Fatal("Bad machine name from id", name)
+	}
+
+	if name := machineName(&Context{Name: strings.Repeat("a", 80)}); len(name) != MACHINE_NAME_LIMIT {
+		t.Fatal("Machine name not cut", name)
+	}
+}
+
+func fakeMachined(t *testing.T) *[]string {
+	calls := []string{}
+	oldCall := machineCall
+	machineCall = func(method string, args ...string) error {
+		calls = append(calls, method+" "+strings.Join(args, " "))
+		return nil
+	}
+	t.Cleanup(func() { machineCall = oldCall })
+	return &calls
+}
+
+func TestRegisterMachine(t *testing.T) {
+	calls := fakeMachined(t)
+
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id": "abc", "State": {"Running": true, "Pid": 42}, "GraphDriver": {"Name": "overlay2", "Data": {"MergedDir": "/var/lib/docker/overlay2/x/merged"}}}`))
+	}).Client
+
+	c := &Context{Id: "abc", Name: "web", Pid: 42, Client: client, Machine: true}
+	registerMachine(c)
+	unregisterMachine(c)
+
+	expected := "UnregisterMachine s web\n" +
+		"RegisterMachine sayssus web 0 systemd-docker container 42 /var/lib/docker/overlay2/x/merged\n" +
+		"UnregisterMachine s web"
+	if strings.Join(*calls, "\n") != expected {
+		t.Fatal("Bad calls", *calls)
+	}
+}
+
+func TestRegisterMachineOff(t *testing.T) {
+	calls := fakeMachined(t)
+
+	c := &Context{Id: "abc", Name: "web", Pid: 42}
+	registerMachine(c)
+	unregisterMachine(c)
+	if len(*calls) > 0 {
+		t.Fatal("Called machined without --machine", *calls)
+	}
+}
@@ -0,0 +1,1674 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+	"github.com/oott123/systemd-docker/pkg/notify"
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+var (
+	INTERVAL time.Duration = 1000
+)
+
+const (
+	NOTIFY_BARRIER_TIMEOUT = 5 * time.Second
+)
+
+var (
+	ErrStartTimeout = errors.New("Timed out waiting for the container to start")
+	ErrOOMKilled    = errors.New("Container was OOM killed")
+)
+
+type Context struct {
+	Args             []string
+	Logs             bool
+	LogsForced       bool
+	JournaldLogs     bool
+	Notify           bool
+	NotifyMode       string
+	Name             string
+	Env              bool
+	Rm               bool
+	RmVolumes        bool
+	PruneImage       bool
+	Id               string
+	NotifySocket     string
+	Cmd              *exec.Cmd
+	Pid              int
+	PidFile          string
+	StartedAt        time.Time
+	Phases           []startupPhase
+	AutoUpdate       string
+	PreStopExec      []string
+	PreStopTimeout   time.Duration
+	UpdateInterval   time.Duration
+	updating         int32
+	updated          chan struct{}
+	identity         sync.RWMutex
+	OnSuccess        string
+	ExitCode         int
+	StrictArgs       bool
+	StartTimeout     time.Duration
+	LogLevel         int
+	DryRun           bool
+	LogSinkCmd       string
+	LogSink          LogSink
+	EnvInclude       []string
+	EnvExclude       []string
+	MetricsFile      string
+	MetricsInterval  time.Duration
+	HealthStatus     bool
+	HealthInterval   time.Duration
+	StatsStatus      bool
+	StatsInterval    time.Duration
+	Exited           bool
+	Attached         bool
+	ContainerEnvFile string
+	CidFile          string
+	ReadyHttp        HttpProbe
+	ReadyNetwork     NetworkProbe
+	ReadyGrpc        GrpcProbe
+	Hooks            Hooks
+	OOMKilled        bool
+	Unit             string
+	KeepRestart      bool
+	RequireDigest    bool
+	ImagePolicy      string
+	VerifyKeys       []string
+	VerifyIdentity   string
+	VerifyIssuer     string
+	VerifyNotation   bool
+	ExtendTimeout    time.Duration
+	DaemonTimeout    time.Duration
+	Attach           bool
+	NotifyProxy      string
+	NotifyProxyConn  *net.UnixConn
+	UseNotifyProxy   bool
+	NotifyRelabel    string
+	LogsSince        time.Time
+	StderrLevel      int
+	PollInterval     time.Duration
+	Ctx              context.Context
+	ApiTimeout       time.Duration
+	DefaultName      bool
+	GpuWait          time.Duration
+	MkdirVolumes     bool
+	MkdirMode        os.FileMode
+	MkdirUid         int
+	MkdirGid         int
+	MountUnitDirs    bool
+	UnitDirTargets   map[string]string
+	Unhealthy        int32
+	UnhealthyTimeout time.Duration
+	unhealthySince   int64
+	unhealthyStop    int32
+	LogFilters       []logFilter
+	LogFilterReport  time.Duration
+	LogsDropped      uint64
+	LogMaxLine       int
+	LogJournal       bool
+	SyslogIdentifier string
+	CgroupSlice      string
+	Cgroup           string
+	OomScoreAdjust   int
+	OomScoreSet      bool
+	UnitLimits       bool
+	WaitDevice       time.Duration
+	Foreground       bool
+	Machine          bool
+	Recreate         bool
+	Gc               bool
+	ConfigHash       string
+	WatchdogTrigger  bool
+	LinkLifetime     bool
+	PullPolicy       string
+	StopTimeout      time.Duration
+	StopSignal       string
+	ForwardSignals   []signalForward
+	Checkpoint       bool
+	CheckpointDir    string
+	Stdin            bool
+	Client           dockerx.API
+	Runtime          runtime.ContainerRuntime
+	logs             logStream
+	status           statusLine
+	watched          cgroupTarget
+}
+
+func setupEnvironment(c *Context) {
+	newArgs := append(unitLabels(c), digestLabels(c)...)
+	newArgs = append(newArgs, unitDirArgs(c)...)
+	newArgs = append(newArgs, lifetimeLabels(c)...)
+	newArgs = append(newArgs, oomScoreArgs(c)...)
+	newArgs = append(newArgs, configLabels(c)...)
+	useProxy := c.UseNotifyProxy || len(c.NotifyRelabel) > 0 || strings.HasPrefix(c.NotifySocket, "@")
+	if c.Notify && len(c.NotifySocket) > 0 && useProxy {
+		c.NotifyProxy = notifyProxyPath()
+		newArgs = append(newArgs, "-e", fmt.Sprintf("NOTIFY_SOCKET=%s", NOTIFY_PROXY_TARGET))
+		newArgs = append(newArgs, "-v", notifyMount(c, c.NotifyProxy, NOTIFY_PROXY_TARGET))
+	} else if c.Notify && len(c.NotifySocket) > 0 {
+		if selinuxEnforcing() {
+			logWarn("SELinux is enforcing, the container may not be able to use NOTIFY_SOCKET without --notify-relabel")
+		}
+		newArgs = append(newArgs, "-e", fmt.Sprintf("NOTIFY_SOCKET=%s", c.NotifySocket))
+		newArgs = append(newArgs, "-v", fmt.Sprintf("%s:%s", c.NotifySocket, c.NotifySocket))
+	} else {
+		c.Notify = false
+	}
+
+	if c.Env {
+		for _, val := range os.Environ() {
+			if forwardEnv(c, strings.SplitN(val, "=", 2)[0]) {
+				newArgs = append(newArgs, "-e", val)
+			}
+		}
+	}
+
+	if len(newArgs) > 0 {
+		c.Args = append(newArgs, c.Args...)
+	}
+}
+
+/* Never forwarded unless matched by --env-include, they describe the host
+ * side of the unit and make no sense inside the container */
+var envSkip = []string{"HOME", "PATH", "NOTIFY_SOCKET", "LISTEN_*", "INVOCATION_ID"}
+
+func matchEnv(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func forwardEnv(c *Context, name string) bool {
+	included := matchEnv(c.EnvInclude, name)
+
+	if len(c.EnvInclude) > 0 && !included {
+		return false
+	}
+
+	if matchEnv(c.EnvExclude, name) {
+		return false
+	}
+
+	return included || !matchEnv(envSkip, name)
+}
+
+/* Parse reads the ExecStart= arguments after systemd-docker itself, our own
+ * flags, run and docker run's arguments */
+func Parse(args []string) (*Context, error) {
+	c := &Context{
+		Logs:        true,
+		LogLevel:    -1,
+		StderrLevel: -1,
+		MkdirUid:    -1,
+		MkdirGid:    -1,
+	}
+	var logLevel, stderrLevel, selfLevel, selfFormat, mkdirMode, mkdirOwner, stopTimeout string
+	var unitDirTargets, logFilters, forwardSignals []string
+
+	flags := flag.NewFlagSet("systemd-docker", flag.ContinueOnError)
+
+	flags.StringVarP(&c.PidFile, "pid-file", "p", "", "pipe file")
+	flags.StringVar(&c.CidFile, "cid-file", "", "write the container id to this file")
+	flags.StringVar(&c.Unit, "unit", "", "name of the systemd unit, detected from our cgroup by default")
+	flags.BoolVar(&c.DefaultName, "default-name", true, "name the container after the unit if run has no --name")
+	flags.BoolVarP(&c.Logs, "logs", "l", true, "pipe logs")
+	flags.BoolVar(&c.RmVolumes, "rm-volumes", false, "remove the anonymous volumes of the container along with it, with --rm")
+	flags.BoolVar(&c.PruneImage, "prune-image", false, "remove the image after the container unless something else uses it, with --rm")
+	flags.BoolVar(&c.Attach, "attach", false, "run the container in the foreground, forwarding stdin and the tty")
+	flags.StringVarP(&c.NotifyMode, "notify", "n", NOTIFY_PID, "who sends READY=1: pid, healthy, proxy (the container) or off, a bare --notify is proxy")
+	flags.Lookup("notify").NoOptDefVal = NOTIFY_PROXY
+	flags.BoolVar(&c.UseNotifyProxy, "notify-proxy", false, "relay the container's notifications through a filtering socket instead of mounting NOTIFY_SOCKET")
+	flags.StringVar(&c.NotifyRelabel, "notify-relabel", "", "relabel the notify socket for SELinux with z (shared) or Z (private), implies --notify-proxy")
+	flags.BoolVarP(&c.Env, "env", "e", false, "inherit environment variable")
+	flags.StringSliceVar(&c.EnvInclude, "env-include", nil, "only inherit environment variables matching these globs")
+	flags.StringSliceVar(&c.EnvExclude, "env-exclude", nil, "don't inherit environment variables matching these globs")
+	flags.StringVar(&c.OnSuccess, "on-success", "exit", "when the container exits successfully: exit, restart or remain")
+	flags.BoolVar(&c.StrictArgs, "strict-args", false, "reject unknown or misplaced systemd-docker flags")
+	flags.DurationVar(&c.StartTimeout, "start-timeout", 0, "how long to wait for the container to start, 0 waits forever")
+	flags.DurationVar(&c.PollInterval, "poll-interval", INTERVAL*time.Millisecond, "how often to poll the container's state besides listening for events")
+	flags.DurationVar(&c.ApiTimeout, "api-timeout", 30*time.Second, "timeout of each docker api call, 0 waits forever")
+	flags.DurationVar(&c.DaemonTimeout, "daemon-timeout", 5*time.Minute, "how long to wait for a restarting docker daemon, 0 waits forever")
+	flags.DurationVar(&c.UnhealthyTimeout, "unhealthy-timeout", 0, "stop the container and fail once it has been unhealthy this long, 0 never does")
+	flags.BoolVar(&c.WatchdogTrigger, "watchdog-trigger", false, "trigger the watchdog as soon as the container is unhealthy instead of letting it time out")
+	flags.BoolVar(&c.MountUnitDirs, "mount-unit-dirs", false, "bind mount the unit's RuntimeDirectory=, StateDirectory=, CacheDirectory= and LogsDirectory=")
+	flags.StringSliceVar(&unitDirTargets, "unit-dir-target", nil, "where --mount-unit-dirs mounts a directory in the container, like state=/data")
+	flags.BoolVar(&c.MkdirVolumes, "mkdir-volumes", false, "create missing bind mount source directories")
+	flags.StringVar(&mkdirMode, "mkdir-mode", "0755", "mode of directories created by --mkdir-volumes")
+	flags.StringVar(&mkdirOwner, "mkdir-owner", "", "user[:group] owning directories created by --mkdir-volumes")
+	flags.DurationVar(&c.GpuWait, "gpu-wait", 0, "how long to wait for the GPU driver and runtime of --gpus containers")
+	flags.DurationVar(&c.ExtendTimeout, "extend-timeout", 0, "keep extending systemd's start timeout by this much while pulling, starting and probing")
+	flags.BoolVar(&c.LinkLifetime, "link-lifetime", false, "stop the container whenever systemd-docker exits, and kill containers a previous run of the unit left behind")
+	flags.BoolVar(&c.KeepRestart, "allow-docker-restart", false, "pass --restart on to docker instead of forcing --restart=no, for live-restore setups")
+	flags.BoolVar(&c.KeepRestart, "keep-restart-policy", false, "pass --restart on to docker instead of leaving restarts to systemd")
+	flags.MarkDeprecated("keep-restart-policy", "use --allow-docker-restart")
+	flags.StringSliceVar(&forwardSignals, "forward-signal", defaultForwardSignals, "signals to pass on to the container, as SIG or SIG:TARGET")
+	flags.StringVar(&c.StopSignal, "stop-signal", "", "signal docker stop sends first, instead of the image's STOPSIGNAL or SIGTERM")
+	flags.StringVar(&stopTimeout, "stop-timeout", "", "how long the container gets to stop before it is killed, by default TIMEOUT_STOP_USEC less 5s if set, otherwise docker's default")
+	flags.BoolVar(&c.Checkpoint, "checkpoint", false, "checkpoint the container with CRIU on stop and restore it on the next start")
+	flags.StringVar(&c.CheckpointDir, "checkpoint-dir", "", "where --checkpoint keeps the checkpoint, by default "+CHECKPOINT_ROOT+"/<name>")
+	flags.StringVar(&c.CgroupSlice, "cgroup-slice", "", "slice to put the container in with the systemd cgroup driver, the unit's slice by default, none to leave it to docker")
+	flags.IntVar(&c.OomScoreAdjust, "oom-score-adjust", 0, "OOM score adjustment of the container, ours is put below it")
+	flags.BoolVar(&c.Recreate, "recreate", true, "recreate a named container created from other run arguments")
+	flags.BoolVar(&c.Gc, "gc", false, "remove stopped containers of the unit left from other names or run arguments")
+	flags.BoolVar(&c.Machine, "machine", false, "register the container with systemd-machined for machinectl")
+	flags.BoolVar(&c.Foreground, "foreground", false, "run the container with docker run in the foreground, keeping the docker CLI as our child")
+	flags.DurationVar(&c.WaitDevice, "wait-device", 0, "wait this long for the devices of --device to appear before starting")
+	flags.BoolVar(&c.UnitLimits, "unit-limits", false, "apply MemoryMax=, CPUQuota= and TasksMax= of the unit to the container")
+	flags.StringVar(&c.PullPolicy, "pull-policy", "", "pull the image before creating the container: always, missing or never, by default docker create pulls missing images")
+	flags.BoolVar(&c.RequireDigest, "require-digest", false, "refuse to run an image that isn't pinned by digest")
+	flags.StringVar(&c.ImagePolicy, "image-policy", IMAGE_POLICY_FILE, "policy file restricting the images units may run, used if it exists")
+	flags.StringArrayVar(&c.VerifyKeys, "verify-key", nil, "only start the image if cosign verifies its signature with this public key")
+	flags.StringVar(&c.VerifyIdentity, "verify-identity", "", "only start the image if it has a keyless cosign signature of this certificate identity")
+	flags.StringVar(&c.VerifyIssuer, "verify-issuer", "", "OIDC issuer of --verify-identity")
+	flags.BoolVar(&c.VerifyNotation, "verify-notation", false, "only start the image if notation verifies it against its trust policy")
+	flags.StringVar(&c.AutoUpdate, "auto-update", "", "recreate the container when its image tag moves: registry or local")
+	flags.DurationVar(&c.UpdateInterval, "auto-update-interval", time.Hour, "how often --auto-update resolves the image tag")
+	flags.BoolVar(&c.DryRun, "dry-run", false, "print what would be done without talking to docker")
+	flags.StringVar(&c.LogSinkCmd, "log-sink", "", "command receiving container log records as JSON lines on stdin")
+	addHookFlags(flags, &c.Hooks)
+	flags.StringArrayVar(&c.PreStopExec, "pre-stop-exec", nil, "command to run inside the container with sh -c before it is stopped")
+	flags.DurationVar(&c.PreStopTimeout, "pre-stop-exec-timeout", 30*time.Second, "timeout for each --pre-stop-exec command")
+	flags.StringVar(&c.ReadyHttp.Url, "ready-http", "", "delay READY=1 until this url responds")
+	flags.IntVar(&c.ReadyHttp.Status, "ready-http-status", 200, "status code expected from --ready-http")
+	flags.DurationVar(&c.ReadyHttp.Timeout, "ready-http-timeout", 5*time.Second, "timeout for each --ready-http request")
+	flags.DurationVar(&c.ReadyHttp.Interval, "ready-http-interval", time.Second, "interval between --ready-http requests")
+	flags.BoolVar(&c.ReadyHttp.Insecure, "ready-http-insecure", false, "skip tls verification for --ready-http")
+	flags.StringVar(&c.ReadyNetwork.Network, "ready-network", "", "delay READY=1 until the container has an address on this network")
+	flags.BoolVar(&c.ReadyNetwork.Ping, "ready-network-ping", false, "also wait until the address of --ready-network answers ping")
+	flags.DurationVar(&c.ReadyNetwork.Interval, "ready-network-interval", time.Second, "interval between --ready-network checks")
+	flags.StringVar(&c.ReadyGrpc.Target, "ready-grpc", "", "delay READY=1 until this host:port[/service] reports SERVING over grpc.health.v1")
+	flags.DurationVar(&c.ReadyGrpc.Timeout, "ready-grpc-timeout", 5*time.Second, "timeout for each --ready-grpc check")
+	flags.DurationVar(&c.ReadyGrpc.Interval, "ready-grpc-interval", time.Second, "interval between --ready-grpc checks")
+	flags.StringVar(&c.ContainerEnvFile, "container-env-file", "", "write the container's id, ip and ports to this file for EnvironmentFile=")
+	flags.StringVar(&c.MetricsFile, "metrics-textfile", "", "periodically write container metrics in prometheus text format to this file")
+	flags.DurationVar(&c.MetricsInterval, "metrics-interval", 15*time.Second, "how often to write --metrics-textfile")
+	flags.BoolVar(&c.HealthStatus, "health-status", true, "show the output of the container's health check in STATUS=")
+	flags.DurationVar(&c.HealthInterval, "health-status-interval", 10*time.Second, "how often to update STATUS= from the health check")
+	flags.BoolVar(&c.StatsStatus, "stats-status", false, "show the container's CPU and memory usage in STATUS=")
+	flags.DurationVar(&c.StatsInterval, "stats-status-interval", 10*time.Second, "how often to update STATUS= with the container's usage")
+	flags.StringVar(&selfLevel, "log-level", "info", "systemd-docker's own log level: error, warn, info or debug")
+	flags.StringVar(&selfFormat, "log-format", "text", "systemd-docker's own log format: text or json")
+	flags.StringVar(&logLevel, "log-level-filter", "", "drop container log lines less severe than this syslog level")
+	flags.StringArrayVar(&logFilters, "log-filter", nil, "drop container log lines matching this regular expression, or with a leading ! those not matching it")
+	flags.DurationVar(&c.LogFilterReport, "log-filter-report", time.Minute, "how often to log the number of dropped log lines, 0 never does")
+	flags.BoolVar(&c.LogJournal, "log-journal", false, "send container logs to journald directly, tagged with the container name")
+	flags.StringVar(&c.SyslogIdentifier, "syslog-identifier", "", "SYSLOG_IDENTIFIER of --log-journal entries, the container name by default")
+	flags.IntVar(&c.LogMaxLine, "log-max-line", 0, "cut container log lines longer than this many bytes, 0 keeps them whole")
+	flags.StringVar(&stderrLevel, "stderr-level", "err", "syslog level of container stderr lines without a level of their own, empty to leave them alone")
+
+	i := findRunArg(args)
+	if i < 0 {
+		logError("Args:", args)
+		return nil, errors.New("run not found in arguments")
+	}
+
+	ownArgs := args[:i]
+	runArgs := args[i+1:]
+
+	if hasStrictArgs(ownArgs) {
+		err := validateArgs(flags, ownArgs, runArgs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := flags.Parse(ownArgs)
+	if err != nil {
+		return nil, err
+	}
+	c.LogsForced = flags.Changed("logs")
+	c.OomScoreSet = flags.Changed("oom-score-adjust")
+
+	c.StopTimeout = -1
+	if len(stopTimeout) > 0 {
+		c.StopTimeout, err = parseStopTimeout(stopTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.StopSignal, err = parseStopSignal(c.StopSignal)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ForwardSignals, err = parseForwardSignals(forwardSignals)
+	if err != nil {
+		return nil, err
+	}
+
+	c.NotifyMode, err = parseNotifyMode(c.NotifyMode)
+	if err != nil {
+		return nil, err
+	}
+	c.Notify = c.NotifyMode == NOTIFY_PROXY
+
+	if !validNotifyRelabel(c.NotifyRelabel) {
+		return nil, errors.New(fmt.Sprintf("Invalid --notify-relabel %s, expected z or Z", c.NotifyRelabel))
+	}
+
+	if !validPullPolicy(c.PullPolicy) {
+		return nil, errors.New(fmt.Sprintf("Invalid --pull-policy %s, expected always, missing or never", c.PullPolicy))
+	}
+
+	if c.PollInterval <= 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid --poll-interval %s, it must be positive", c.PollInterval))
+	}
+
+	switch c.OnSuccess {
+	case "exit", "restart", "remain":
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid --on-success value %s, expected exit, restart or remain", c.OnSuccess))
+	}
+
+	if len(logLevel) > 0 {
+		c.LogLevel, err = parseLogLevel(logLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.LogMaxLine < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid --log-max-line %d, it must not be negative", c.LogMaxLine))
+	}
+
+	c.LogFilters, err = parseLogFilters(logFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	c.UnitDirTargets, err = parseUnitDirTargets(unitDirTargets)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := strconv.ParseUint(mkdirMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return nil, errors.New(fmt.Sprintf("Invalid --mkdir-mode %s, expected an octal mode", mkdirMode))
+	}
+	c.MkdirMode = os.FileMode(mode)
+
+	if len(mkdirOwner) > 0 {
+		c.MkdirUid, c.MkdirGid, err = parseOwner(mkdirOwner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(stderrLevel) > 0 {
+		c.StderrLevel, err = parseLogLevel(stderrLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	selfLogLevel, err = parseSelfLogLevel(selfLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setSelfLogFormat(selfFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range append(c.EnvInclude, c.EnvExclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid environment pattern %s: %s", pattern, err))
+		}
+	}
+
+	if len(c.EnvInclude) > 0 || len(c.EnvExclude) > 0 {
+		c.Env = true
+	}
+
+	if !c.KeepRestart {
+		var policy string
+		runArgs, policy = stripRestartPolicy(runArgs)
+		if len(policy) > 0 && policy != "no" {
+			logWarn(fmt.Sprintf("Ignoring --restart=%s, docker restarting the container behind systemd's back "+
+				"breaks supervision, use Restart= in the unit or --allow-docker-restart", policy))
+		}
+	}
+
+	foundD := false
+	var name string
+
+	newArgs := removeRunFlags(runArgs, func(f runFlag) bool {
+		switch f.Name {
+		case "rm":
+			c.Rm = f.Value != "false"
+			return true
+		case "detach":
+			foundD = true
+		case "interactive":
+			c.Stdin = f.Value != "false"
+		case "name":
+			name = f.Value
+		}
+		return false
+	})
+
+	if len(name) == 0 && c.DefaultName {
+		if unit := unitName(c); len(unit) > 0 {
+			name = containerName(unit)
+			newArgs = append([]string{"--name", name}, newArgs...)
+		}
+	}
+
+	if c.Attach {
+		newArgs = append([]string{"--interactive"}, newArgs...)
+	} else if !foundD && !c.Foreground {
+		newArgs = append([]string{"-d"}, newArgs...)
+	}
+
+	c.Name = name
+	if len(name) > 0 {
+		setLogField("name", name)
+	}
+	if c.NotifyMode != NOTIFY_OFF {
+		c.NotifySocket = os.Getenv("NOTIFY_SOCKET")
+	}
+	c.Args = newArgs
+
+	if c.RmVolumes && !c.Rm {
+		return nil, errors.New("--rm-volumes needs --rm in the run arguments")
+	}
+	if c.PruneImage && !c.Rm {
+		return nil, errors.New("--prune-image needs --rm in the run arguments")
+	}
+
+	err = checkOomScoreAdjust(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkStopSignal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := unitLimitArgs(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Args = append(limits, c.Args...)
+	c.Args = append(stopSignalArgs(c), c.Args...)
+	if len(c.Name) > 0 {
+		c.ConfigHash = configHash(c.Args)
+	}
+
+	setupEnvironment(c)
+
+	err = checkCheckpoint(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkForeground(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkVerify(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkAutoUpdate(c)
+	if err != nil {
+		return nil, err
+	}
+	c.updated = make(chan struct{}, 1)
+
+	err = c.ReadyGrpc.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDigestRef(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkImagePolicy(c.ImagePolicy, imageRef(c.Args))
+	if err != nil {
+		return nil, err
+	}
+
+	logDebug("Context:", describeContext(c))
+
+	return c, nil
+}
+
+/* describeContext is what we log of c for debugging.  The whole Context has
+ * the environment, probe urls and hook commands in it, this sticks to what
+ * tells how we were started. */
+func describeContext(c *Context) string {
+	return fmt.Sprintf("name=%q args=%q notify=%t mode=%s logs=%t rm=%t pull=%s start-timeout=%s api-timeout=%s on-success=%s foreground=%t attach=%t",
+		c.Name, redactedArgs(c.Args), c.Notify, c.NotifyMode, c.Logs, c.Rm, c.PullPolicy, c.StartTimeout, c.ApiTimeout, c.OnSuccess, c.Foreground, c.Attach)
+}
+
+func findRunArg(args []string) int {
+	for i, arg := range args {
+		if arg == "run" {
+			return i
+		}
+	}
+	return -1
+}
+
+func lookupNamedContainer(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Name)
+	if dockerx.IsNotFound(err) {
+		return nil
+	}
+	if err != nil || container == nil {
+		return err
+	}
+
+	recreated, err := recreateChanged(c, client, container)
+	if recreated || err != nil {
+		return err
+	}
+
+	if container.State.Running {
+		err = verifyDigest(c, container)
+		if err != nil {
+			return err
+		}
+
+		err = verifySignature(c, container)
+		if err != nil {
+			return err
+		}
+
+		adoptContainer(c, container)
+		return nil
+	} else if c.Rm {
+		ctx, cancel := apiContext(c)
+		defer cancel()
+
+		return client.ContainerRemove(ctx, container.ID, dockerContainer.RemoveOptions{Force: true, RemoveVolumes: c.RmVolumes})
+	} else {
+		c.Id = container.ID
+		disableRestartPolicy(c, client, container)
+		return startContainer(c)
+	}
+}
+
+/* docker create doesn't take -d, it's implied */
+func createArgs(args []string) []string {
+	return removeRunFlags(args, func(f runFlag) bool {
+		return f.Name == "detach"
+	})
+}
+
+/* argValue returns the value of a docker flag given before the image */
+func argValue(args []string, name string) (string, bool) {
+	f, ok := findRunFlag(args, strings.TrimLeft(name, "-"))
+	return f.Value, ok
+}
+
+/* createContainer runs docker create and reads the id back from a cidfile
+ * rather than from the output, which docker may mix with other messages */
+func createContainer(c *Context) error {
+	args := append(cgroupParentArgs(c), restartArgs(c)...)
+	args = append(args, createArgs(c.Args)...)
+
+	if creator, ok := c.Runtime.(runtime.Creator); ok {
+		id, err := creator.Create(rootContext(c), args)
+		c.Id = id
+		return err
+	}
+
+	cidfile, ok := argValue(args, "--cidfile")
+	if !ok {
+		dir, err := ioutil.TempDir("", "systemd-docker")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		cidfile = path.Join(dir, "cid")
+		args = append([]string{"--cidfile", cidfile}, args...)
+	}
+
+	c.Cmd = exec.CommandContext(rootContext(c), "docker", append([]string{"create"}, args...)...)
+	c.Cmd.Env = append(os.Environ(), "DOCKER_HOST="+dockerHost())
+	c.Cmd.Stdout = ioutil.Discard
+	c.Cmd.Stderr = os.Stderr
+
+	err := c.Cmd.Run()
+
+	/* docker writes the cidfile as soon as the container exists, so even a
+	 * failed create tells us what to clean up.  A cidfile of the user may be
+	 * left over from an earlier run though, so only trust it on success */
+	if err == nil || !ok {
+		bytes, readErr := ioutil.ReadFile(cidfile)
+		if readErr == nil {
+			c.Id = strings.TrimSpace(string(bytes))
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(c.Id) == 0 {
+		return errors.New(fmt.Sprintf("docker create did not write a container id to %s", cidfile))
+	}
+
+	return nil
+}
+
+/* The container is created first and started only once the log stream is
+ * attached, so no output, early exit or pid is lost in between */
+func launchContainer(c *Context) error {
+	err := waitDevices(c)
+	if err != nil {
+		return err
+	}
+
+	err = gpuPreflight(c)
+	if err != nil {
+		return err
+	}
+
+	err = mkdirVolumes(c)
+	if err != nil {
+		return err
+	}
+
+	began := time.Now()
+	err = ensureImage(c)
+	if err != nil {
+		return err
+	}
+	timePhase(c, "pull", began)
+
+	if c.Foreground {
+		began = time.Now()
+		err = runForeground(c)
+		timePhase(c, "start", began)
+	} else {
+		began = time.Now()
+		err = createContainer(c)
+		timePhase(c, "create", began)
+		if err == nil {
+			err = startContainer(c)
+		}
+	}
+
+	if err != nil && len(c.Id) > 0 {
+		/* Never started, removing it keeps the name free for the next try */
+		cleanupHalfStarted(c)
+	}
+
+	return err
+}
+
+func startContainer(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	err = verifyDigest(c, container)
+	if err != nil {
+		return err
+	}
+
+	err = verifySignature(c, container)
+	if err != nil {
+		return err
+	}
+
+	detectJournald(c, client, container)
+
+	err = attachLogs(c)
+	if err != nil {
+		return err
+	}
+
+	began := time.Now()
+	err = startFromCheckpoint(c, client)
+	if err != nil {
+		return err
+	}
+	timePhase(c, "start", began)
+
+	if c.Attach {
+		resizeTty(c)
+	}
+
+	began = time.Now()
+	container, err = inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	setContainerState(c, container)
+	timePhase(c, "pid", began)
+
+	if !container.State.Running {
+		/* Already done, there is no pid to hand to systemd */
+		c.Exited = true
+		c.ExitCode = container.State.ExitCode
+		c.Pid = 0
+	}
+
+	return nil
+}
+
+func setContainerState(c *Context, container *dockerContainer.InspectResponse) {
+	c.Id = container.ID
+	c.Pid = container.State.Pid
+	c.StartedAt = dockerx.StartedAt(container)
+	trackCgroup(c)
+}
+
+/* adoptContainer takes over a container that was already running, its
+ * earlier output is in the journal already */
+func adoptContainer(c *Context, container *dockerContainer.InspectResponse) {
+	logInfo("Re-adopting running container", shortId(container.ID))
+	setContainerState(c, container)
+	c.LogsSince = time.Now()
+
+	if client, err := getClient(c); err == nil {
+		detectJournald(c, client, container)
+		disableRestartPolicy(c, client, container)
+	}
+}
+
+func runContainer(c *Context) error {
+	err := restoreState(c)
+	if err != nil {
+		logWarn("Failed to restore state from fd store:", err)
+	}
+
+	/* Without a name to look it up by, a container left running by a crash
+	 * of ours is found by its unit */
+	if len(c.Id) == 0 && len(c.Name) == 0 {
+		err := adoptUnitContainer(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.Id) == 0 && len(c.Name) > 0 {
+		err := lookupNamedContainer(c)
+		if err != nil {
+			return err
+		}
+
+	}
+
+	if len(c.Id) == 0 {
+		err := launchContainer(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Pid == 0 && !c.Exited {
+		return errors.New("Failed to launch container, pid is 0")
+	}
+
+	return nil
+}
+
+func runContainerWithTimeout(c *Context) error {
+	if c.StartTimeout <= 0 {
+		return runContainer(c)
+	}
+
+	/* Every step gives up once ctx expires, waiting for runContainer keeps
+	 * the cleanup from racing a create or start still in flight */
+	root := c.Ctx
+	ctx, cancel := context.WithTimeout(rootContext(c), c.StartTimeout)
+	c.Ctx = ctx
+	err := runContainer(c)
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	c.Ctx = root
+	cancel()
+
+	if err == nil || !timedOut {
+		return err
+	}
+
+	logWarn(fmt.Sprintf("Container did not start within %s, cleaning up", c.StartTimeout))
+	cleanupHalfStarted(c)
+
+	return ErrStartTimeout
+}
+
+func cleanupHalfStarted(c *Context) {
+	if c.Cmd != nil && c.Cmd.Process != nil {
+		c.Cmd.Process.Kill()
+	}
+
+	target := c.Id
+	if len(target) == 0 {
+		target = c.Name
+	}
+	if len(target) == 0 {
+		target = invocationContainer(c)
+	}
+
+	if len(target) == 0 {
+		return
+	}
+
+	rt, err := getRuntime(c)
+	if err != nil {
+		logWarn("Failed to remove container", target, err)
+		return
+	}
+
+	ctx, cancel := cleanupContext(c, 0)
+	defer cancel()
+
+	err = rt.Remove(ctx, target, c.RmVolumes)
+	if err != nil && !runtime.IsNotFound(err) {
+		logWarn("Failed to remove container", target, err)
+	}
+}
+
+/* Rootless docker and podman listen in the user's runtime directory, look
+ * there first so --user units work without setting DOCKER_HOST */
+func dockerHost() string {
+	endpoint := os.Getenv("DOCKER_HOST")
+	if len(endpoint) > 0 {
+		return endpoint
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if len(runtimeDir) > 0 {
+		for _, socket := range []string{"docker.sock", "podman/podman.sock"} {
+			socket = path.Join(runtimeDir, socket)
+			if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+				return "unix://" + socket
+			}
+		}
+	}
+
+	return DEFAULT_DOCKER_HOST
+}
+
+/* The client is shared, so the API version is only negotiated once */
+func getClient(c *Context) (dockerx.API, error) {
+	if c.Client != nil {
+		return c.Client, nil
+	}
+
+	client, err := dockerx.NewClient(dockerHost(), traceDocker())
+	if err != nil {
+		return nil, err
+	}
+
+	c.Client = client
+	return client, nil
+}
+
+/* getRuntime is what drives the container once it exists, docker unless an
+ * embedding program or a test set another */
+func getRuntime(c *Context) (runtime.ContainerRuntime, error) {
+	if c.Runtime != nil {
+		return c.Runtime, nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Runtime = runtime.NewDocker(client)
+	return c.Runtime, nil
+}
+
+func getContainerPid(c *Context) (int, error) {
+	rt, err := getRuntime(c)
+	if err != nil {
+		return 0, err
+	}
+
+	container, err := inspectRuntime(c, rt, c.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	if container == nil {
+		return 0, errors.New(fmt.Sprintf("Failed to find container %s", c.Id))
+	}
+
+	if container.State.Pid <= 0 {
+		return 0, errors.New(fmt.Sprintf("Pid is %d for container %s", container.State.Pid, c.Id))
+	}
+
+	c.StartedAt = container.State.StartedAt
+
+	return container.State.Pid, nil
+}
+
+/* Uptime is based on the container's StartedAt as reported by docker, not on
+ * when we started, so re-attaching to a running container keeps the clock. */
+func uptime(c *Context) time.Duration {
+	if c.StartedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.StartedAt)
+}
+
+func statusMessage(c *Context) string {
+	if c.StartedAt.IsZero() {
+		return fmt.Sprintf("STATUS=Container %s running", shortId(c.Id))
+	}
+
+	return fmt.Sprintf("STATUS=Container %s running since %s (up %s)", shortId(c.Id),
+		c.StartedAt.Local().Format(time.RFC3339), uptime(c).Truncate(time.Second))
+}
+
+func shortId(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func notifySystemd(c *Context) error {
+	if c.Exited {
+		/* It did its job before we could even track it */
+		if c.ExitCode == 0 && !c.Notify {
+			return sendNotify(c, "READY=1")
+		}
+		return nil
+	}
+
+	if containerDied(c) {
+		return errors.New("Container exited before we could notify systemd")
+	}
+
+	if len(c.NotifySocket) == 0 {
+		return nil
+	}
+
+	conn, err := net.Dial("unixgram", c.NotifySocket)
+	if err != nil {
+		return notifyFailed(c, err)
+	}
+
+	defer conn.Close()
+
+	logDebug("Notify:", fmt.Sprintf("MAINPID=%d", mainPid(c)))
+	_, err = conn.Write([]byte(fmt.Sprintf("MAINPID=%d", mainPid(c))))
+	if err != nil {
+		return notifyFailed(c, err)
+	}
+
+	if containerDied(c) {
+		conn.Write([]byte(fmt.Sprintf("MAINPID=%d", os.Getpid())))
+		return errors.New("Container exited before we could notify systemd")
+	}
+
+	logDebug("Notify:", statusMessage(c))
+	conn.Write([]byte(statusMessage(c)))
+
+	if !c.Notify {
+		stopExtending := extendTimeout(c)
+		began := time.Now()
+		err = waitReady(c)
+		stopExtending()
+		if err != nil {
+			return withExitCode(EXIT_NOT_READY, err)
+		}
+		timePhase(c, "ready", began)
+
+		logDebug("Notify: READY=1")
+		_, err = conn.Write([]byte("READY=1"))
+		if err != nil {
+			return notifyFailed(c, err)
+		}
+	}
+
+	/* Make sure MAINPID is in before the container can exit and we go away */
+	err = notifyBarrier(c)
+	if err != nil {
+		logWarn("Notify barrier failed:", err)
+	}
+
+	return nil
+}
+
+/* When the container is expected to exit and be restarted (or outlived) by us,
+ * systemd has to track our pid instead or it would stop the unit on exit. */
+func mainPid(c *Context) int {
+	if c.OnSuccess != "exit" {
+		return os.Getpid()
+	}
+	return c.Pid
+}
+
+func sendNotify(c *Context, messages ...string) error {
+	for _, msg := range messages {
+		logDebug("Notify:", msg)
+	}
+	return notify.Send(c.NotifySocket, messages...)
+}
+
+/* Pulls and readiness checks can take longer than TimeoutStartSec= allows,
+ * keep pushing the timeout out while they run.  Returns a func ending it */
+func extendTimeout(c *Context) func() {
+	if c.ExtendTimeout <= 0 || len(c.NotifySocket) == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.ExtendTimeout / 2)
+		defer ticker.Stop()
+
+		for {
+			err := sendNotify(c, fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d", c.ExtendTimeout/time.Microsecond))
+			if err != nil {
+				logWarn("Failed to extend start timeout:", err)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+func pidFile(c *Context) error {
+	if len(c.PidFile) == 0 || c.Pid <= 0 {
+		return nil
+	}
+
+	err := os.MkdirAll(path.Dir(c.PidFile), 0755)
+	if err != nil {
+		return err
+	}
+
+	/* systemd reads PIDFile= as soon as we are ready, never let it see half a
+	 * pid */
+	return writeFileAtomic(c.PidFile, []byte(strconv.Itoa(c.Pid)), 0644)
+}
+
+/* A pid file left behind by a crashed run may point at an unrelated process
+ * by now, drop it before systemd gets a chance to read it */
+func removeStalePidFile(c *Context) {
+	if len(c.PidFile) == 0 {
+		return
+	}
+
+	bytes, err := ioutil.ReadFile(c.PidFile)
+	if err != nil {
+		return
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(bytes)))
+	if err == nil && pid > 0 && processAlive(pid) {
+		logInfo(fmt.Sprintf("Pid file %s of a previous run points at live pid %d, it will be overwritten", c.PidFile, pid))
+		return
+	}
+
+	logInfo("Removing stale pid file", c.PidFile)
+	os.Remove(c.PidFile)
+}
+
+func removePidFile(c *Context) {
+	if len(c.PidFile) == 0 {
+		return
+	}
+
+	err := os.Remove(c.PidFile)
+	if err != nil && !os.IsNotExist(err) {
+		logWarn("Failed to remove pid file", c.PidFile, err)
+	}
+}
+
+func cidFile(c *Context) error {
+	if len(c.CidFile) == 0 || len(c.Id) == 0 {
+		return nil
+	}
+
+	return writeFileAtomic(c.CidFile, []byte(c.Id), 0644)
+}
+
+func removeCidFile(c *Context) {
+	if len(c.CidFile) == 0 {
+		return
+	}
+
+	os.Remove(c.CidFile)
+}
+
+func logWriters(c *Context) (io.Writer, io.Writer) {
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+
+	stderrLevel := defaultLogLevel
+	if c.StderrLevel >= 0 {
+		stderrLevel = c.StderrLevel
+	}
+
+	if c.LogJournal {
+		stdout = newJournalWriter(c, os.Stdout, defaultLogLevel)
+		stderr = newJournalWriter(c, os.Stderr, stderrLevel)
+	}
+
+	maxLevel := c.LogLevel
+	if maxLevel < 0 && (len(os.Getenv("JOURNAL_STREAM")) > 0 || c.LogJournal) {
+		/* Every line would be info to the journal otherwise, and the
+		 * unit's LogLevelMax= would keep or drop all of them */
+		maxLevel = 7
+	}
+	if maxLevel >= 0 {
+		stdout = newLevelWriter(stdout, maxLevel, defaultLogLevel, &c.LogsDropped)
+		stderr = newLevelWriter(stderr, maxLevel, stderrLevel, &c.LogsDropped)
+	}
+
+	if len(c.LogFilters) > 0 {
+		stdout = newFilterWriter(stdout, c.LogFilters, &c.LogsDropped)
+		stderr = newFilterWriter(stderr, c.LogFilters, &c.LogsDropped)
+	}
+
+	if c.LogSink != nil {
+		stdout = io.MultiWriter(stdout, newSinkWriter(c, "stdout"))
+		stderr = io.MultiWriter(stderr, newSinkWriter(c, "stderr"))
+	}
+
+	if c.LogMaxLine > 0 {
+		stdout = newTruncateWriter(stdout, c.LogMaxLine)
+		stderr = newTruncateWriter(stderr, c.LogMaxLine)
+	}
+
+	return &cursorWriter{stdout, &c.logs}, &cursorWriter{stderr, &c.logs}
+}
+
+/* attachLogs streams the output of a container that is about to be started */
+func attachLogs(c *Context) error {
+	if c.Attach {
+		return attachStdio(c)
+	}
+
+	if c.Stdin {
+		err := attachStdin(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !pipingLogs(c) {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	stdout, stderr := logWriters(c)
+
+	stream, err := attachContainer(c, client, dockerx.HasTty(container), nil, stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	c.logs.replace(func() { stream.Close() })
+	c.Attached = true
+	return nil
+}
+
+/* Only stream the current run, a restarted container keeps its old logs.  An
+ * adopted container's logs up to now have been streamed before. */
+func pipeLogs(c *Context) error {
+	return pipeLogsSince(c, time.Time{})
+}
+
+/* pipeLogsSince streams from, or from the start of the current run if from
+ * is zero.  The stream stays with the container it began on, an update
+ * replacing it starts another one. */
+func pipeLogsSince(c *Context, from time.Time) error {
+	if !pipingLogs(c) {
+		return nil
+	}
+
+	rt, err := getRuntime(c)
+	if err != nil {
+		return err
+	}
+
+	c.identity.RLock()
+	id := c.Id
+	if from.IsZero() {
+		from = c.StartedAt
+		if c.LogsSince.After(from) {
+			from = c.LogsSince
+		}
+	}
+	stdout, stderr := logWriters(c)
+	c.identity.RUnlock()
+
+	return rt.Logs(streamContext(c), id, from, stdout, stderr)
+}
+
+func streamLogs(c *Context, from time.Time, stdout, stderr io.Writer) error {
+	rt, err := getRuntime(c)
+	if err != nil {
+		return err
+	}
+
+	return rt.Logs(streamContext(c), c.Id, from, stdout, stderr)
+}
+
+/* staysAround is true when we have to outlive the start, otherwise systemd
+ * just tracks the container once it is up */
+func staysAround(c *Context) bool {
+	return c.Logs || c.Rm || c.LinkLifetime || c.Foreground || c.Machine || c.OnSuccess != "exit" ||
+		len(c.AutoUpdate) > 0 || len(c.PreStopExec) > 0 || c.UnhealthyTimeout > 0
+}
+
+func keepAlive(c *Context) error {
+	if staysAround(c) {
+		rt, err := getRuntime(c)
+		if err != nil {
+			return err
+		}
+
+		for true {
+			container, err := waitForExit(c)
+			if err != nil {
+				return err
+			}
+
+			if updating(c) {
+				err = replaceContainer(c)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			c.ExitCode = container.State.ExitCode
+			c.OOMKilled = container.State.OOMKilled
+			if c.OOMKilled {
+				oomKilled(c)
+			}
+			exitedEvent(c, fmt.Sprintf("Container %s exited with code %d", shortId(c.Id), c.ExitCode))
+
+			if c.ExitCode != 0 || c.OnSuccess != "restart" || unhealthyStopped(c) {
+				return nil
+			}
+
+			logInfo(fmt.Sprintf("Container %s exited successfully, restarting it", shortId(c.Id)))
+			err = restartContainer(c, rt)
+			if err != nil {
+				return err
+			}
+
+			containerStarted(c)
+		}
+	}
+
+	return nil
+}
+
+func restartContainer(c *Context, rt runtime.ContainerRuntime) error {
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	return rt.Start(ctx, c.Id)
+}
+
+func oomKilled(c *Context) {
+	sendNotify(c, "STATUS=oom-killed")
+	notifyBarrier(c)
+	journalEvent(c, LOG_ERROR, MESSAGE_OOM_KILLED, fmt.Sprintf("Container %s was OOM killed", shortId(c.Id)), map[string]string{
+		"CONTAINER_OOM_KILLED": "1",
+		"CONTAINER_EXIT_CODE":  strconv.Itoa(c.ExitCode),
+	})
+}
+
+/* Analog of RemainAfterExit=yes, the unit stays active until it is stopped */
+func remain(c *Context) {
+	if c.OnSuccess != "remain" || c.ExitCode != 0 {
+		return
+	}
+
+	sendNotify(c, fmt.Sprintf("STATUS=Container %s exited successfully", shortId(c.Id)))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+}
+
+/* abortStart stops a container that already runs when we are stopped before
+ * the signals stop it, --rm still decides whether it is removed */
+func abortStart(c *Context) {
+	if !cancelled(c) || len(c.Id) == 0 {
+		return
+	}
+
+	logInfo(fmt.Sprintf("Stopping container %s, the unit stopped while it started", shortId(c.Id)))
+	err := stopContainer(c)
+	if err != nil {
+		logWarn("Failed to stop container:", err)
+	}
+
+	err = rmContainer(c)
+	if err != nil {
+		logWarn("Failed to remove container:", err)
+	}
+}
+
+func rmContainer(c *Context) error {
+	if !c.Rm {
+		return nil
+	}
+
+	rt, err := getRuntime(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := cleanupContext(c, 0)
+	defer cancel()
+
+	return rt.Remove(ctx, c.Id, c.RmVolumes)
+}
+
+/* Run supervises the container described by args for the life of the unit,
+ * it returns once the container has exited or the unit stops */
+func Run(args []string) (*Context, error) {
+	began := time.Now()
+	c, err := Parse(args)
+	if err != nil {
+		return c, err
+	}
+	timePhase(c, "parse", began)
+	return supervise(c, began)
+}
+
+/* watch runs fn in the background until the context of c ends */
+func watch(watchers *sync.WaitGroup, c *Context, fn func(c *Context)) {
+	watchers.Add(1)
+	go func() {
+		defer watchers.Done()
+		fn(c)
+	}()
+}
+
+/* supervise is Run once the arguments are parsed, began is when Run was
+ * called, for the startup report */
+func supervise(c *Context, began time.Time) (*Context, error) {
+	if c.DryRun {
+		printPlan(c, os.Stdout)
+		return c, nil
+	}
+
+	defer restoreTerminal()
+
+	/* The goroutines watching the container end with us */
+	ctx, cancel := context.WithCancel(rootContext(c))
+	c.Ctx = ctx
+	var watchers sync.WaitGroup
+	defer func() {
+		cancel()
+		watchers.Wait()
+	}()
+
+	err := openLogSink(c)
+	if err != nil {
+		return c, err
+	}
+
+	defer closeLogSink(c)
+
+	err = openNotifyProxy(c)
+	if err != nil {
+		return c, err
+	}
+
+	defer closeNotifyProxy(c)
+
+	signals := handleStopSignals(c, cancel)
+	defer signals.stop()
+
+	err = runHooks(c, "pre-start")
+	if err != nil {
+		return c, err
+	}
+
+	removeStalePidFile(c)
+	adjustOwnOomScore(c)
+
+	err = checkAPIVersion(c)
+	if err != nil {
+		return c, err
+	}
+
+	err = killOrphans(c)
+	if err != nil {
+		return c, err
+	}
+
+	defer stopLinked(c)
+
+	err = collectGarbage(c)
+	if err != nil {
+		return c, err
+	}
+
+	stopExtending := extendTimeout(c)
+	err = runContainerWithTimeout(c)
+	stopExtending()
+	if err != nil {
+		if cancelled(c) {
+			cleanupHalfStarted(c)
+		}
+		if err == ErrStartTimeout {
+			return c, err
+		}
+		return c, withExitCode(EXIT_START_FAILED, err)
+	}
+
+	handedOver := false
+	defer func() {
+		if !handedOver {
+			abortStart(c)
+		}
+	}()
+
+	setLogField("container", c.Id)
+	if c.Exited {
+		exitedEvent(c, fmt.Sprintf("Container %s already exited with code %d", shortId(c.Id), c.ExitCode))
+	} else {
+		startedEvent(c)
+	}
+
+	err = notifySystemd(c)
+	if err != nil {
+		return c, err
+	}
+	logInfo(startupReport(c, time.Since(began)))
+
+	err = runHooks(c, "post-start")
+	if err != nil {
+		return c, err
+	}
+
+	err = pidFile(c)
+	if err != nil {
+		return c, err
+	}
+
+	defer removePidFile(c)
+
+	err = cidFile(c)
+	if err != nil {
+		return c, err
+	}
+
+	defer removeCidFile(c)
+
+	err = writeContainerEnv(c)
+	if err != nil {
+		return c, err
+	}
+
+	defer removeContainerEnv(c)
+
+	registerMachine(c)
+	defer unregisterMachine(c)
+
+	err = storeState(c)
+	if err != nil {
+		logWarn("Failed to store state in fd store:", err)
+	}
+
+	defer removeMetrics(c)
+
+	if !c.Attached {
+		go pipeLogs(c)
+	}
+	/* Runs before the deferred removeMetrics */
+	stopMetrics := writeMetrics(c)
+	defer stopMetrics()
+	watch(&watchers, c, runWatchdog)
+	watch(&watchers, c, runHealthStatus)
+	watch(&watchers, c, runStatsStatus)
+	watch(&watchers, c, reportFiltered)
+	watch(&watchers, c, runAutoUpdate)
+	watch(&watchers, c, runUnhealthyTimeout)
+
+	handedOver = true
+	signals.setPhase(SIGNALS_STOP)
+	stopHup := handleHup(c)
+	stopForwarding := handleForwardSignals(c)
+	err = keepAlive(c)
+	stopForwarding()
+	stopHup()
+	signals.setPhase(SIGNALS_CLEANUP)
+	if err != nil {
+		return c, err
+	}
+
+	forgetState(c)
+
+	image := pruneCandidate(c)
+	err = rmContainer(c)
+	if err != nil {
+		return c, withExitCode(EXIT_CLEANUP_FAILED, err)
+	}
+	pruneImage(c, image)
+
+	err = runHooks(c, "post-stop")
+	if err != nil {
+		return c, err
+	}
+
+	if c.OOMKilled {
+		return c, ErrOOMKilled
+	}
+	if unhealthyStopped(c) {
+		return c, ErrUnhealthy
+	}
+
+	remain(c)
+
+	return c, nil
+}
+
+/* Anything that isn't a subcommand is handled as systemd-docker [flags] run ... */
+var subcommands = map[string]func(args []string) error{
+	"rollout":     rolloutMain,
+	"conformance": conformanceMain,
+	"check":       checkMain,
+	"compose":     composeMain,
+	"daemon":      daemonMain,
+}
+
+/* Main is systemd-docker, args don't include the program name.  It returns
+ * the exit code, a container killed by a signal kills us with it. */
+func Main(args []string) int {
+	/* Spreads the poll jitter of units started at the same time */
+	rand.Seed(time.Now().UnixNano() ^ int64(os.Getpid()))
+
+	if len(args) > 0 {
+		if subcommand, ok := subcommands[args[0]]; ok {
+			err := subcommand(args[1:])
+			if err == ErrConditionFailed {
+				return EXIT_CONDITION_FAILED
+			}
+			if err != nil {
+				logError(err)
+				if args[0] == "check" {
+					/* ExecCondition= skips the unit on 1-254, a broken check has to fail it */
+					return EXIT_CONDITION_ERROR
+				}
+				return exitCode(err)
+			}
+			return 0
+		}
+	}
+
+	c, err := Run(args)
+	/* An OOM kill is already logged to the journal */
+	if err != nil && err != ErrOOMKilled {
+		logError(err)
+	}
+
+	code, sig := runExitStatus(c, err)
+	if sig != 0 {
+		logInfo(fmt.Sprintf("Container %s was killed by %s", shortId(c.Id), sig))
+		dieFromSignal(sig)
+	}
+	return code
+}
@@ -0,0 +1,921 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+func init() {
+	INTERVAL = 100
+}
+
+func TestParseNoRun(t *testing.T) {
+	_, err := Parse([]string{"a", "b", "-d"})
+	if err == nil {
+		t.Fatal("parse succeeded")
+	}
+}
+
+func TestParseNotify(t *testing.T) {
+	c, err := Parse([]string{"run"})
+	if err != nil {
+		t.Fatal("parse failed", err)
+	}
+
+	if c.Notify {
+		t.Fatal("notify should be false")
+	}
+
+	c, err = Parse([]string{"--notify", "run"})
+	if err != nil {
+		t.Fatal("parse failed", err)
+	}
+
+	if c.Notify {
+		t.Fatal("notify should be false because NOTIFY_SOCKET is unset")
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	c, err := Parse([]string{"--logs=false", "run", "-rm", "c", "d"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Args[0] != "-d" ||
+		c.Args[1] != "c" ||
+		c.Args[2] != "d" {
+		t.Fatal("Invalid args", c.Args)
+	}
+
+	/* Everything after the image belongs to the container's command */
+	c, err = Parse([]string{"--logs=false", "run", "c", "-rm", "d"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Rm || strings.Join(c.Args, " ") != "-d c -rm d" {
+		t.Fatal("Invalid args", c.Args)
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	c, err := Parse([]string{"run", "--env", "-d"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Env {
+		t.Fatal("env shouldn't be set")
+	}
+
+	c, err = Parse([]string{"--env", "run", "-d"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !c.Env {
+		t.Fatal("env should be set")
+	}
+}
+
+func TestParseLogs(t *testing.T) {
+	c, err := Parse([]string{"run", "--logs", "false", "-d"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !c.Logs {
+		t.Fatal("logs should be set")
+	}
+
+	c, err = Parse([]string{"--logs=false", "run", "-d"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Logs {
+		t.Fatal("logs shouldn't be set")
+	}
+}
+
+func TestParseName(t *testing.T) {
+	c, err := Parse([]string{"run", "-d", "--logs", "--name=blah"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Name != "blah" {
+		t.Fatal("failed to parse name", c.Name)
+	}
+}
+
+func TestParseName2(t *testing.T) {
+	c, err := Parse([]string{"run", "-d", "--logs", "--name", "blah"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Name != "blah" {
+		t.Fatal("failed to parse name", c.Name)
+	}
+}
+
+func TestParseName3(t *testing.T) {
+	c, err := Parse([]string{"run", "-d", "--logs", "-name", "blah"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Name != "blah" {
+		t.Fatal("failed to parse name", c.Name)
+	}
+}
+
+func TestParseName4(t *testing.T) {
+	c, err := Parse([]string{"run", "-d", "--logs", "-name"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if len(c.Name) != 0 {
+		t.Fatal("failed to parse name", c.Name)
+	}
+}
+
+func TestParseRm(t *testing.T) {
+	c, err := Parse([]string{"run", "-d", "--logs", "-name"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Rm {
+		t.Fatal("failed to parse rm", c.Rm)
+	}
+}
+
+func TestParseRmSet(t *testing.T) {
+	c, err := Parse([]string{"run", "-d", "--logs", "-rm"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !c.Rm {
+		t.Fatal("failed to parse rm", c.Rm)
+	}
+}
+
+func TestBadExec(t *testing.T) {
+	c := &Context{
+		Args: []string{"-bad"},
+	}
+
+	err := runContainer(c)
+
+	if err == nil {
+		t.Fatal("Exec should have failed")
+		return
+	}
+
+	if e, ok := err.(*exec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok {
+			if status.ExitStatus() != 125 {
+				log.Fatal("Expect 125 exit code got ", status.ExitStatus())
+			}
+		}
+	} else {
+		t.Fatal("Expect exec.ExitError", err)
+	}
+}
+
+func TestGoodExec(t *testing.T) {
+	c := &Context{
+		Args: []string{"-d", "busybox", "echo", "hi"},
+	}
+
+	err := runContainer(c)
+
+	if err != nil {
+		t.Fatal("Exec should not have failed", err)
+		return
+	}
+
+	if c.Cmd.ProcessState.Pid() <= 0 {
+		t.Fatal("Bad pid", c.Cmd.ProcessState.Pid())
+	}
+
+	if c.Pid <= 0 {
+		t.Fatal("Bad container pid", c.Pid)
+	}
+}
+
+func TestRemoveNoLogs(t *testing.T) {
+	c, err := Run([]string{"--logs=false", "run", "-rm", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = inspectContainer(&Context{}, client, c.Id)
+	if !dockerx.IsNotFound(err) {
+		t.Fatal("Should have failed")
+	}
+}
+
+func TestRemoveWithLogs(t *testing.T) {
+	c, err := Run([]string{"--logs", "run", "-rm", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = inspectContainer(&Context{}, client, c.Id)
+	if !dockerx.IsNotFound(err) {
+		t.Fatal("Should have failed")
+	}
+}
+
+func deleteTestContainer(t *testing.T) {
+	client, err := getClient(&Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container, err := inspectContainer(&Context{}, client, "systemd-docker-test")
+	if err == nil {
+		log.Println("Deleting existing container", container.ID)
+		err = client.ContainerRemove(context.Background(), container.ID, dockerContainer.RemoveOptions{Force: true})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func TestNamedContainerNoRm(t *testing.T) {
+	client, err := getClient(&Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleteTestContainer(t)
+
+	c, err := Run([]string{"--logs", "run", "--privileged=true", "--name", "systemd-docker-test", "--privileged=true", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container, err := inspectContainer(&Context{}, client, "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if container.State.Running {
+		t.Fatal("Should not be running")
+	}
+
+	c, err = Run([]string{"--logs", "run", "--privileged=true", "--name", "systemd-docker-test", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container2, err := inspectContainer(&Context{}, client, c.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if container2.State.Running {
+		t.Fatal("Should not be running")
+	}
+
+	if container.ID != container2.ID {
+		t.Fatal("Should be the same container", container.ID, container2.ID)
+	}
+
+	if !container2.HostConfig.Privileged {
+		t.Fatal("Container2 is not privileged")
+	}
+
+	deleteTestContainer(t)
+}
+
+func TestNamedContainerRmPrevious(t *testing.T) {
+	client, err := getClient(&Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleteTestContainer(t)
+
+	c, err := Run([]string{"--logs", "run", "--name", "systemd-docker-test", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container, err := inspectContainer(&Context{}, client, "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if container.State.Running {
+		t.Fatal("Should not be running")
+	}
+
+	c, err = Run([]string{"--logs", "run", "--rm", "--name", "systemd-docker-test", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = inspectContainer(&Context{}, client, c.Id)
+	if err == nil {
+		t.Fatal("Should not exists")
+	}
+
+	if container.ID == c.Id {
+		t.Fatal("Should not be the same container", container.ID, c.Id)
+	}
+
+	deleteTestContainer(t)
+}
+
+func TestNamedContainerAttach(t *testing.T) {
+	client, err := getClient(&Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleteTestContainer(t)
+
+	c, err := Run([]string{"--logs=false", "run", "--name", "systemd-docker-test", "busybox", "sleep", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container, err := inspectContainer(&Context{}, client, "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !container.State.Running {
+		t.Fatal("Should be running")
+	}
+
+	c, err = Run([]string{"--logs=false", "run", "--name", "systemd-docker-test", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container2, err := inspectContainer(&Context{}, client, c.Id)
+	if err != nil {
+		t.Fatal("Should exists", err)
+	}
+
+	if !container2.State.Running {
+		t.Fatal("Should be running")
+	}
+
+	if container.ID != container2.ID {
+		t.Fatal("Should not be the same container", container.ID, container2.ID)
+	}
+
+	deleteTestContainer(t)
+}
+
+func Exist(path string) bool {
+	_, err := os.Stat(path)
+	return os.IsExist(err)
+}
+
+func TestPidFile(t *testing.T) {
+	client, err := getClient(&Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pidFileName := "./pid-file"
+
+	os.Remove(pidFileName)
+
+	c, err := Run([]string{"--logs=false", "--pid-file", "./pid-file", "run", "--rm", "busybox", "echo", "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = inspectContainer(&Context{}, client, c.Id)
+	if err == nil {
+		t.Fatal("Container should not exist")
+	}
+
+	if _, err := os.Stat(pidFileName); !os.IsNotExist(err) {
+		t.Fatal("Pid file should be removed on exit")
+	}
+}
+
+func TestPidFileWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Context{PidFile: dir + "/run/test.pid", Pid: 1234}
+	err = pidFile(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := ioutil.ReadFile(c.PidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(bytes) != strconv.Itoa(c.Pid) {
+		t.Fatal("Failed to write pid file", string(bytes))
+	}
+
+	removePidFile(c)
+	if _, err := os.Stat(c.PidFile); !os.IsNotExist(err) {
+		t.Fatal("Pid file not removed")
+	}
+}
+
+func TestStalePidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Context{PidFile: dir + "/test.pid"}
+
+	/* Our own pid is certainly alive */
+	ioutil.WriteFile(c.PidFile, []byte(strconv.Itoa(os.Getpid())), 0644)
+	removeStalePidFile(c)
+	if _, err := os.Stat(c.PidFile); err != nil {
+		t.Fatal("Pid file of a live process removed")
+	}
+
+	ioutil.WriteFile(c.PidFile, []byte("garbage"), 0644)
+	removeStalePidFile(c)
+	if _, err := os.Stat(c.PidFile); !os.IsNotExist(err) {
+		t.Fatal("Stale pid file not removed")
+	}
+}
+
+func TestStatusUsesStartedAt(t *testing.T) {
+	c := &Context{
+		Id:        "0123456789abcdef",
+		StartedAt: time.Now().Add(-time.Hour),
+	}
+
+	if uptime(c) < time.Hour {
+		t.Fatal("uptime should be based on StartedAt", uptime(c))
+	}
+
+	status := statusMessage(c)
+	if !strings.HasPrefix(status, "STATUS=Container 0123456789ab running since") {
+		t.Fatal("Bad status", status)
+	}
+
+	c.StartedAt = time.Time{}
+	if uptime(c) != 0 {
+		t.Fatal("uptime should be zero without StartedAt", uptime(c))
+	}
+}
+
+func TestParseOnSuccess(t *testing.T) {
+	c, err := Parse([]string{"run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.OnSuccess != "exit" {
+		t.Fatal("on-success should default to exit", c.OnSuccess)
+	}
+
+	c, err = Parse([]string{"--on-success=restart", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.OnSuccess != "restart" || mainPid(c) != os.Getpid() {
+		t.Fatal("failed to parse on-success", c.OnSuccess)
+	}
+
+	_, err = Parse([]string{"--on-success=bogus", "run", "busybox"})
+	if err == nil {
+		t.Fatal("parse should fail for invalid on-success")
+	}
+}
+
+func TestParseStrictArgs(t *testing.T) {
+	_, err := Parse([]string{"--strict-args", "run", "--rm", "--logs=false", "busybox"})
+	if err == nil || !strings.Contains(err.Error(), "argument 4 (--logs=false)") {
+		t.Fatal("misplaced flag should be rejected", err)
+	}
+
+	_, err = Parse([]string{"--strict-args", "bogus", "run", "busybox"})
+	if err == nil || !strings.Contains(err.Error(), "argument 2 (bogus)") {
+		t.Fatal("positional argument should be rejected", err)
+	}
+
+	c, err := Parse([]string{"--strict-args", "--pid-file", "/run/x.pid", "run", "--env", "A=1", "busybox", "app", "--logs"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !c.StrictArgs || c.PidFile != "/run/x.pid" {
+		t.Fatal("failed to parse strict args", c)
+	}
+
+	_, err = Parse([]string{"run", "--logs=false", "busybox"})
+	if err != nil {
+		t.Fatal("non strict parse should not fail", err)
+	}
+}
+
+func TestParseStartTimeout(t *testing.T) {
+	c, err := Parse([]string{"--start-timeout=90s", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.StartTimeout != 90*time.Second {
+		t.Fatal("failed to parse start-timeout", c.StartTimeout)
+	}
+}
+
+func TestStartTimeoutCancelsCreate(t *testing.T) {
+	c, err := Parse([]string{"--start-timeout=100ms", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	m := runtime.NewMock()
+	m.BlockCreate = true
+	c.Runtime = m
+	c.Client = mockDaemon(t, m)
+
+	err = runContainerWithTimeout(c)
+	if err != ErrStartTimeout {
+		t.Fatal("Expected the start to time out, got", err)
+	}
+
+	/* Create only records the call once its context ended */
+	if strings.Join(m.Calls, ", ") != "create created-1" {
+		t.Fatal("Expected create to be cancelled before cleaning up", m.Calls)
+	}
+	if cancelled(c) {
+		t.Fatal("The start timeout should not outlive the start")
+	}
+}
+
+func TestParseSelfLogLevel(t *testing.T) {
+	_, err := Parse([]string{"--log-level=debug", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if selfLogLevel != LOG_DEBUG {
+		t.Fatal("log level should be debug", selfLogLevel)
+	}
+
+	_, err = Parse([]string{"run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if selfLogLevel != LOG_INFO {
+		t.Fatal("log level should default to info", selfLogLevel)
+	}
+
+	_, err = Parse([]string{"--log-level=loud", "run", "busybox"})
+	if err == nil {
+		t.Fatal("parse should fail")
+	}
+}
+
+func TestParseEnvFilters(t *testing.T) {
+	os.Setenv("SD_TEST_A", "1")
+	os.Setenv("SD_TEST_B", "2")
+	os.Setenv("LISTEN_FDS", "1")
+	os.Setenv("INVOCATION_ID", "xyz")
+	defer os.Unsetenv("SD_TEST_A")
+	defer os.Unsetenv("SD_TEST_B")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("INVOCATION_ID")
+
+	has := func(c *Context, val string) bool {
+		for i, arg := range c.Args {
+			if arg == val && i > 0 && c.Args[i-1] == "-e" {
+				return true
+			}
+		}
+		return false
+	}
+
+	c, err := Parse([]string{"--env", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !has(c, "SD_TEST_A=1") || has(c, "LISTEN_FDS=1") || has(c, "INVOCATION_ID=xyz") {
+		t.Fatal("Bad default env forwarding", c.Args)
+	}
+
+	c, err = Parse([]string{"--env-include=SD_TEST_*,INVOCATION_ID", "--env-exclude=SD_TEST_B", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !c.Env || !has(c, "SD_TEST_A=1") || has(c, "SD_TEST_B=2") || !has(c, "INVOCATION_ID=xyz") || has(c, "LISTEN_FDS=1") {
+		t.Fatal("Bad filtered env forwarding", c.Args)
+	}
+
+	_, err = Parse([]string{"--env-include=[", "run", "busybox"})
+	if err == nil {
+		t.Fatal("bad pattern should fail")
+	}
+}
+
+func TestCreateArgs(t *testing.T) {
+	args := createArgs([]string{"-d", "--name", "test", "--detach", "busybox", "app", "-d"})
+	if strings.Join(args, " ") != "--name test busybox app -d" {
+		t.Fatal("Bad create args", args)
+	}
+}
+
+func TestArgValue(t *testing.T) {
+	args := []string{"--cidfile=/run/a.cid", "--name", "test", "busybox", "--name", "other"}
+
+	value, ok := argValue(args, "--cidfile")
+	if !ok || value != "/run/a.cid" {
+		t.Fatal("Bad cidfile", value)
+	}
+
+	value, ok = argValue(args, "--name")
+	if !ok || value != "test" {
+		t.Fatal("Bad name", value)
+	}
+
+	_, ok = argValue(args, "--label")
+	if ok {
+		t.Fatal("Found a flag that is not there")
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	c, err := Parse([]string{"run", "--restart=always", "--name", "test", "--restart", "on-failure", "busybox", "app", "--restart", "x"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !strings.HasSuffix(strings.Join(c.Args, " "), "-d --name test busybox app --restart x") {
+		t.Fatal("Restart policy not stripped", c.Args)
+	}
+
+	c, err = Parse([]string{"--keep-restart-policy", "run", "--restart=always", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if !strings.HasSuffix(strings.Join(c.Args, " "), "-d --restart=always busybox") {
+		t.Fatal("Restart policy stripped", c.Args)
+	}
+}
+
+func TestParseAttach(t *testing.T) {
+	c, err := Parse([]string{"--attach", "run", "-t", "--name", "test", "busybox", "sh"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	args := strings.Join(c.Args, " ")
+	if !strings.HasSuffix(args, "--interactive -t --name test busybox sh") {
+		t.Fatal("Bad attach args", args)
+	}
+}
+
+func TestParseStdin(t *testing.T) {
+	tests := map[string]bool{
+		"-i":                  true,
+		"-it":                 true,
+		"--interactive":       true,
+		"--interactive=false": false,
+		"-t":                  false,
+	}
+
+	for flag, stdin := range tests {
+		c, err := Parse([]string{"run", flag, "busybox", "cat"})
+		if err != nil {
+			t.Fatal("failed to parse:", err)
+		}
+
+		if c.Stdin != stdin {
+			t.Fatal("Expected stdin", stdin, "for", flag)
+		}
+	}
+}
+
+func TestCidFile(t *testing.T) {
+	cidFileName := "./cid-file"
+	defer os.Remove(cidFileName)
+
+	c, err := Parse([]string{"--cid-file", cidFileName, "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	c.Id = "0123456789abcdef"
+	err = cidFile(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := ioutil.ReadFile(cidFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(bytes) != c.Id {
+		t.Fatal("Failed to write cid file", string(bytes))
+	}
+
+	removeCidFile(c)
+	if _, err := os.Stat(cidFileName); !os.IsNotExist(err) {
+		t.Fatal("cid file should be removed")
+	}
+}
+
+func TestExtendTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := dir + "/notify"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := &Context{NotifySocket: socket, ExtendTimeout: 100 * time.Millisecond}
+	stop := extendTimeout(c)
+
+	buf := make([]byte, 256)
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(buf[:n]) != "EXTEND_TIMEOUT_USEC=100000" {
+			t.Fatal("Unexpected message", string(buf[:n]))
+		}
+	}
+
+	stop()
+}
+
+func TestDockerHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	host := os.Getenv("DOCKER_HOST")
+	os.Unsetenv("DOCKER_HOST")
+	defer os.Setenv("DOCKER_HOST", host)
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	if dockerHost() != "unix:///var/run/docker.sock" {
+		t.Fatal("Expected the system socket, got", dockerHost())
+	}
+
+	os.Mkdir(dir+"/podman", 0755)
+	listener, err := net.Listen("unix", dir+"/podman/podman.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if dockerHost() != "unix://"+dir+"/podman/podman.sock" {
+		t.Fatal("Expected the podman socket, got", dockerHost())
+	}
+
+	os.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	if dockerHost() != "tcp://127.0.0.1:2375" {
+		t.Fatal("DOCKER_HOST not honored, got", dockerHost())
+	}
+}
+
+func TestPipeLogsSkipsAdoptedHistory(t *testing.T) {
+	since := make(chan string, 1)
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/json") {
+			w.Write([]byte(`{"Id": "abc", "Config": {}}`))
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/logs") {
+			w.Write([]byte(`{}`))
+			return
+		}
+		since <- r.URL.Query().Get("since")
+	}).Client
+
+	c := &Context{Id: "abc", Logs: true, Client: client, StartedAt: time.Unix(1000, 0)}
+	adoptContainer(c, &dockerContainer.InspectResponse{ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+		ID:    "abc",
+		State: &dockerContainer.State{Running: true, Pid: 1, StartedAt: time.Unix(1000, 0).Format(time.RFC3339Nano)},
+	}})
+
+	pipeLogs(c)
+	if <-since != fmt.Sprintf("%d.%09d", c.LogsSince.Unix(), c.LogsSince.Nanosecond()) {
+		t.Fatal("Adopted container logs replayed")
+	}
+
+	/* A restart of the container streams the whole new run */
+	c.StartedAt = c.LogsSince.Add(time.Minute)
+	pipeLogs(c)
+	if <-since != fmt.Sprintf("%d.%09d", c.StartedAt.Unix(), c.StartedAt.Nanosecond()) {
+		t.Fatal("Restarted container logs skipped")
+	}
+}
+
+func logServer(t *testing.T, tty bool, logs []byte) *dockerClient.Client {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/json") {
+			w.Write([]byte(fmt.Sprintf(`{"Id": "abc", "Config": {"Tty": %v}}`, tty)))
+			return
+		}
+		w.Write(logs)
+	}).Client
+	return client
+}
+
+/* frame encodes a chunk of output in docker's multiplexed stream format */
+func frame(stream byte, data string) []byte {
+	header := []byte{stream, 0, 0, 0, 0, 0, 0, byte(len(data))}
+	return append(header, data...)
+}
+
+func TestStreamLogsDemux(t *testing.T) {
+	logs := append(frame(1, "out 1\n"), frame(2, "err 1\n")...)
+	logs = append(logs, frame(1, "out 2\n")...)
+
+	c := &Context{Id: "abc", Client: logServer(t, false, logs)}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := streamLogs(c, time.Time{}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "out 1\nout 2\n" || stderr.String() != "err 1\n" {
+		t.Fatal("Bad demux", stdout.String(), stderr.String())
+	}
+}
+
+func TestStreamLogsTty(t *testing.T) {
+	c := &Context{Id: "abc", Client: logServer(t, true, []byte("\x01raw tty output\r\n"))}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := streamLogs(c, time.Time{}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "\x01raw tty output\r\n" || stderr.Len() != 0 {
+		t.Fatal("Bad tty output", stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,160 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+/* containerStats takes a single sample from the stats API */
+func containerStats(c *Context) (*dockerContainer.StatsResponse, error) {
+	client, err := getClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	reader, err := client.ContainerStatsOneShot(ctx, c.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Body.Close()
+
+	sample := &dockerContainer.StatsResponse{}
+	err = json.NewDecoder(reader.Body).Decode(sample)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("No stats for container %s: %s", c.Id, err))
+	}
+
+	return sample, nil
+}
+
+func writeMetric(out io.Writer, name, help, kind string, labels string, value interface{}) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n%s{%s} %v\n", name, help, name, kind, name, labels, value)
+}
+
+func formatMetrics(c *Context, stats *dockerContainer.StatsResponse, out io.Writer) {
+	labels := fmt.Sprintf("id=%q,name=%q", c.Id, c.Name)
+
+	up := 0
+	if stats != nil {
+		up = 1
+	}
+	writeMetric(out, "systemd_docker_container_up", "Whether the container is running.", "gauge", labels, up)
+	formatPhaseMetrics(c, out)
+
+	if !c.StartedAt.IsZero() {
+		writeMetric(out, "systemd_docker_container_start_time_seconds", "Start time of the container since unix epoch.", "gauge", labels, c.StartedAt.Unix())
+	}
+
+	if stats == nil {
+		return
+	}
+
+	writeMetric(out, "systemd_docker_container_cpu_usage_seconds_total", "Cumulative CPU time consumed.", "counter", labels,
+		float64(stats.CPUStats.CPUUsage.TotalUsage)/float64(time.Second))
+	writeMetric(out, "systemd_docker_container_memory_usage_bytes", "Current memory usage.", "gauge", labels, stats.MemoryStats.Usage)
+	writeMetric(out, "systemd_docker_container_memory_limit_bytes", "Memory limit.", "gauge", labels, stats.MemoryStats.Limit)
+	writeMetric(out, "systemd_docker_container_pids", "Number of processes.", "gauge", labels, stats.PidsStats.Current)
+
+	var rx, tx uint64
+	for _, network := range stats.Networks {
+		rx += network.RxBytes
+		tx += network.TxBytes
+	}
+	writeMetric(out, "systemd_docker_container_network_receive_bytes_total", "Bytes received on all networks.", "counter", labels, rx)
+	writeMetric(out, "systemd_docker_container_network_transmit_bytes_total", "Bytes sent on all networks.", "counter", labels, tx)
+}
+
+/* The textfile collector may read at any time, so always write to a temp file
+ * in the same directory and rename it into place */
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func writeMetricsFile(c *Context) error {
+	stats, err := containerStats(c)
+	if err != nil {
+		logDebug("Failed to read container stats:", err)
+		stats = nil
+	}
+
+	buf := &bytes.Buffer{}
+	formatMetrics(c, stats, buf)
+
+	return writeFileAtomic(c.MetricsFile, buf.Bytes(), 0644)
+}
+
+/* writeMetrics keeps c.MetricsFile current until the returned func is
+ * called.  That waits for a write in flight, so removeMetrics after it
+ * can't be undone by one more rename. */
+func writeMetrics(c *Context) func() {
+	if len(c.MetricsFile) == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		for {
+			c.identity.RLock()
+			err := writeMetricsFile(c)
+			c.identity.RUnlock()
+			if err != nil {
+				logWarn("Failed to write metrics to", c.MetricsFile, err)
+			}
+
+			/* sleepContext, that also ends when we are stopped */
+			select {
+			case <-done:
+				return
+			case <-rootContext(c).Done():
+				return
+			case <-time.After(c.MetricsInterval):
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func removeMetrics(c *Context) {
+	if len(c.MetricsFile) == 0 {
+		return
+	}
+
+	os.Remove(c.MetricsFile)
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+func TestFormatMetrics(t *testing.T) {
+	c := &Context{
+		Id:        "abc",
+		Name:      "test",
+		StartedAt: time.Unix(1000, 0),
+	}
+
+	stats := &dockerContainer.StatsResponse{}
+	stats.CPUStats.CPUUsage.TotalUsage = uint64(1500 * time.Millisecond)
+	stats.MemoryStats.Usage = 4096
+	stats.Networks = map[string]dockerContainer.NetworkStats{
+		"eth0": {RxBytes: 10, TxBytes: 20},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+
+	out := &bytes.Buffer{}
+	formatMetrics(c, stats, out)
+
+	for _, expected := range []string{
+		`systemd_docker_container_up{id="abc",name="test"} 1`,
+		`systemd_docker_container_start_time_seconds{id="abc",name="test"} 1000`,
+		`systemd_docker_container_cpu_usage_seconds_total{id="abc",name="test"} 1.5`,
+		`systemd_docker_container_memory_usage_bytes{id="abc",name="test"} 4096`,
+		`systemd_docker_container_network_receive_bytes_total{id="abc",name="test"} 11`,
+		`systemd_docker_container_network_transmit_bytes_total{id="abc",name="test"} 22`,
+	} {
+		if !strings.Contains(out.String(), expected+"\n") {
+			t.Fatalf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	formatMetrics(c, nil, out)
+	if !strings.Contains(out.String(), `systemd_docker_container_up{id="abc",name="test"} 0`) {
+		t.Fatal("Container should be down", out.String())
+	}
+}
+
+func TestStopMetricsBeforeRemove(t *testing.T) {
+	m := runtime.NewMock()
+	m.Add(&runtime.Container{ID: "abc", State: runtime.State{Running: true}})
+	c := &Context{
+		Id:              "abc",
+		Client:          mockDaemon(t, m),
+		MetricsFile:     filepath.Join(t.TempDir(), "abc.prom"),
+		MetricsInterval: time.Millisecond,
+	}
+
+	stop := writeMetrics(c)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(c.MetricsFile); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stop()
+	removeMetrics(c)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(c.MetricsFile); !os.IsNotExist(err) {
+		t.Fatal("The metrics file was written again after it was removed", err)
+	}
+}
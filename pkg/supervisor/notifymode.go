@@ -0,0 +1,70 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+)
+
+/* --notify picks who tells systemd the unit is ready:
+ *
+ *   pid      we send MAINPID= and READY=1 once the container has a pid and
+ *            the --ready-* probes passed, the default
+ *   healthy  as pid, but READY=1 also waits for the HEALTHCHECK to pass
+ *   proxy    the container sends READY=1 itself over a NOTIFY_SOCKET of its
+ *            own, what a plain --notify has always done
+ *   off      systemd isn't notified at all, for Type=simple and exec units */
+
+const (
+	NOTIFY_OFF     = "off"
+	NOTIFY_PID     = "pid"
+	NOTIFY_HEALTHY = "healthy"
+	NOTIFY_PROXY   = "proxy"
+)
+
+func parseNotifyMode(mode string) (string, error) {
+	switch mode {
+	case NOTIFY_OFF, NOTIFY_PID, NOTIFY_HEALTHY, NOTIFY_PROXY:
+		return mode, nil
+	case "true":
+		/* --notify=true from when it was a boolean */
+		return NOTIFY_PROXY, nil
+	case "false":
+		return NOTIFY_PID, nil
+	}
+	return "", errors.New(fmt.Sprintf("Invalid --notify %s, expected pid, healthy, proxy or off", mode))
+}
+
+var errNoHealthcheck = errors.New("--notify=healthy needs a HEALTHCHECK in the image or --health-cmd")
+
+/* checkHealthy passes once docker reports the container healthy */
+func checkHealthy(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	if container.State == nil || container.State.Health == nil {
+		return errNoHealthcheck
+	}
+	if container.State.Health.Status != "healthy" {
+		if msg, ok := healthStatusMessage(container); ok {
+			return errors.New(msg)
+		}
+		return errors.New(container.State.Health.Status)
+	}
+	return nil
+}
+
+/* waitHealthy holds back READY=1 for --notify=healthy.  A container without
+ * a HEALTHCHECK would never get there, so that fails right away. */
+func waitHealthy(c *Context) error {
+	if err := checkHealthy(c); err == errNoHealthcheck {
+		return err
+	}
+	return waitProbe(c, "health", pollInterval(c), func() error { return checkHealthy(c) })
+}
@@ -0,0 +1,97 @@
+package supervisor
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseNotifyMode(t *testing.T) {
+	tests := map[string][]string{
+		NOTIFY_PID:     {"run", "busybox"},
+		NOTIFY_PROXY:   {"--notify", "run", "busybox"},
+		NOTIFY_HEALTHY: {"--notify=healthy", "run", "busybox"},
+		NOTIFY_OFF:     {"-n=off", "run", "busybox"},
+	}
+
+	for expected, args := range tests {
+		c, err := Parse(args)
+		if err != nil {
+			t.Fatal(args, err)
+		}
+		if c.NotifyMode != expected {
+			t.Fatal("Expected", expected, "for", args, "got", c.NotifyMode)
+		}
+	}
+
+	/* The boolean it used to be */
+	c, err := Parse([]string{"--notify=false", "run", "busybox"})
+	if err != nil || c.NotifyMode != NOTIFY_PID {
+		t.Fatal("Expected --notify=false to be pid", err)
+	}
+
+	_, err = Parse([]string{"--notify=ready", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected an invalid mode to fail")
+	}
+
+	/* --notify doesn't take the next argument as its value */
+	c, err = Parse([]string{"--strict-args", "--notify", "--logs=false", "run", "busybox"})
+	if err != nil || c.NotifyMode != NOTIFY_PROXY || c.Logs {
+		t.Fatal("Bad bare --notify", err)
+	}
+}
+
+func TestParseNotifyOff(t *testing.T) {
+	os.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	c, err := Parse([]string{"--notify=off", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.NotifySocket) > 0 || c.Notify {
+		t.Fatal("Expected off to leave systemd alone", c.NotifySocket)
+	}
+
+	c, err = Parse([]string{"--notify=healthy", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NotifySocket != "/run/systemd/notify" || c.Notify {
+		t.Fatal("Expected healthy to notify systemd itself")
+	}
+}
+
+func healthServer(t *testing.T, states ...string) *Context {
+	polls := 0
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		state := states[len(states)-1]
+		if polls < len(states) {
+			state = states[polls]
+		}
+		polls++
+
+		health := ""
+		if len(state) > 0 {
+			health = `, "Health": {"Status": "` + state + `"}`
+		}
+		w.Write([]byte(`{"Id": "abc", "State": {"Running": true` + health + `}}`))
+	}).Client
+	return &Context{Client: client, Id: "abc", Pid: os.Getpid(), PollInterval: 10 * time.Millisecond, NotifyMode: NOTIFY_HEALTHY}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	c := healthServer(t, "starting", "unhealthy", "healthy")
+	err := waitReady(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = healthServer(t, "")
+	err = waitReady(c)
+	if err != errNoHealthcheck {
+		t.Fatal("Expected a container without HEALTHCHECK to fail", err)
+	}
+}
@@ -0,0 +1,129 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+)
+
+/* An abstract NOTIFY_SOCKET (@...) can't be bind mounted and belongs to our
+ * network namespace, not the container's.  Instead the container gets a
+ * socket file of ours and we relay what it sends to systemd.  --notify-proxy
+ * does the same for path sockets. */
+
+const NOTIFY_PROXY_TARGET = "/run/systemd/notify"
+
+func notifyProxyPath() string {
+	dir := os.Getenv("RUNTIME_DIRECTORY")
+	if len(dir) == 0 {
+		dir = "/run/systemd-docker"
+	}
+
+	/* RUNTIME_DIRECTORY may list several directories */
+	dir = strings.Split(dir, ":")[0]
+
+	/* A private directory, so it can be handed to the container's user */
+	return path.Join(dir, fmt.Sprintf("notify-%d", os.Getpid()), "notify")
+}
+
+func openNotifyProxy(c *Context) error {
+	if len(c.NotifyProxy) == 0 {
+		return nil
+	}
+
+	err := os.MkdirAll(path.Dir(c.NotifyProxy), 0755)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(c.NotifyProxy)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: c.NotifyProxy, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	/* The container may not run as root */
+	err = os.Chmod(c.NotifyProxy, 0777)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	chownNotifyProxy(c)
+
+	c.NotifyProxyConn = conn
+	go relayNotify(c, conn)
+
+	return nil
+}
+
+func closeNotifyProxy(c *Context) {
+	if c.NotifyProxyConn == nil {
+		return
+	}
+
+	c.NotifyProxyConn.Close()
+	os.Remove(c.NotifyProxy)
+	os.Remove(path.Dir(c.NotifyProxy))
+}
+
+/* What the container may tell systemd.  Its pids belong to another
+ * namespace and could point MAINPID at any process of ours, descriptors are
+ * not relayed. */
+var relayedNotify = []string{
+	"READY=",
+	"RELOADING=",
+	"STOPPING=",
+	"STATUS=",
+	"ERRNO=",
+	"BUSERROR=",
+	"WATCHDOG=",
+	"WATCHDOG_USEC=",
+	"EXTEND_TIMEOUT_USEC=",
+}
+
+func filterNotify(msg string) string {
+	lines := []string{}
+	for _, line := range strings.Split(msg, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		relayed := false
+		for _, prefix := range relayedNotify {
+			if strings.HasPrefix(line, prefix) {
+				relayed = true
+				break
+			}
+		}
+
+		if !relayed {
+			logDebug("Dropping notification from container:", line)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func relayNotify(c *Context, conn *net.UnixConn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		msg := filterNotify(string(buf[:n]))
+		if len(msg) == 0 {
+			continue
+		}
+
+		err = sendNotify(c, msg)
+		if err != nil {
+			logWarn("Failed to relay notification:", err)
+		}
+	}
+}
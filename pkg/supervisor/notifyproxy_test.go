@@ -0,0 +1,94 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterNotify(t *testing.T) {
+	msg := filterNotify("READY=1\nMAINPID=1\nSTATUS=up\nWATCHDOG=1\nEXTEND_TIMEOUT_USEC=5000000\nFDSTORE=1\n")
+	if msg != "READY=1\nSTATUS=up\nWATCHDOG=1\nEXTEND_TIMEOUT_USEC=5000000" {
+		t.Fatal("Bad filtered message", msg)
+	}
+
+	if filterNotify("MAINPID=1") != "" {
+		t.Fatal("MAINPID not dropped")
+	}
+}
+
+func TestParseAbstractNotifySocket(t *testing.T) {
+	os.Setenv("NOTIFY_SOCKET", "@/org/freedesktop/systemd1/notify/123")
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	c, err := Parse([]string{"--notify", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	args := strings.Join(c.Args, " ")
+	if strings.Contains(args, "@") {
+		t.Fatal("Abstract socket mounted", args)
+	}
+
+	if !strings.Contains(args, "-e NOTIFY_SOCKET="+NOTIFY_PROXY_TARGET+" -v "+c.NotifyProxy+":"+NOTIFY_PROXY_TARGET) {
+		t.Fatal("Proxy socket not mounted", args)
+	}
+}
+
+func TestParseNotifyProxy(t *testing.T) {
+	os.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	c, err := Parse([]string{"--notify", "--notify-proxy", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if len(c.NotifyProxy) == 0 || !strings.Contains(strings.Join(c.Args, " "), c.NotifyProxy+":"+NOTIFY_PROXY_TARGET) {
+		t.Fatal("Proxy socket not mounted", c.Args)
+	}
+}
+
+func TestNotifyProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	systemd, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: dir + "/systemd", Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer systemd.Close()
+
+	c := &Context{NotifySocket: dir + "/systemd", NotifyProxy: dir + "/proxy/notify"}
+	err = openNotifyProxy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeNotifyProxy(c)
+
+	container, err := net.Dial("unixgram", c.NotifyProxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Close()
+
+	container.Write([]byte("MAINPID=1\nREADY=1"))
+
+	buf := make([]byte, 256)
+	systemd.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := systemd.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:n]) != "READY=1" {
+		t.Fatal("Unexpected relayed message", string(buf[:n]))
+	}
+}
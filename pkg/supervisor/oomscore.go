@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/* --oom-score-adjust sets the container's OOM score adjustment, and puts our
+ * own score below it, so under memory pressure the kernel kills the
+ * workload before the process supervising it */
+
+const (
+	OOM_SCORE_ADJ_MIN = -1000
+	OOM_SCORE_ADJ_MAX = 1000
+)
+
+func checkOomScoreAdjust(c *Context) error {
+	if !c.OomScoreSet {
+		return nil
+	}
+
+	if c.OomScoreAdjust < OOM_SCORE_ADJ_MIN || c.OomScoreAdjust > OOM_SCORE_ADJ_MAX {
+		return errors.New(fmt.Sprintf("Invalid --oom-score-adjust %d, expected %d to %d", c.OomScoreAdjust, OOM_SCORE_ADJ_MIN, OOM_SCORE_ADJ_MAX))
+	}
+
+	if _, ok := findRunFlag(c.Args, "oom-score-adj"); ok {
+		return errors.New("--oom-score-adjust and --oom-score-adj of run can't be used together")
+	}
+
+	return nil
+}
+
+func oomScoreArgs(c *Context) []string {
+	if !c.OomScoreSet {
+		return nil
+	}
+	return []string{"--oom-score-adj", strconv.Itoa(c.OomScoreAdjust)}
+}
+
+/* ownOomScore is the adjustment we want for ourselves */
+func ownOomScore(c *Context) int {
+	if c.OomScoreAdjust <= OOM_SCORE_ADJ_MIN {
+		return OOM_SCORE_ADJ_MIN
+	}
+	return c.OomScoreAdjust - 1
+}
+
+/* adjustOwnOomScore lowers our score below the container's.  Lowering it
+ * needs CAP_SYS_RESOURCE, without it we stay where systemd put us. */
+func adjustOwnOomScore(c *Context) {
+	if !c.OomScoreSet {
+		return
+	}
+
+	file := path.Join(procRoot, "self", "oom_score_adj")
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		logDebug("Failed to read our OOM score adjustment:", err)
+		return
+	}
+
+	current, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return
+	}
+
+	target := ownOomScore(c)
+	if current <= target {
+		return
+	}
+
+	err = ioutil.WriteFile(file, []byte(strconv.Itoa(target)), 0644)
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to lower our OOM score adjustment to %d, the kernel may kill us before the container: %s", target, err))
+		return
+	}
+	logDebug("Lowered our OOM score adjustment from", current, "to", target)
+}
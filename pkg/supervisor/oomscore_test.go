@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestOomScoreAdjustArgs(t *testing.T) {
+	c, err := Parse([]string{"--oom-score-adjust", "-500", "--default-name=false", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(c.Args, " "), "--oom-score-adj -500 ") {
+		t.Fatal("Missing --oom-score-adj", c.Args)
+	}
+
+	c, err = Parse([]string{"--default-name=false", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findRunFlag(c.Args, "oom-score-adj"); ok {
+		t.Fatal("--oom-score-adj without --oom-score-adjust", c.Args)
+	}
+}
+
+func TestOomScoreAdjustInvalid(t *testing.T) {
+	if _, err := Parse([]string{"--oom-score-adjust", "1001", "run", "busybox"}); err == nil {
+		t.Fatal("Expected out of range error")
+	}
+
+	if _, err := Parse([]string{"--oom-score-adjust", "-1001", "run", "busybox"}); err == nil {
+		t.Fatal("Expected out of range error")
+	}
+
+	if _, err := Parse([]string{"--oom-score-adjust", "100", "run", "--oom-score-adj=200", "busybox"}); err == nil {
+		t.Fatal("Expected conflict with --oom-score-adj")
+	}
+}
+
+func ownOomScoreFile(t *testing.T, score string) string {
+	oldProc := procRoot
+	procRoot = t.TempDir()
+	t.Cleanup(func() { procRoot = oldProc })
+
+	file := path.Join(procRoot, "self", "oom_score_adj")
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(score+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestAdjustOwnOomScore(t *testing.T) {
+	file := ownOomScoreFile(t, "600")
+	adjustOwnOomScore(&Context{OomScoreAdjust: 500, OomScoreSet: true})
+	if data, _ := ioutil.ReadFile(file); string(data) != "499" {
+		t.Fatal("Expected 499, got", string(data))
+	}
+
+	file = ownOomScoreFile(t, "-900")
+	adjustOwnOomScore(&Context{OomScoreAdjust: 500, OomScoreSet: true})
+	if data, _ := ioutil.ReadFile(file); strings.TrimSpace(string(data)) != "-900" {
+		t.Fatal("Raised our score to", string(data))
+	}
+
+	file = ownOomScoreFile(t, "0")
+	adjustOwnOomScore(&Context{OomScoreAdjust: -1000, OomScoreSet: true})
+	if data, _ := ioutil.ReadFile(file); string(data) != "-1000" {
+		t.Fatal("Expected -1000, got", string(data))
+	}
+
+	file = ownOomScoreFile(t, "0")
+	adjustOwnOomScore(&Context{})
+	if data, _ := ioutil.ReadFile(file); strings.TrimSpace(string(data)) != "0" {
+		t.Fatal("Adjusted without --oom-score-adjust", string(data))
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const DEFAULT_DOCKER_HOST = "unix:///var/run/docker.sock"
+
+/* shellCommand runs command in its own process group, so killProcessGroup
+ * gets whatever it started too */
+func shellCommand(command string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+/* pidDied is whether the container's main process is gone from /proc */
+func pidDied(c *Context) bool {
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", c.Pid))
+	return os.IsNotExist(err)
+}
+
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
+
+var defaultForwardSignals = []string{"USR1", "USR2"}
+
+/* Signals --forward-signal can catch, the others stop us or are ours */
+var hostSignals = map[string]os.Signal{
+	"SIGHUP":   syscall.SIGHUP,
+	"SIGQUIT":  syscall.SIGQUIT,
+	"SIGUSR1":  syscall.SIGUSR1,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGALRM":  syscall.SIGALRM,
+	"SIGWINCH": syscall.SIGWINCH,
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProcessAlive(t *testing.T) {
+	if !processAlive(os.Getpid()) {
+		t.Fatal("We are not alive")
+	}
+
+	cmd := shellCommand("exit 0")
+	err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processAlive(cmd.Process.Pid) {
+		t.Fatal("Reaped process alive")
+	}
+}
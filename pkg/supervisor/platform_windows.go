@@ -0,0 +1,55 @@
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* Without systemd there is no NOTIFY_SOCKET, LISTEN_FDS or FDSTORE, so
+ * notifications and socket activation quietly do nothing */
+
+const DEFAULT_DOCKER_HOST = "npipe:////./pipe/docker_engine"
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+/* Without process groups only the shell itself is killed */
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+/* There is no /proc, and with Hyper-V isolation the pid docker reports lives
+ * in a utility VM, so the daemon's state is all we have */
+func pidDied(c *Context) bool {
+	rt, err := getRuntime(c)
+	if err != nil {
+		return false
+	}
+
+	container, err := inspectRuntime(c, rt, c.Id)
+	if runtime.IsNotFound(err) {
+		return true
+	}
+	return err == nil && !container.State.Running
+}
+
+/* There is no socket activation on Windows */
+func closeOnExec(fd int) {}
+
+/* Nothing sends us signals to forward */
+var (
+	defaultForwardSignals = []string{}
+	hostSignals           = map[string]os.Signal{}
+)
@@ -0,0 +1,34 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* There is no /proc to see the container's pid in, Run has to go by the
+ * daemon's state */
+func TestRunMock(t *testing.T) {
+	c, err := Parse([]string{"--logs=false", "run", "--rm", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := runtime.NewMock()
+	c.Runtime = m
+	c.Client = mockDaemon(t, m)
+	go exitWhenRunning(m, "created-1", 0, 500*time.Millisecond)
+
+	_, err = supervise(c, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Phases) == 0 || c.Phases[len(c.Phases)-1].name != "pid" {
+		t.Fatal("Expected the container to be followed by its pid", c.Phases)
+	}
+	if strings.Join(m.Calls, ", ") != "create created-1, start created-1, remove created-1" {
+		t.Fatal("Unexpected calls", m.Calls)
+	}
+}
@@ -0,0 +1,79 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* --pre-stop-exec runs commands inside the container before it is stopped,
+ * like a preStop hook of Kubernetes, so the application can drain connections
+ * or deregister itself while it still runs.  Unlike --pre-stop they don't need
+ * the tools on the host or a way into the container's network. */
+
+func execInContainer(c *Context, client dockerx.API, command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.PreStopTimeout)
+	defer cancel()
+
+	exec, err := client.ContainerExecCreate(ctx, c.Id, dockerContainer.ExecOptions{
+		Cmd:          []string{"/bin/sh", "-c", command},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ContainerExecAttach(ctx, exec.ID, dockerContainer.ExecAttachOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- dockerx.CopyOutput(false, os.Stdout, os.Stderr, resp.Reader)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		/* The command goes on in the container, docker stop ends it */
+		return errors.New(fmt.Sprintf("timed out after %s", c.PreStopTimeout))
+	}
+
+	inspect, err := client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return errors.New(fmt.Sprintf("exit code %d", inspect.ExitCode))
+	}
+	return nil
+}
+
+/* runPreStopExec runs the --pre-stop-exec commands in turn, a failing one
+ * is logged and the container stopped all the same */
+func runPreStopExec(c *Context) {
+	if len(c.PreStopExec) == 0 || len(c.Id) == 0 {
+		return
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		logError("Failed to run --pre-stop-exec:", err)
+		return
+	}
+
+	for _, command := range c.PreStopExec {
+		logInfo("Running in the container before stopping it:", command)
+		err := execInContainer(c, client, command)
+		if err != nil {
+			logError(fmt.Sprintf("--pre-stop-exec %q failed: %s", command, err))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+/* execServer runs every exec with exitCode, hanging for hang first */
+func execServer(t *testing.T, exitCode int, hang time.Duration, commands *[][]string) *Context {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/abc/exec"):
+			var options dockerContainer.ExecOptions
+			json.NewDecoder(r.Body).Decode(&options)
+			*commands = append(*commands, options.Cmd)
+			w.Write([]byte(`{"Id": "exec1"}`))
+		case strings.HasSuffix(r.URL.Path, "/exec/exec1/start"):
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Write([]byte("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n"))
+			time.Sleep(hang)
+			conn.Close()
+		case strings.HasSuffix(r.URL.Path, "/exec/exec1/json"):
+			w.Write([]byte(`{"ID": "exec1", "Running": false, "ExitCode": ` + strconv.Itoa(exitCode) + `}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}).Client
+	return &Context{Client: client, Id: "abc", PreStopTimeout: time.Second}
+}
+
+func TestExecInContainer(t *testing.T) {
+	commands := [][]string{}
+	c := execServer(t, 0, 0, &commands)
+	client, _ := getClient(c)
+
+	err := execInContainer(c, client, "nginx -s quit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 || strings.Join(commands[0], " ") != "/bin/sh -c nginx -s quit" {
+		t.Fatal("Bad exec", commands)
+	}
+
+	c = execServer(t, 3, 0, &commands)
+	client, _ = getClient(c)
+	err = execInContainer(c, client, "false")
+	if err == nil || err.Error() != "exit code 3" {
+		t.Fatal("Expected the exit code to fail", err)
+	}
+
+	c = execServer(t, 0, time.Second, &commands)
+	c.PreStopTimeout = 50 * time.Millisecond
+	client, _ = getClient(c)
+	err = execInContainer(c, client, "sleep 60")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatal("Expected a timeout", err)
+	}
+}
+
+func TestParsePreStopExec(t *testing.T) {
+	c, err := Parse([]string{"--pre-stop-exec", "nginx -s quit", "--pre-stop-exec-timeout=5s", "run", "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.PreStopExec) != 1 || c.PreStopExec[0] != "nginx -s quit" || c.PreStopTimeout != 5*time.Second {
+		t.Fatal("Bad --pre-stop-exec", c.PreStopExec, c.PreStopTimeout)
+	}
+}
@@ -0,0 +1,63 @@
+package supervisor
+
+import (
+	"fmt"
+
+	dockerImage "github.com/docker/docker/api/types/image"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* --prune-image removes the container's image once the container is gone,
+ * for small appliances that get a new image with every release and would
+ * otherwise fill up with old ones.  The image is removed by id without force,
+ * so docker keeps it while another container uses it or another tag points
+ * at it. */
+
+/* pruneCandidate is the id of the image to remove after the container, it
+ * has to be looked up while the container still exists */
+func pruneCandidate(c *Context) string {
+	if !c.PruneImage || len(c.Id) == 0 {
+		return ""
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		logWarn("Failed to look up the image to prune:", err)
+		return ""
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		logWarn("Failed to look up the image to prune:", err)
+		return ""
+	}
+	return container.Image
+}
+
+func pruneImage(c *Context, image string) {
+	if len(image) == 0 {
+		return
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		logWarn("Failed to prune image", shortImageId(image), err)
+		return
+	}
+
+	ctx, cancel := cleanupContext(c, 0)
+	defer cancel()
+
+	_, err = client.ImageRemove(ctx, image, dockerImage.RemoveOptions{PruneChildren: true})
+	if dockerx.IsConflict(err) {
+		logInfo(fmt.Sprintf("Keeping image %s, it is still in use: %s", shortImageId(image), err))
+		return
+	}
+	if err != nil && !dockerx.IsNotFound(err) {
+		logWarn("Failed to prune image", shortImageId(image), err)
+		return
+	}
+	if err == nil {
+		logInfo("Removed image", shortImageId(image))
+	}
+}
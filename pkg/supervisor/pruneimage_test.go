@@ -0,0 +1,47 @@
+package supervisor
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPruneImage(t *testing.T) {
+	inUse := false
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/abc/json"):
+			w.Write([]byte(`{"Id": "abc", "Image": "sha256:0123456789abcdef", "State": {}}`))
+		case r.Method == http.MethodDelete && inUse:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message": "image is being used by running container def"}`))
+		case r.Method == http.MethodDelete:
+			w.Write([]byte(`[{"Deleted": "sha256:0123456789abcdef"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	c := &Context{Id: "abc", Client: daemon.Client}
+	if image := pruneCandidate(c); len(image) > 0 || len(daemon.requests()) > 0 {
+		t.Fatal("Expected nothing without --prune-image", image, daemon.requests())
+	}
+
+	c.PruneImage = true
+	image := pruneCandidate(c)
+	if image != "sha256:0123456789abcdef" {
+		t.Fatal("Expected the container's image, got", image)
+	}
+
+	pruneImage(c, image)
+	inUse = true
+	pruneImage(c, image)
+	if strings.Join(daemon.requests()[1:], ",") != "DELETE /v1.41/images/sha256:0123456789abcdef,DELETE /v1.41/images/sha256:0123456789abcdef" {
+		t.Fatal("Expected the image to be removed", daemon.requests())
+	}
+
+	_, err := Parse([]string{"--prune-image", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected --prune-image to need --rm")
+	}
+}
@@ -0,0 +1,217 @@
+package supervisor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	dockerImage "github.com/docker/docker/api/types/image"
+	dockerRegistry "github.com/docker/docker/api/types/registry"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* --pull-policy decides when the image is pulled through the API before the
+ * container is created.  Without it docker create pulls missing images. */
+
+const (
+	PULL_ALWAYS  = "always"
+	PULL_MISSING = "missing"
+	PULL_NEVER   = "never"
+)
+
+const dockerHubAuth = "https://index.docker.io/v1/"
+
+func validPullPolicy(policy string) bool {
+	switch policy {
+	case "", PULL_ALWAYS, PULL_MISSING, PULL_NEVER:
+		return true
+	}
+	return false
+}
+
+/* registryHost is the registry an image is pulled from, as it is written in
+ * the auths of ~/.docker/config.json */
+func registryHost(ref string) string {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return dockerHubAuth
+}
+
+/* dockerConfigAuth finds the credentials docker login stored for host */
+func dockerConfigAuth(host string) (dockerRegistry.AuthConfig, bool) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if len(dir) == 0 {
+		dir = path.Join(os.Getenv("HOME"), ".docker")
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dir, "config.json"))
+	if err != nil {
+		return dockerRegistry.AuthConfig{}, false
+	}
+
+	config := struct {
+		Auths map[string]dockerRegistry.AuthConfig `json:"auths"`
+	}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		logDebug("Failed to read", path.Join(dir, "config.json"), err)
+		return dockerRegistry.AuthConfig{}, false
+	}
+
+	for _, key := range []string{host, "https://" + host, "http://" + host} {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+
+		/* auth is base64 of user:password, the daemon wants them apart */
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err == nil && len(auth.Username) == 0 {
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) == 2 {
+				auth.Username, auth.Password = parts[0], parts[1]
+			}
+		}
+		auth.Auth = ""
+		auth.ServerAddress = host
+		return auth, true
+	}
+
+	return dockerRegistry.AuthConfig{}, false
+}
+
+/* registryAuth is the X-Registry-Auth header for pulling ref */
+func registryAuth(ref string) string {
+	auth, ok := dockerConfigAuth(registryHost(ref))
+	if !ok {
+		return ""
+	}
+
+	encoded, err := dockerRegistry.EncodeAuthConfig(auth)
+	if err != nil {
+		return ""
+	}
+	return encoded
+}
+
+func localImage(c *Context, client dockerx.API, ref string) (*dockerImage.InspectResponse, error) {
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	image, err := client.ImageInspect(ctx, ref)
+	if dockerx.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func shortImageId(id string) string {
+	return shortId(strings.TrimPrefix(id, "sha256:"))
+}
+
+/* pullImage pulls ref, the pull only ends once the whole progress stream
+ * is read and a failure shows up as an error message in it */
+func pullImage(c *Context, client dockerx.API, ref string) error {
+	logInfo("Pulling", ref)
+	sendNotify(c, "STATUS=Pulling "+ref)
+
+	body, err := client.ImagePull(rootContext(c), ref, dockerImage.PullOptions{
+		RegistryAuth: registryAuth(ref),
+	})
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	progress := newPullProgress(ref)
+	decoder := json.NewDecoder(body)
+	for {
+		var message pullMessage
+
+		err = decoder.Decode(&message)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(message.Error) > 0 {
+			return errors.New(message.Error)
+		}
+
+		progress.update(&message)
+		progress.report(c)
+	}
+}
+
+/* ensureImage applies --pull-policy before the container is created */
+func ensureImage(c *Context) error {
+	if len(c.PullPolicy) == 0 {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	ref := imageRef(c.Args)
+	before, err := localImage(c, client, ref)
+	if err != nil {
+		return err
+	}
+
+	switch c.PullPolicy {
+	case PULL_NEVER:
+		if before == nil {
+			return errors.New(fmt.Sprintf("Image %s is not present and --pull-policy is never", ref))
+		}
+		return nil
+	case PULL_MISSING:
+		if before != nil {
+			return nil
+		}
+	case PULL_ALWAYS:
+		if before != nil && len(imageDigest(ref)) > 0 {
+			/* A pinned image can't change */
+			logDebug("Image", ref, "is pinned and present, not pulling")
+			return nil
+		}
+	}
+
+	err = pullImage(c, client, ref)
+	if err != nil {
+		pullFailed(c, ref, err)
+		return withExitCode(EXIT_PULL_FAILED, errors.New(fmt.Sprintf("Failed to pull %s: %s", ref, err)))
+	}
+
+	after, err := localImage(c, client, ref)
+	if err != nil {
+		return err
+	}
+	if after == nil {
+		return errors.New(fmt.Sprintf("Image %s is missing after pulling it", ref))
+	}
+
+	if before == nil {
+		logInfo(fmt.Sprintf("Pulled %s, %s", ref, shortImageId(after.ID)))
+	} else if before.ID != after.ID {
+		logInfo(fmt.Sprintf("Pulled a newer %s, %s -> %s", ref, shortImageId(before.ID), shortImageId(after.ID)))
+	} else {
+		logInfo("Image", ref, "is up to date")
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"busybox":                      dockerHubAuth,
+		"library/busybox":              dockerHubAuth,
+		"quay.io/coreos/etcd":          "quay.io",
+		"localhost/app":                "localhost",
+		"registry.local:5000/team/app": "registry.local:5000",
+	}
+
+	for repository, expected := range tests {
+		if host := registryHost(repository); host != expected {
+			t.Fatal("Expected", expected, "for", repository, "got", host)
+		}
+	}
+}
+
+func TestParsePullPolicy(t *testing.T) {
+	_, err := Parse([]string{"--pull-policy", "sometimes", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected an invalid policy to fail")
+	}
+
+	c, err := Parse([]string{"--pull-policy", "never", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.PullPolicy != PULL_NEVER {
+		t.Fatal("Bad policy", c.PullPolicy)
+	}
+}
+
+/* pullServer is a daemon without the image until it is pulled */
+func pullServer(t *testing.T) *fakeDaemon {
+	present := false
+	return newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			present = true
+			w.Write([]byte(`{"status": "Downloaded newer image"}`))
+		case strings.HasSuffix(r.URL.Path, "/json") && present:
+			w.Write([]byte(`{"Id": "sha256:0123456789abcdef"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func TestEnsureImage(t *testing.T) {
+	daemon := pullServer(t)
+	c := &Context{Client: daemon.Client, PullPolicy: PULL_NEVER, Args: []string{"busybox"}}
+
+	err := ensureImage(c)
+	if err == nil || len(pulled(daemon)) != 0 {
+		t.Fatal("never should fail without pulling", err, pulled(daemon))
+	}
+
+	c.PullPolicy = PULL_MISSING
+	err = ensureImage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ensureImage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(pulled(daemon), " ") != "docker.io/library/busybox:latest" {
+		t.Fatal("missing should pull once, got", pulled(daemon))
+	}
+
+	c.PullPolicy = PULL_ALWAYS
+	err = ensureImage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pulled(daemon)) != 2 {
+		t.Fatal("always should pull again, got", pulled(daemon))
+	}
+
+	c.Args = []string{"busybox@sha256:abc"}
+	err = ensureImage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pulled(daemon)) != 2 {
+		t.Fatal("a present pinned image should not be pulled, got", pulled(daemon))
+	}
+}
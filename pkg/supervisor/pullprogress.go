@@ -0,0 +1,106 @@
+package supervisor
+
+import (
+	"fmt"
+	"time"
+)
+
+/* The pull's progress stream is summed up into the journal and STATUS= every
+ * pullReportInterval, a start waiting on a large image shows why */
+
+var pullReportInterval = 5 * time.Second
+
+type pullMessage struct {
+	Id             string `json:"id"`
+	Status         string `json:"status"`
+	Error          string `json:"error"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+type pullProgress struct {
+	ref      string
+	layers   map[string]*layerProgress
+	reported time.Time
+}
+
+func newPullProgress(ref string) *pullProgress {
+	return &pullProgress{ref: ref, layers: map[string]*layerProgress{}, reported: time.Now()}
+}
+
+func (p *pullProgress) layer(id string) *layerProgress {
+	layer, ok := p.layers[id]
+	if !ok {
+		layer = &layerProgress{}
+		p.layers[id] = layer
+	}
+	return layer
+}
+
+/* update takes one message of the stream, those without a layer id are
+ * about the image as a whole */
+func (p *pullProgress) update(message *pullMessage) {
+	if len(message.Id) == 0 {
+		return
+	}
+
+	switch message.Status {
+	case "Pulling fs layer", "Waiting":
+		p.layer(message.Id)
+	case "Downloading":
+		layer := p.layer(message.Id)
+		layer.current = message.ProgressDetail.Current
+		if message.ProgressDetail.Total > 0 {
+			layer.total = message.ProgressDetail.Total
+		}
+	case "Download complete", "Already exists", "Pull complete":
+		layer := p.layer(message.Id)
+		layer.done = true
+		layer.current = layer.total
+	}
+}
+
+/* totals are the bytes downloaded and known so far.  Sizes are only known
+ * for layers that started downloading, so the percentage can go down. */
+func (p *pullProgress) totals() (current int64, total int64, done int) {
+	for _, layer := range p.layers {
+		current += layer.current
+		total += layer.total
+		if layer.done {
+			done++
+		}
+	}
+	return current, total, done
+}
+
+/* summary is like 45% of 312M, 3/7 layers done */
+func (p *pullProgress) summary() string {
+	current, total, done := p.totals()
+
+	layers := fmt.Sprintf("%d/%d layers done", done, len(p.layers))
+	if total == 0 {
+		return layers
+	}
+	return fmt.Sprintf("%d%% of %s, %s", current*100/total, formatSize(uint64(total)), layers)
+}
+
+/* report logs the progress and puts it in STATUS= once an interval passed */
+func (p *pullProgress) report(c *Context) {
+	if len(p.layers) == 0 || time.Since(p.reported) < pullReportInterval {
+		return
+	}
+	p.reported = time.Now()
+
+	logInfo(fmt.Sprintf("Pulling %s: %s", p.ref, p.summary()))
+	if current, total, _ := p.totals(); total > 0 {
+		sendNotify(c, fmt.Sprintf("STATUS=Pulling %s: %d%%", p.ref, current*100/total))
+	}
+}
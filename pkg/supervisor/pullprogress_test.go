@@ -0,0 +1,41 @@
+package supervisor
+
+import (
+	"testing"
+)
+
+func TestPullProgress(t *testing.T) {
+	p := newPullProgress("busybox")
+	for _, message := range []pullMessage{
+		{Status: "Pulling from library/busybox", Id: "latest"},
+		{Status: "Pulling fs layer", Id: "a"},
+		{Status: "Pulling fs layer", Id: "b"},
+		{Status: "Already exists", Id: "c"},
+	} {
+		p.update(&message)
+	}
+
+	if summary := p.summary(); summary != "1/3 layers done" {
+		t.Fatal("Bad summary before downloads", summary)
+	}
+
+	downloading := pullMessage{Status: "Downloading", Id: "a"}
+	downloading.ProgressDetail.Current = 256 * 1024 * 1024
+	downloading.ProgressDetail.Total = 300 * 1024 * 1024
+	p.update(&downloading)
+
+	downloading.Id = "b"
+	downloading.ProgressDetail.Current = 0
+	downloading.ProgressDetail.Total = 100 * 1024 * 1024
+	p.update(&downloading)
+
+	if summary := p.summary(); summary != "64% of 400M, 1/3 layers done" {
+		t.Fatal("Bad summary", summary)
+	}
+
+	p.update(&pullMessage{Status: "Download complete", Id: "a"})
+	p.update(&pullMessage{Status: "Pull complete", Id: "b"})
+	if summary := p.summary(); summary != "100% of 400M, 3/3 layers done" {
+		t.Fatal("Bad summary once done", summary)
+	}
+}
@@ -0,0 +1,202 @@
+package supervisor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+/* Probes that have to pass before we send READY=1 */
+
+type HttpProbe struct {
+	Url      string
+	Status   int
+	Timeout  time.Duration
+	Interval time.Duration
+	Insecure bool
+}
+
+func (p *HttpProbe) check() error {
+	client := &http.Client{
+		Timeout: p.Timeout,
+	}
+
+	if p.Insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	resp, err := client.Get(p.Url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != p.Status {
+		return errors.New(fmt.Sprintf("%s returned %d, expected %d", p.Url, resp.StatusCode, p.Status))
+	}
+
+	return nil
+}
+
+/* NetworkProbe waits for the container to get an address on a user defined
+ * or macvlan network, which docker may attach after the container started */
+type NetworkProbe struct {
+	Network  string
+	Ping     bool
+	Interval time.Duration
+}
+
+func (p *NetworkProbe) check(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	container, err := inspectContainer(c, client, c.Id)
+	if err != nil {
+		return err
+	}
+
+	ip := ""
+	if container.NetworkSettings != nil {
+		if network, ok := container.NetworkSettings.Networks[p.Network]; ok && network != nil {
+			ip = network.IPAddress
+			if len(ip) == 0 {
+				ip = network.GlobalIPv6Address
+			}
+		}
+	}
+	if len(ip) == 0 {
+		return errors.New(fmt.Sprintf("no address on network %s yet", p.Network))
+	}
+
+	if p.Ping {
+		/* ping is setuid or has the capability, we would need CAP_NET_RAW */
+		seconds := strconv.Itoa(int(p.Interval.Seconds()) + 1)
+		err := exec.Command("ping", "-c", "1", "-W", seconds, ip).Run()
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s does not answer ping: %s", ip, err))
+		}
+	}
+
+	logDebug("Container has address", ip, "on network", p.Network)
+	return nil
+}
+
+/* GrpcProbe asks a grpc.health.v1 Health service, Target is host:port with
+ * an optional /service, the server's overall health without one */
+type GrpcProbe struct {
+	Target   string
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+func (p *GrpcProbe) address() (string, string) {
+	parts := strings.SplitN(p.Target, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (p *GrpcProbe) validate() error {
+	if len(p.Target) == 0 {
+		return nil
+	}
+
+	address, _ := p.address()
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return errors.New(fmt.Sprintf("Invalid --ready-grpc %s, expected host:port[/service]", p.Target))
+	}
+	return nil
+}
+
+func (p *GrpcProbe) check() error {
+	address, service := p.address()
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return errors.New(fmt.Sprintf("%s is %s", p.Target, resp.Status))
+	}
+
+	return nil
+}
+
+/* waitProbe retries check every interval until it passes or the container
+ * dies, systemd's TimeoutStartSec= bounds the total wait */
+func waitProbe(c *Context, name string, interval time.Duration, check func() error) error {
+	for {
+		err := check()
+		if err == nil {
+			logInfo(name, "probe passed")
+			return nil
+		}
+
+		logDebug(name, "probe failed:", err)
+		sendNotify(c, fmt.Sprintf("STATUS=Waiting for %s probe: %s", name, err))
+
+		if containerDied(c) {
+			return errors.New(fmt.Sprintf("Container exited before the %s probe passed", name))
+		}
+
+		err = sleepContext(c, interval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func waitReady(c *Context) error {
+	if len(c.ReadyNetwork.Network) > 0 {
+		err := waitProbe(c, "network", c.ReadyNetwork.Interval, func() error { return c.ReadyNetwork.check(c) })
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.ReadyHttp.Url) > 0 {
+		err := waitProbe(c, "http", c.ReadyHttp.Interval, c.ReadyHttp.check)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.ReadyGrpc.Target) > 0 {
+		err := waitProbe(c, "grpc", c.ReadyGrpc.Interval, c.ReadyGrpc.check)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.NotifyMode == NOTIFY_HEALTHY {
+		return waitHealthy(c)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHttpProbe(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(503)
+		}
+	}))
+	defer server.Close()
+
+	c, err := Parse([]string{"--ready-http", server.URL, "--ready-http-interval", "1ms", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	c.Pid = os.Getpid()
+	err = waitReady(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Fatal("Expected 3 probes got", calls)
+	}
+}
+
+func TestHttpProbeContainerDied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	c := &Context{
+		Pid: 1 << 30,
+		ReadyHttp: HttpProbe{
+			Url:      server.URL,
+			Status:   200,
+			Timeout:  time.Second,
+			Interval: time.Millisecond,
+		},
+	}
+
+	if waitReady(c) == nil {
+		t.Fatal("probe should fail once the container is gone")
+	}
+}
+
+func TestNetworkProbe(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ip := ""
+		if calls >= 3 {
+			ip = "10.1.0.2"
+		}
+		w.Write([]byte(fmt.Sprintf(`{"Id": "abc", "State": {"Running": true}, "NetworkSettings": {"Networks": {"lan": {"IPAddress": %q}}}}`, ip)))
+	}))
+	defer server.Close()
+
+	client, err := newTestClient(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Context{
+		Id:           "abc",
+		Pid:          os.Getpid(),
+		Client:       client,
+		ReadyNetwork: NetworkProbe{Network: "lan", Interval: time.Millisecond},
+	}
+	err = waitReady(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Fatal("Expected 3 probes got", calls)
+	}
+
+	c.ReadyNetwork.Network = "wan"
+	if c.ReadyNetwork.check(c) == nil {
+		t.Fatal("Address on another network accepted")
+	}
+}
+
+func TestParseReadyNetwork(t *testing.T) {
+	c, err := Parse([]string{"--ready-network", "lan", "--ready-network-ping", "run", "--network", "lan", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.ReadyNetwork.Network != "lan" || !c.ReadyNetwork.Ping || c.ReadyNetwork.Interval != time.Second {
+		t.Fatal("Bad network probe", c.ReadyNetwork)
+	}
+}
+
+func TestGrpcProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	status := health.NewServer()
+	healthpb.RegisterHealthServer(server, status)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	status.SetServingStatus("db", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	p := &GrpcProbe{Target: listener.Addr().String(), Timeout: time.Second}
+	if err := p.check(); err != nil {
+		t.Fatal("Server not serving", err)
+	}
+
+	p.Target += "/db"
+	if err := p.check(); err == nil {
+		t.Fatal("Expected db to be not serving")
+	}
+
+	status.SetServingStatus("db", healthpb.HealthCheckResponse_SERVING)
+	if err := p.check(); err != nil {
+		t.Fatal("db not serving", err)
+	}
+
+	p.Target = listener.Addr().String() + "/unknown"
+	if err := p.check(); err == nil {
+		t.Fatal("Expected error for an unknown service")
+	}
+}
+
+func TestParseReadyGrpc(t *testing.T) {
+	c, err := Parse([]string{"--ready-grpc", "localhost:50051/api.Users", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address, service := c.ReadyGrpc.address(); address != "localhost:50051" || service != "api.Users" {
+		t.Fatal("Bad target", address, service)
+	}
+
+	if _, err := Parse([]string{"--ready-grpc", "localhost", "run", "busybox"}); err == nil {
+		t.Fatal("Expected error for a target without port")
+	}
+}
@@ -0,0 +1,44 @@
+package supervisor
+
+import (
+	"fmt"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+/* Only one of dockerd and systemd may restart a container, or both do and
+ * the unit ends up following a container it didn't start.  Containers are
+ * created with --restart=no, rather than relying on docker's default, and a
+ * container we take over that has a policy gets it switched off.
+ * --allow-docker-restart leaves the policy alone, for live-restore setups. */
+
+func restartArgs(c *Context) []string {
+	if c.KeepRestart {
+		return nil
+	}
+	return []string{"--restart", string(dockerContainer.RestartPolicyDisabled)}
+}
+
+func disableRestartPolicy(c *Context, client dockerx.API, container *dockerContainer.InspectResponse) {
+	if c.KeepRestart || container.HostConfig == nil {
+		return
+	}
+
+	policy := container.HostConfig.RestartPolicy.Name
+	if len(policy) == 0 || policy == dockerContainer.RestartPolicyDisabled {
+		return
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	_, err := client.ContainerUpdate(ctx, container.ID, dockerContainer.UpdateConfig{
+		RestartPolicy: dockerContainer.RestartPolicy{Name: dockerContainer.RestartPolicyDisabled},
+	})
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to turn off restart policy %s of container %s: %s", policy, shortId(container.ID), err))
+		return
+	}
+	logInfo(fmt.Sprintf("Turned off restart policy %s of container %s, restarts are left to systemd", policy, shortId(container.ID)))
+}
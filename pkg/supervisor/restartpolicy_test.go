@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func TestRestartArgs(t *testing.T) {
+	c, err := Parse([]string{"run", "--restart=always", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(c.Args, " "), "always") {
+		t.Fatal("Expected --restart to be dropped", c.Args)
+	}
+	if strings.Join(restartArgs(c), " ") != "--restart no" {
+		t.Fatal("Expected --restart=no to be forced", restartArgs(c))
+	}
+
+	c, err = Parse([]string{"--allow-docker-restart", "run", "--restart=always", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(c.Args, " "), "--restart=always") || len(restartArgs(c)) > 0 {
+		t.Fatal("Expected the policy to be passed on", c.Args)
+	}
+
+	c, err = Parse([]string{"--keep-restart-policy", "run", "busybox"})
+	if err != nil || !c.KeepRestart {
+		t.Fatal("Expected the old flag to keep working", err)
+	}
+}
+
+func TestDisableRestartPolicy(t *testing.T) {
+	daemon := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/containers/abc/update") {
+			w.Write([]byte(`{}`))
+			return
+		}
+		http.NotFound(w, r)
+	})
+	client := daemon.Client
+	updates := func() []string {
+		policies := []string{}
+		for _, call := range daemon.calls() {
+			var config dockerContainer.UpdateConfig
+			json.Unmarshal([]byte(call.Body), &config)
+			policies = append(policies, string(config.RestartPolicy.Name))
+		}
+		return policies
+	}
+
+	container := &dockerContainer.InspectResponse{ContainerJSONBase: &dockerContainer.ContainerJSONBase{
+		ID:         "abc",
+		HostConfig: &dockerContainer.HostConfig{RestartPolicy: dockerContainer.RestartPolicy{Name: "unless-stopped"}},
+	}}
+
+	c := &Context{Client: client}
+	disableRestartPolicy(c, client, container)
+	if strings.Join(updates(), " ") != "no" {
+		t.Fatal("Expected the policy to be turned off", updates())
+	}
+
+	c.KeepRestart = true
+	disableRestartPolicy(c, client, container)
+	container.HostConfig.RestartPolicy.Name = "no"
+	c.KeepRestart = false
+	disableRestartPolicy(c, client, container)
+	if len(updates()) != 1 {
+		t.Fatal("Expected no more updates", updates())
+	}
+}
@@ -0,0 +1,144 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+/* systemd-docker rollout restarts the same unit on a list of hosts, one host
+ * at a time, and only moves on once the unit is healthy again */
+type Rollout struct {
+	Hosts     []string
+	Unit      string
+	Ssh       string
+	HealthCmd string
+	Timeout   time.Duration
+	Settle    time.Duration
+	Interval  time.Duration
+}
+
+func parseRollout(args []string) (*Rollout, error) {
+	r := &Rollout{}
+
+	flags := flag.NewFlagSet("systemd-docker rollout", flag.ContinueOnError)
+	flags.StringSliceVar(&r.Hosts, "hosts", nil, "hosts to roll out to, in order")
+	flags.StringVar(&r.Unit, "unit", "", "unit to restart on each host")
+	flags.StringVar(&r.Ssh, "ssh", "ssh", "command used to reach a host, the host and remote command are appended")
+	flags.StringVar(&r.HealthCmd, "health-cmd", "", "extra remote command that has to succeed before moving on")
+	flags.DurationVar(&r.Timeout, "timeout", 5*time.Minute, "how long to wait for a host to become healthy")
+	flags.DurationVar(&r.Settle, "settle", 10*time.Second, "how long the unit has to stay healthy on a host")
+	flags.DurationVar(&r.Interval, "interval", 2*time.Second, "health check interval")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Hosts = append(r.Hosts, flags.Args()...)
+
+	if len(r.Unit) == 0 {
+		return nil, errors.New("--unit is required")
+	}
+
+	if len(r.Hosts) == 0 {
+		return nil, errors.New("No hosts given")
+	}
+
+	if len(strings.Fields(r.Ssh)) == 0 {
+		return nil, errors.New("--ssh can't be empty")
+	}
+
+	return r, nil
+}
+
+/* shellQuote makes s a single word for the remote shell ssh runs the
+ * command with */
+func shellQuote(s string) string {
+	if len(s) > 0 && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+/* systemctl is the remote systemctl command for the unit */
+func (r *Rollout) systemctl(args ...string) string {
+	return "systemctl " + strings.Join(args, " ") + " -- " + shellQuote(r.Unit)
+}
+
+func (r *Rollout) remote(host string, command string) *exec.Cmd {
+	args := append(strings.Fields(r.Ssh), host, command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func (r *Rollout) healthy(host string) bool {
+	err := r.remote(host, r.systemctl("is-active", "--quiet")).Run()
+	if err != nil {
+		return false
+	}
+
+	if len(r.HealthCmd) > 0 {
+		return r.remote(host, r.HealthCmd).Run() == nil
+	}
+
+	return true
+}
+
+/* waitHealthy returns once host has been healthy for the settle period */
+func (r *Rollout) waitHealthy(host string) error {
+	deadline := time.Now().Add(r.Timeout)
+	var healthySince time.Time
+
+	for time.Now().Before(deadline) {
+		if r.healthy(host) {
+			if healthySince.IsZero() {
+				healthySince = time.Now()
+			}
+			if time.Since(healthySince) >= r.Settle {
+				return nil
+			}
+		} else {
+			healthySince = time.Time{}
+		}
+
+		time.Sleep(r.Interval)
+	}
+
+	return errors.New(fmt.Sprintf("%s on %s not healthy after %s", r.Unit, host, r.Timeout))
+}
+
+func (r *Rollout) run() error {
+	for i, host := range r.Hosts {
+		logInfo(fmt.Sprintf("[%d/%d] Restarting %s on %s", i+1, len(r.Hosts), r.Unit, host))
+
+		err := r.remote(host, r.systemctl("restart")).Run()
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to restart %s on %s, stopping rollout: %s", r.Unit, host, err))
+		}
+
+		err = r.waitHealthy(host)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s, stopping rollout", err))
+		}
+
+		logInfo(fmt.Sprintf("[%d/%d] %s healthy on %s", i+1, len(r.Hosts), r.Unit, host))
+	}
+
+	return nil
+}
+
+func rolloutMain(args []string) error {
+	r, err := parseRollout(args)
+	if err != nil {
+		return err
+	}
+
+	return r.run()
+}
@@ -0,0 +1,113 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeSsh(t *testing.T, script string) (string, string) {
+	dir, err := ioutil.TempDir("", "systemd-docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := filepath.Join(dir, "calls")
+	ssh := filepath.Join(dir, "ssh")
+	err = ioutil.WriteFile(ssh, []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"+script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ssh, calls
+}
+
+func TestRollout(t *testing.T) {
+	ssh, calls := fakeSsh(t, "exit 0\n")
+	defer os.RemoveAll(filepath.Dir(ssh))
+
+	r, err := parseRollout([]string{"--unit", "web.service", "--ssh", ssh, "--settle", "0", "--interval", "1ms", "a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, _ := ioutil.ReadFile(calls)
+	expected := "a systemctl restart -- web.service\na systemctl is-active --quiet -- web.service\n" +
+		"b systemctl restart -- web.service\nb systemctl is-active --quiet -- web.service\n"
+	if string(bytes) != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, bytes)
+	}
+}
+
+func TestRolloutStopsOnUnhealthy(t *testing.T) {
+	ssh, calls := fakeSsh(t, "case \"$2\" in *is-active*) exit 3;; esac\n")
+	defer os.RemoveAll(filepath.Dir(ssh))
+
+	r, err := parseRollout([]string{"--unit", "web.service", "--ssh", ssh, "--hosts", "a,b", "--settle", "0", "--interval", "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Timeout = 10 * time.Millisecond
+
+	err = r.run()
+	if err == nil {
+		t.Fatal("rollout should fail")
+	}
+
+	bytes, _ := ioutil.ReadFile(calls)
+	if strings.Contains(string(bytes), "b systemctl") {
+		t.Fatal("rollout should stop at the first unhealthy host", string(bytes))
+	}
+}
+
+func TestParseRollout(t *testing.T) {
+	_, err := parseRollout([]string{"a"})
+	if err == nil {
+		t.Fatal("unit should be required")
+	}
+
+	_, err = parseRollout([]string{"--unit", "x.service"})
+	if err == nil {
+		t.Fatal("hosts should be required")
+	}
+}
+
+func TestRolloutQuotesUnit(t *testing.T) {
+	/* Run the remote command through a shell like sshd does, with a
+	 * systemctl that records each argument on a line */
+	ssh, calls := fakeSsh(t, "shift; PATH=$(dirname $0):$PATH sh -c \"$*\"\n")
+	defer os.RemoveAll(filepath.Dir(ssh))
+
+	args := filepath.Join(filepath.Dir(ssh), "args")
+	systemctl := filepath.Join(filepath.Dir(ssh), "systemctl")
+	err := ioutil.WriteFile(systemctl, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" >> "+args+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unit := `web\x;touch pwned'.service`
+	r, err := parseRollout([]string{"--unit", unit, "--ssh", ssh, "--settle", "0", "--interval", "1ms", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, _ := ioutil.ReadFile(args)
+	expected := "restart\n--\n" + unit + "\nis-active\n--quiet\n--\n" + unit + "\n"
+	if string(bytes) != expected {
+		bytes, _ := ioutil.ReadFile(calls)
+		t.Fatalf("Expected systemctl to get:\n%s\nthe remote commands were:\n%s", expected, bytes)
+	}
+}
@@ -0,0 +1,33 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+/* On SELinux enforcing hosts a container may not write to a bind mounted
+ * NOTIFY_SOCKET until docker relabels it with :z or :Z.  systemd's own socket
+ * has to keep its label, so a relabeled socket is always the proxy socket. */
+
+var selinuxEnforce = "/sys/fs/selinux/enforce"
+
+func selinuxEnforcing() bool {
+	bytes, err := ioutil.ReadFile(selinuxEnforce)
+	return err == nil && strings.TrimSpace(string(bytes)) == "1"
+}
+
+func validNotifyRelabel(relabel string) bool {
+	switch relabel {
+	case "", "z", "Z":
+		return true
+	}
+	return false
+}
+
+/* notifyMount is the -v value mounting the notify socket source at target */
+func notifyMount(c *Context, source, target string) string {
+	if len(c.NotifyRelabel) > 0 {
+		return source + ":" + target + ":" + c.NotifyRelabel
+	}
+	return source + ":" + target
+}
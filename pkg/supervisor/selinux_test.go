@@ -0,0 +1,57 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSelinuxEnforcing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selinux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := selinuxEnforce
+	defer func() { selinuxEnforce = old }()
+
+	selinuxEnforce = path.Join(dir, "missing")
+	if selinuxEnforcing() {
+		t.Fatal("Enforcing without selinuxfs")
+	}
+
+	selinuxEnforce = path.Join(dir, "enforce")
+	ioutil.WriteFile(selinuxEnforce, []byte("0"), 0644)
+	if selinuxEnforcing() {
+		t.Fatal("Enforcing in permissive mode")
+	}
+
+	ioutil.WriteFile(selinuxEnforce, []byte("1"), 0644)
+	if !selinuxEnforcing() {
+		t.Fatal("Not enforcing")
+	}
+}
+
+func TestParseNotifyRelabel(t *testing.T) {
+	os.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	c, err := Parse([]string{"--notify", "--notify-relabel=Z", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	/* systemd's socket keeps its label, the proxy socket is relabeled */
+	args := strings.Join(c.Args, " ")
+	if len(c.NotifyProxy) == 0 || !strings.Contains(args, "-v "+c.NotifyProxy+":"+NOTIFY_PROXY_TARGET+":Z") {
+		t.Fatal("Proxy socket not relabeled", args)
+	}
+
+	_, err = Parse([]string{"--notify", "--notify-relabel=shared", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Invalid --notify-relabel accepted")
+	}
+}
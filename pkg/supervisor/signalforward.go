@@ -0,0 +1,86 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+/* --forward-signal passes signals we get on to the container's main process
+ * through the kill API, the container isn't in our cgroup so systemctl kill
+ * doesn't reach it.  SIG or SIG:TARGET, USR1 and USR2 by default.  TERM and
+ * INT stop the container instead, HUP also restarts the log stream. */
+
+type signalForward struct {
+	From os.Signal
+	To   string
+}
+
+func parseForwardSignals(values []string) ([]signalForward, error) {
+	forwards := []signalForward{}
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		from, _ := signalName(parts[0])
+		sig, ok := hostSignals[from]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Invalid --forward-signal %s, can't forward %s", value, parts[0]))
+		}
+
+		to := from
+		if len(parts) == 2 {
+			to, ok = signalName(parts[1])
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("Invalid --forward-signal %s, unknown signal %s", value, parts[1]))
+			}
+		}
+
+		forwards = append(forwards, signalForward{From: sig, To: to})
+	}
+	return forwards, nil
+}
+
+func forwardSignal(c *Context, from os.Signal, to string) {
+	c.identity.RLock()
+	defer c.identity.RUnlock()
+
+	logInfo(fmt.Sprintf("Forwarding %s to container %s as %s", from, shortId(c.Id), to))
+	client, err := getClient(c)
+	if err == nil {
+		ctx, cancel := apiContext(c)
+		err = client.ContainerKill(ctx, c.Id, to)
+		cancel()
+	}
+
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to send %s to container %s: %s", to, shortId(c.Id), err))
+	}
+}
+
+func handleForwardSignals(c *Context) func() {
+	if len(c.ForwardSignals) == 0 {
+		return func() {}
+	}
+
+	targets := map[os.Signal]string{}
+	for _, forward := range c.ForwardSignals {
+		targets[forward.From] = forward.To
+	}
+
+	signals := make(chan os.Signal, 1)
+	for sig := range targets {
+		signal.Notify(signals, sig)
+	}
+
+	go func() {
+		for sig := range signals {
+			forwardSignal(c, sig, targets[sig])
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
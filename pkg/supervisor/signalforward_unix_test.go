@@ -0,0 +1,54 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseForwardSignals(t *testing.T) {
+	forwards, err := parseForwardSignals([]string{"USR1", "SIGHUP:SIGUSR2", "winch:28"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []signalForward{{syscall.SIGUSR1, "SIGUSR1"}, {syscall.SIGHUP, "SIGUSR2"}, {syscall.SIGWINCH, "28"}}
+	for i, forward := range forwards {
+		if forward != expected[i] {
+			t.Fatal("Expected", expected[i], "got", forward)
+		}
+	}
+
+	for _, value := range []string{"TERM", "KILL", "USR1:BOGUS", "FOO"} {
+		if _, err := parseForwardSignals([]string{value}); err == nil {
+			t.Fatal("Expected error for", value)
+		}
+	}
+}
+
+func TestForwardSignals(t *testing.T) {
+	killed := make(chan string, 1)
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1.41/containers/abc/kill" {
+			killed <- r.URL.Query().Get("signal")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Client
+
+	c := &Context{Id: "abc", Client: client, ForwardSignals: []signalForward{{syscall.SIGUSR2, "SIGHUP"}}}
+	stop := handleForwardSignals(c)
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	select {
+	case sig := <-killed:
+		if sig != "SIGHUP" {
+			t.Fatal("Expected SIGHUP, got", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Signal not forwarded")
+	}
+}
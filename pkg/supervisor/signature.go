@@ -0,0 +1,123 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+/* --verify-key, --verify-identity and --verify-notation check the signature
+ * of the image a container was created from before it is started.  cosign and
+ * notation are run rather than linked in.  The image is verified by the digest
+ * the container was created from, so a tag moving meanwhile can't slip a
+ * different image past the check. */
+
+var verifyCommand = func(c *Context, name string, args ...string) error {
+	out, err := exec.CommandContext(rootContext(c), name, args...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+func verifySigning(c *Context) bool {
+	return len(c.VerifyKeys) > 0 || len(c.VerifyIdentity) > 0 || c.VerifyNotation
+}
+
+func checkVerify(c *Context) error {
+	if (len(c.VerifyIdentity) > 0) != (len(c.VerifyIssuer) > 0) {
+		return errors.New("--verify-identity and --verify-issuer have to be given together")
+	}
+	if verifySigning(c) && c.Foreground {
+		return errors.New("--foreground starts the container before its signature could be verified")
+	}
+	return nil
+}
+
+/* repository strips the tag and digest off ref, and the docker.io/library/
+ * docker adds to images from Docker Hub */
+func repository(ref string) string {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	ref = strings.TrimPrefix(ref, "docker.io/")
+	return strings.TrimPrefix(ref, "library/")
+}
+
+/* signedRef is the name@digest of the image as the registry knows it, which
+ * is what signatures are attached to */
+func signedRef(repoDigests []string, ref string) (string, error) {
+	for _, repoDigest := range repoDigests {
+		if repository(repoDigest) == repository(ref) {
+			return repoDigest, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("Policy violation: image %s has no registry digest, its signature can't be verified", ref))
+}
+
+/* verifySignature passes if any of the configured keys, the keyless identity
+ * or notation's trust policy verifies the image */
+func verifySignature(c *Context, container *dockerContainer.InspectResponse) error {
+	if !verifySigning(c) {
+		return nil
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := apiContext(c)
+	image, err := client.ImageInspect(ctx, container.Image)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	ref, err := signedRef(image.RepoDigests, imageRef(c.Args))
+	if err != nil {
+		return err
+	}
+
+	logInfo("Verifying the signature of", ref)
+	sendNotify(c, "STATUS=Verifying the signature of "+ref)
+
+	failures := []string{}
+	for _, key := range c.VerifyKeys {
+		err = verifyCommand(c, "cosign", "verify", "--key", key, ref)
+		if err == nil {
+			logInfo("Image", ref, "is signed by", key)
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("key %s: %s", key, err))
+	}
+
+	if len(c.VerifyIdentity) > 0 {
+		err = verifyCommand(c, "cosign", "verify", "--certificate-identity", c.VerifyIdentity, "--certificate-oidc-issuer", c.VerifyIssuer, ref)
+		if err == nil {
+			logInfo("Image", ref, "is signed by", c.VerifyIdentity)
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("identity %s: %s", c.VerifyIdentity, err))
+	}
+
+	if c.VerifyNotation {
+		err = verifyCommand(c, "notation", "verify", ref)
+		if err == nil {
+			logInfo("Image", ref, "passed the notation trust policy")
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("notation: %s", err))
+	}
+
+	if cancelled(c) {
+		return rootContext(c).Err()
+	}
+	return errors.New(fmt.Sprintf("Policy violation: image %s is not signed as required, %s", ref, strings.Join(failures, "; ")))
+}
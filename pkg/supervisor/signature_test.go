@@ -0,0 +1,96 @@
+package supervisor
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func TestParseVerify(t *testing.T) {
+	_, err := Parse([]string{"--verify-identity", "ci@example.com", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected --verify-identity without --verify-issuer to fail")
+	}
+
+	_, err = Parse([]string{"--verify-notation", "--foreground", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected --verify-notation with --foreground to fail")
+	}
+
+	c, err := Parse([]string{"--verify-key", "a.pub", "--verify-key", "b.pub", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.VerifyKeys, " ") != "a.pub b.pub" {
+		t.Fatal("Bad keys", c.VerifyKeys)
+	}
+}
+
+func TestSignedRef(t *testing.T) {
+	tests := map[string]string{
+		"busybox":                          "busybox@sha256:1",
+		"docker.io/library/busybox:1.36":   "busybox@sha256:1",
+		"registry.local:5000/app:2":        "registry.local:5000/app@sha256:2",
+		"registry.local:5000/app@sha256:2": "registry.local:5000/app@sha256:2",
+	}
+	repoDigests := []string{"busybox@sha256:1", "registry.local:5000/app@sha256:2"}
+
+	for ref, expected := range tests {
+		signed, err := signedRef(repoDigests, ref)
+		if err != nil || signed != expected {
+			t.Fatal("Expected", expected, "for", ref, "got", signed, err)
+		}
+	}
+
+	_, err := signedRef(repoDigests, "app:dev")
+	if err == nil || !strings.Contains(err.Error(), "Policy violation") {
+		t.Fatal("Expected an image without a registry digest to fail", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/images/sha256:abc/json") {
+			w.Write([]byte(`{"Id": "sha256:abc", "RepoDigests": ["quay.io/app@sha256:def"]}`))
+			return
+		}
+		http.NotFound(w, r)
+	}).Client
+
+	calls := []string{}
+	defer func(command func(*Context, string, ...string) error) { verifyCommand = command }(verifyCommand)
+	verifyCommand = func(c *Context, name string, args ...string) error {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if args[len(args)-2] == "new.pub" {
+			return nil
+		}
+		return errors.New("no matching signatures")
+	}
+
+	container := &dockerContainer.InspectResponse{ContainerJSONBase: &dockerContainer.ContainerJSONBase{Image: "sha256:abc"}}
+	c := &Context{Client: client, Args: []string{"quay.io/app:1"}, VerifyKeys: []string{"old.pub", "new.pub"}}
+
+	err := verifySignature(c, container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ", ") != "cosign verify --key old.pub quay.io/app@sha256:def, cosign verify --key new.pub quay.io/app@sha256:def" {
+		t.Fatal("Bad calls", calls)
+	}
+
+	calls = nil
+	c.VerifyKeys = nil
+	c.VerifyIdentity = "ci@example.com"
+	c.VerifyIssuer = "https://issuer"
+	c.VerifyNotation = true
+	err = verifySignature(c, container)
+	if err == nil || !strings.Contains(err.Error(), "Policy violation") || !strings.Contains(err.Error(), "no matching signatures") {
+		t.Fatal("Expected a policy violation", err)
+	}
+	if len(calls) != 2 || !strings.HasPrefix(calls[1], "notation verify") {
+		t.Fatal("Bad calls", calls)
+	}
+}
@@ -0,0 +1,136 @@
+package supervisor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+/* --stats-status puts the container's CPU and memory usage in STATUS=, so
+ * systemctl status shows what it is using.  Health check output and usage
+ * share the status line. */
+
+type statusLine struct {
+	lock   sync.Mutex
+	health string
+	stats  string
+	sent   string
+}
+
+func (s *statusLine) message() string {
+	parts := []string{}
+	for _, part := range []string{s.health, s.stats} {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+/* publish sends the status line if a part of it changed */
+func (s *statusLine) publish(c *Context, update func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	update()
+	msg := s.message()
+	if len(msg) == 0 || msg == s.sent {
+		return
+	}
+	s.sent = msg
+	sendNotify(c, "STATUS="+msg)
+}
+
+func (s *statusLine) setHealth(c *Context, health string) {
+	s.publish(c, func() { s.health = health })
+}
+
+func (s *statusLine) setStats(c *Context, stats string) {
+	s.publish(c, func() { s.stats = stats })
+}
+
+/* formatSize shortens bytes the way docker run --memory takes them */
+func formatSize(bytes uint64) string {
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < 4 {
+		value /= 1024
+		unit++
+	}
+
+	suffix := []string{"B", "K", "M", "G", "T"}[unit]
+	if value >= 10 || value == float64(int64(value)) {
+		return fmt.Sprintf("%.0f%s", value, suffix)
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
+
+/* memoryUsed leaves out the page cache the kernel can take back, as docker
+ * stats does */
+func memoryUsed(stats *dockerContainer.StatsResponse) uint64 {
+	usage := stats.MemoryStats.Usage
+	inactive, ok := stats.MemoryStats.Stats["total_inactive_file"]
+	if !ok {
+		inactive = stats.MemoryStats.Stats["inactive_file"]
+	}
+	if inactive < usage {
+		usage -= inactive
+	}
+	return usage
+}
+
+/* cpuPercent is the CPU used between two samples, 100% being one CPU */
+func cpuPercent(prev, cur *dockerContainer.StatsResponse) (float64, bool) {
+	if prev == nil || cur.CPUStats.CPUUsage.TotalUsage < prev.CPUStats.CPUUsage.TotalUsage || cur.CPUStats.SystemUsage <= prev.CPUStats.SystemUsage {
+		return 0, false
+	}
+
+	cpus := float64(cur.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(cur.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	used := float64(cur.CPUStats.CPUUsage.TotalUsage - prev.CPUStats.CPUUsage.TotalUsage)
+	system := float64(cur.CPUStats.SystemUsage - prev.CPUStats.SystemUsage)
+	return used / system * cpus * 100, true
+}
+
+func statsStatusMessage(prev, cur *dockerContainer.StatsResponse) string {
+	cpu := "cpu -"
+	if percent, ok := cpuPercent(prev, cur); ok {
+		cpu = fmt.Sprintf("cpu %.0f%%", percent)
+	}
+
+	mem := "mem " + formatSize(memoryUsed(cur))
+	if cur.MemoryStats.Limit > 0 {
+		mem += "/" + formatSize(cur.MemoryStats.Limit)
+	}
+	return cpu + ", " + mem
+}
+
+/* runStatsStatus samples the stats API every --stats-status-interval, with
+ * --notify the container owns its status */
+func runStatsStatus(c *Context) {
+	if !c.StatsStatus || c.Notify || len(c.NotifySocket) == 0 {
+		return
+	}
+
+	var prev *dockerContainer.StatsResponse
+	for {
+		c.identity.RLock()
+		stats, err := containerStats(c)
+		c.identity.RUnlock()
+		if err == nil {
+			c.status.setStats(c, statsStatusMessage(prev, stats))
+			prev = stats
+		} else {
+			logDebug("Failed to read container stats:", err)
+		}
+
+		if sleepContext(c, c.StatsInterval) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+)
+
+func TestFormatSize(t *testing.T) {
+	for bytes, expected := range map[uint64]string{
+		512:                    "512B",
+		430 * 1024 * 1024:      "430M",
+		1024 * 1024 * 1024:     "1G",
+		1536 * 1024 * 1024:     "1.5G",
+		5 * 1024 * 1024 * 1024: "5G",
+	} {
+		if size := formatSize(bytes); size != expected {
+			t.Fatal("Expected", expected, "got", size)
+		}
+	}
+}
+
+func statsSample(total, system uint64) *dockerContainer.StatsResponse {
+	stats := &dockerContainer.StatsResponse{}
+	stats.CPUStats.CPUUsage.TotalUsage = total
+	stats.CPUStats.SystemUsage = system
+	stats.CPUStats.OnlineCPUs = 4
+	stats.MemoryStats.Usage = 450 * 1024 * 1024
+	stats.MemoryStats.Limit = 1024 * 1024 * 1024
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 20 * 1024 * 1024}
+	return stats
+}
+
+func TestStatsStatusMessage(t *testing.T) {
+	first := statsSample(1000, 100000)
+	if msg := statsStatusMessage(nil, first); msg != "cpu -, mem 430M/1G" {
+		t.Fatal("Bad first status", msg)
+	}
+
+	if msg := statsStatusMessage(first, statsSample(4000, 200000)); msg != "cpu 12%, mem 430M/1G" {
+		t.Fatal("Bad status", msg)
+	}
+
+	if _, ok := cpuPercent(first, statsSample(500, 200000)); ok {
+		t.Fatal("CPU usage from a restarted container")
+	}
+}
+
+func TestStatusLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := dir + "/notify"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := &Context{NotifySocket: socket}
+	read := func() string {
+		buf := make([]byte, 256)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := conn.Read(buf)
+		return string(buf[:n])
+	}
+
+	c.status.setStats(c, "cpu 1%, mem 10M")
+	if msg := read(); msg != "STATUS=cpu 1%, mem 10M" {
+		t.Fatal("Bad status", msg)
+	}
+
+	c.status.setHealth(c, "healthy: ok")
+	if msg := read(); msg != "STATUS=healthy: ok; cpu 1%, mem 10M" {
+		t.Fatal("Bad combined status", msg)
+	}
+
+	c.status.setHealth(c, "healthy: ok")
+	c.status.setStats(c, "cpu 2%, mem 10M")
+	if msg := read(); msg != "STATUS=healthy: ok; cpu 2%, mem 10M" {
+		t.Fatal("Unchanged status sent again", msg)
+	}
+}
@@ -0,0 +1,158 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/oott123/systemd-docker/pkg/runtime"
+)
+
+/* How much of systemd's TimeoutStopSec= is left for removing the container
+ * and the post-stop hooks once the container had its grace period */
+const STOP_TIMEOUT_MARGIN = 5 * time.Second
+
+/* parseStopTimeout takes seconds, like docker run --stop-timeout, or a
+ * duration */
+func parseStopTimeout(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, errors.New(fmt.Sprintf("Invalid --stop-timeout %s, expected seconds or a duration like 30s", value))
+	}
+	return timeout, nil
+}
+
+/* stopTimeout is how long the container gets between SIGTERM and SIGKILL.
+ * Without --stop-timeout it follows TIMEOUT_STOP_USEC, if the unit sets it,
+ * and is otherwise left to docker: the container's own --stop-timeout or 10
+ * seconds.  A negative timeout means docker decides, which is also the case
+ * when run has a --stop-timeout of its own. */
+func stopTimeout(c *Context) time.Duration {
+	if c.StopTimeout >= 0 {
+		return c.StopTimeout
+	}
+
+	if _, ok := argValue(c.Args, "--stop-timeout"); ok {
+		return -1
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("TIMEOUT_STOP_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return -1
+	}
+
+	timeout := time.Duration(usec)*time.Microsecond - STOP_TIMEOUT_MARGIN
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+/* How long a container gets to be gone after SIGKILL */
+const KILL_TIMEOUT = 10 * time.Second
+
+/* stopGrace is how long the container gets before it is killed, when
+ * stopTimeout leaves it to docker that is run's --stop-timeout or docker's
+ * default of 10 seconds */
+func stopGrace(c *Context, timeout time.Duration) time.Duration {
+	if timeout >= 0 {
+		return timeout
+	}
+	if value, ok := argValue(c.Args, "--stop-timeout"); ok {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 10 * time.Second
+}
+
+/* stoppedState is the state of the container after a stop, nil once it is
+ * gone altogether.  We may be stopping because we were cancelled, so this
+ * doesn't use the root context. */
+func stoppedState(c *Context, rt runtime.ContainerRuntime) (*runtime.State, error) {
+	ctx, cancel := cleanupContext(c, 0)
+	defer cancel()
+
+	container, err := rt.Inspect(ctx, c.Id)
+	if runtime.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &container.State, nil
+}
+
+/* stopEscalating stops the container the way docker stop does: the stop
+ * signal, the grace period, then SIGKILL.  docker stop may give up on a busy
+ * daemon or return with the container still running, so we check that it
+ * really exited and kill it ourselves if not.  Only then is it removed. */
+func stopEscalating(c *Context, rt runtime.ContainerRuntime, timeout time.Duration, grace time.Duration) error {
+	signal := c.StopSignal
+	if len(signal) == 0 {
+		signal = "its stop signal"
+	}
+	logInfo(fmt.Sprintf("Stopping container %s with %s, killing it after %s", shortId(c.Id), signal, grace))
+
+	began := time.Now()
+	ctx, cancel := cleanupContext(c, grace+10*time.Second)
+	err := rt.Stop(ctx, c.Id, timeout)
+	cancel()
+	if runtime.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to stop container %s: %s", shortId(c.Id), err))
+	}
+
+	state, err := stoppedState(c, rt)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to check that container %s stopped: %s", shortId(c.Id), err))
+	}
+	took := roundDuration(time.Since(began))
+	if state == nil {
+		logInfo(fmt.Sprintf("Container %s is gone after %s", shortId(c.Id), took))
+		return nil
+	}
+	if !state.Running {
+		if state.ExitCode == 137 && time.Since(began) >= grace {
+			logWarn(fmt.Sprintf("Container %s didn't stop within %s and was killed", shortId(c.Id), grace))
+		} else {
+			logInfo(fmt.Sprintf("Container %s exited with code %d after %s", shortId(c.Id), state.ExitCode, took))
+		}
+		return nil
+	}
+
+	logWarn(fmt.Sprintf("Container %s still runs after %s, sending SIGKILL", shortId(c.Id), took))
+	ctx, cancel = cleanupContext(c, KILL_TIMEOUT)
+	defer cancel()
+
+	err = rt.Kill(ctx, c.Id, "KILL")
+	if err != nil && !runtime.IsNotFound(err) {
+		return err
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, KILL_TIMEOUT)
+	_, err = rt.Wait(waitCtx, c.Id)
+	waitCancel()
+	if err != nil && !runtime.IsNotFound(err) {
+		return errors.New(fmt.Sprintf("Container %s didn't exit after SIGKILL: %s", shortId(c.Id), err))
+	}
+
+	state, err = stoppedState(c, rt)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to check that container %s stopped: %s", shortId(c.Id), err))
+	}
+	if state != nil && state.Running {
+		return errors.New(fmt.Sprintf("Container %s still runs after SIGKILL", shortId(c.Id)))
+	}
+	logInfo(fmt.Sprintf("Container %s was killed", shortId(c.Id)))
+	return nil
+}
@@ -0,0 +1,113 @@
+package supervisor
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStopTimeout(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"30":    30 * time.Second,
+		"0":     0,
+		"1m30s": 90 * time.Second,
+	} {
+		timeout, err := parseStopTimeout(value)
+		if err != nil || timeout != expected {
+			t.Fatal("Expected", expected, "for", value, "got", timeout, err)
+		}
+	}
+
+	for _, value := range []string{"-1", "soon", "-5s"} {
+		if _, err := parseStopTimeout(value); err == nil {
+			t.Fatal("Expected", value, "to be invalid")
+		}
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	os.Unsetenv("TIMEOUT_STOP_USEC")
+
+	c, err := Parse([]string{"run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopTimeout(c) >= 0 {
+		t.Fatal("Expected docker's default, got", stopTimeout(c))
+	}
+
+	os.Setenv("TIMEOUT_STOP_USEC", "90000000")
+	defer os.Unsetenv("TIMEOUT_STOP_USEC")
+	if stopTimeout(c) != 85*time.Second {
+		t.Fatal("Expected TIMEOUT_STOP_USEC less the margin, got", stopTimeout(c))
+	}
+
+	c, err = Parse([]string{"run", "--stop-timeout", "20", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopTimeout(c) >= 0 {
+		t.Fatal("The container's own --stop-timeout should win, got", stopTimeout(c))
+	}
+
+	c, err = Parse([]string{"--stop-timeout", "3s", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopTimeout(c) != 3*time.Second {
+		t.Fatal("Expected --stop-timeout, got", stopTimeout(c))
+	}
+}
+
+func TestStopGrace(t *testing.T) {
+	c, err := Parse([]string{"run", "--stop-timeout", "20", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grace := stopGrace(c, stopTimeout(c)); grace != 20*time.Second {
+		t.Fatal("Expected run's --stop-timeout, got", grace)
+	}
+	if grace := stopGrace(c, 3*time.Second); grace != 3*time.Second {
+		t.Fatal("Expected our timeout, got", grace)
+	}
+
+	c, err = Parse([]string{"run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grace := stopGrace(c, -1); grace != 10*time.Second {
+		t.Fatal("Expected docker's default, got", grace)
+	}
+}
+
+func TestStopEscalating(t *testing.T) {
+	c, m := mockContext("")
+	c.StopTimeout = time.Second
+	m.StopExitCode = 143
+
+	err := stopContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(m.Calls, ", ") != "stop abc" {
+		t.Fatal("Expected a plain stop, got", m.Calls)
+	}
+
+	/* A container still running after the stop is killed */
+	c, m = mockContext("")
+	c.StopTimeout = time.Second
+	m.IgnoreStop = true
+
+	err = stopContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(m.Calls, ", ") != "stop abc, kill abc" {
+		t.Fatal("Expected the stop to be escalated, got", m.Calls)
+	}
+	container, _ := inspectRuntime(c, m, "abc")
+	if container.State.Running || container.State.ExitCode != 137 {
+		t.Fatal("Expected the container to be killed", container.State)
+	}
+}
@@ -0,0 +1,62 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* --stop-signal picks the signal docker stop sends first, overriding the
+ * image's STOPSIGNAL, like SIGQUIT for a graceful nginx shutdown.  SIGKILL
+ * still follows once the stop timeout runs out. */
+
+/* The container's signals are Linux ones, whatever we run on */
+var linuxSignals = map[string]int{
+	"HUP": 1, "INT": 2, "QUIT": 3, "ILL": 4, "TRAP": 5, "ABRT": 6, "BUS": 7, "FPE": 8,
+	"KILL": 9, "USR1": 10, "SEGV": 11, "USR2": 12, "PIPE": 13, "ALRM": 14, "TERM": 15,
+	"STKFLT": 16, "CHLD": 17, "CONT": 18, "STOP": 19, "TSTP": 20, "TTIN": 21, "TTOU": 22,
+	"URG": 23, "XCPU": 24, "XFSZ": 25, "VTALRM": 26, "PROF": 27, "WINCH": 28, "IO": 29,
+	"PWR": 30, "SYS": 31,
+}
+
+/* signalName takes QUIT, SIGQUIT or 3 and returns the name docker expects */
+func signalName(value string) (string, bool) {
+	if number, err := strconv.Atoi(value); err == nil {
+		return value, number >= 1 && number <= 64
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(value), "SIG")
+	_, ok := linuxSignals[name]
+	return "SIG" + name, ok
+}
+
+func parseStopSignal(value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+
+	name, ok := signalName(value)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Invalid --stop-signal %s, expected a signal like SIGQUIT or 3", value))
+	}
+	return name, nil
+}
+
+func checkStopSignal(c *Context) error {
+	if len(c.StopSignal) == 0 {
+		return nil
+	}
+
+	if _, ok := findRunFlag(c.Args, "stop-signal"); ok {
+		return errors.New("--stop-signal given before and after run, keep one of them")
+	}
+	return nil
+}
+
+func stopSignalArgs(c *Context) []string {
+	if len(c.StopSignal) == 0 {
+		return nil
+	}
+	return []string{"--stop-signal", c.StopSignal}
+}
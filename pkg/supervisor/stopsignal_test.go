@@ -0,0 +1,39 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStopSignal(t *testing.T) {
+	for value, expected := range map[string]string{"QUIT": "SIGQUIT", "sigquit": "SIGQUIT", "SIGWINCH": "SIGWINCH", "3": "3", "": ""} {
+		sig, err := parseStopSignal(value)
+		if err != nil || sig != expected {
+			t.Fatal("Expected", expected, "for", value, "got", sig, err)
+		}
+	}
+
+	for _, value := range []string{"SIGFOO", "0", "65"} {
+		if _, err := parseStopSignal(value); err == nil {
+			t.Fatal("Expected error for", value)
+		}
+	}
+}
+
+func TestStopSignalArgs(t *testing.T) {
+	c, err := Parse([]string{"--stop-signal", "quit", "run", "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(c.Args, " "), "--stop-signal SIGQUIT") {
+		t.Fatal("Missing --stop-signal", c.Args)
+	}
+
+	if _, err := Parse([]string{"--stop-signal", "QUIT", "run", "--stop-signal=INT", "nginx"}); err == nil {
+		t.Fatal("Expected error for --stop-signal before and after run")
+	}
+
+	if _, err := Parse([]string{"--stop-signal", "BOGUS", "run", "nginx"}); err == nil {
+		t.Fatal("Expected error for an unknown signal")
+	}
+}
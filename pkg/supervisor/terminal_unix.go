@@ -0,0 +1,37 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+func isTerminal(fd uintptr) bool {
+	return term.IsTerminal(int(fd))
+}
+
+/* makeRaw is cfmakeraw(3), the container's TTY does the line editing */
+func makeRaw(fd uintptr) error {
+	old, err := term.MakeRaw(int(fd))
+	if err != nil {
+		return err
+	}
+
+	restoreTerminal = func() {
+		term.Restore(int(fd), old)
+	}
+	return nil
+}
+
+func terminalSize(fd uintptr) (uint, uint, error) {
+	cols, rows, err := term.GetSize(int(fd))
+	return uint(rows), uint(cols), err
+}
+
+func notifyResize(signals chan os.Signal) {
+	signal.Notify(signals, syscall.SIGWINCH)
+}
@@ -0,0 +1,25 @@
+package supervisor
+
+import (
+	"errors"
+	"os"
+)
+
+/* --attach forwards stdin as is on Windows, without a raw terminal or
+ * following its size */
+
+var errNoTerminal = errors.New("terminals are not supported on Windows")
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) error {
+	return errNoTerminal
+}
+
+func terminalSize(fd uintptr) (uint, uint, error) {
+	return 0, 0, errNoTerminal
+}
+
+func notifyResize(signals chan os.Signal) {}
@@ -0,0 +1,50 @@
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+/* How long each phase of the start took, to tell a slow pull from a slow
+ * daemon or an application that takes its time to get ready.  Logged once
+ * the unit is up and written to --metrics-textfile. */
+
+type startupPhase struct {
+	name string
+	took time.Duration
+}
+
+/* timePhase records a phase that began at start and just ended */
+func timePhase(c *Context, name string, start time.Time) {
+	c.Phases = append(c.Phases, startupPhase{name: name, took: time.Since(start)})
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+/* startupReport is a line like "Started in 2.1s: pull 1.8s, create 120ms" */
+func startupReport(c *Context, total time.Duration) string {
+	phases := []string{}
+	for _, phase := range c.Phases {
+		phases = append(phases, fmt.Sprintf("%s %s", phase.name, roundDuration(phase.took)))
+	}
+	return fmt.Sprintf("Started in %s: %s", roundDuration(total), strings.Join(phases, ", "))
+}
+
+func formatPhaseMetrics(c *Context, out io.Writer) {
+	if len(c.Phases) == 0 {
+		return
+	}
+
+	name := "systemd_docker_startup_phase_seconds"
+	fmt.Fprintf(out, "# HELP %s How long each phase of the start took.\n# TYPE %s gauge\n", name, name)
+	for _, phase := range c.Phases {
+		fmt.Fprintf(out, "%s{id=%q,name=%q,phase=%q} %v\n", name, c.Id, c.Name, phase.name, phase.took.Seconds())
+	}
+}
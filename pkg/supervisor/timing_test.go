@@ -0,0 +1,39 @@
+package supervisor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupReport(t *testing.T) {
+	c := &Context{Id: "abc", Name: "test"}
+	c.Phases = []startupPhase{
+		{name: "parse", took: 1500 * time.Microsecond},
+		{name: "pull", took: 1800 * time.Millisecond},
+		{name: "pid", took: 300 * time.Nanosecond},
+	}
+
+	report := startupReport(c, 2100*time.Millisecond)
+	if report != "Started in 2.1s: parse 2ms, pull 1.8s, pid 0s" {
+		t.Fatal("Bad report", report)
+	}
+
+	out := &bytes.Buffer{}
+	formatMetrics(c, nil, out)
+	if strings.Count(out.String(), "# TYPE systemd_docker_startup_phase_seconds gauge\n") != 1 {
+		t.Fatal("Expected a single TYPE line for the phases", out.String())
+	}
+	if !strings.Contains(out.String(), `systemd_docker_startup_phase_seconds{id="abc",name="test",phase="pull"} 1.8`+"\n") {
+		t.Fatal("Expected the pull phase in", out.String())
+	}
+}
+
+func TestTimePhase(t *testing.T) {
+	c := &Context{}
+	timePhase(c, "create", time.Now().Add(-time.Second))
+	if len(c.Phases) != 1 || c.Phases[0].name != "create" || c.Phases[0].took < time.Second {
+		t.Fatal("Bad phases", c.Phases)
+	}
+}
@@ -0,0 +1,72 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+/* Docker only marks a container unhealthy, it never restarts it.  With
+ * --unhealthy-timeout a container unhealthy for that long is stopped and we
+ * exit with EXIT_UNHEALTHY, so Restart= of the unit recovers it.  Unlike the
+ * watchdog this needs no WatchdogSec= and tolerates short unhealthy spells. */
+
+var ErrUnhealthy = errors.New("Container stayed unhealthy too long")
+
+/* unhealthyFor is how long the container has been unhealthy, 0 if it isn't */
+func unhealthyFor(c *Context) time.Duration {
+	since := atomic.LoadInt64(&c.unhealthySince)
+	if since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, since))
+}
+
+func markUnhealthy(c *Context, unhealthy bool) {
+	if !unhealthy {
+		atomic.StoreInt64(&c.unhealthySince, 0)
+		return
+	}
+	atomic.CompareAndSwapInt64(&c.unhealthySince, 0, time.Now().UnixNano())
+}
+
+func unhealthyStopped(c *Context) bool {
+	return atomic.LoadInt32(&c.unhealthyStop) != 0
+}
+
+/* runUnhealthyTimeout stops the container once it was unhealthy for longer
+ * than --unhealthy-timeout */
+func runUnhealthyTimeout(c *Context) {
+	if c.UnhealthyTimeout <= 0 {
+		return
+	}
+
+	interval := c.UnhealthyTimeout / 10
+	if interval > time.Second {
+		interval = time.Second
+	}
+
+	for {
+		if sleepContext(c, interval) != nil {
+			return
+		}
+
+		took := unhealthyFor(c)
+		if took < c.UnhealthyTimeout {
+			continue
+		}
+
+		c.identity.RLock()
+		logError(fmt.Sprintf("Container %s was unhealthy for %s, stopping it", shortId(c.Id), took.Round(time.Second)))
+		sendNotify(c, "STATUS=Stopping, unhealthy for "+took.Round(time.Second).String())
+		atomic.StoreInt32(&c.unhealthyStop, 1)
+
+		err := stopContainer(c)
+		c.identity.RUnlock()
+		if err != nil {
+			logError("Failed to stop unhealthy container:", err)
+		}
+		return
+	}
+}
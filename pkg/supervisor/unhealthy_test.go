@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnhealthyFor(t *testing.T) {
+	c := &Context{}
+	setHealth(c, "unhealthy")
+	first := c.unhealthySince
+
+	/* Still unhealthy keeps counting from the first report */
+	setHealth(c, "unhealthy")
+	if c.unhealthySince != first || unhealthyFor(c) <= 0 {
+		t.Fatal("Expected the unhealthy spell to go on")
+	}
+
+	setHealth(c, "healthy")
+	if unhealthyFor(c) != 0 {
+		t.Fatal("Expected healthy to end the spell")
+	}
+}
+
+func TestUnhealthyTimeout(t *testing.T) {
+	c, m := mockContext("")
+	c.UnhealthyTimeout = 50 * time.Millisecond
+	setHealth(c, "unhealthy")
+
+	done := make(chan struct{})
+	go func() {
+		runUnhealthyTimeout(c)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the unhealthy container to be stopped")
+	}
+	if strings.Join(m.Calls, ",") != "stop abc" {
+		t.Fatal("Expected the container to be stopped, got", m.Calls)
+	}
+	if !unhealthyStopped(c) {
+		t.Fatal("Expected the stop to be recorded")
+	}
+	if code := exitCode(ErrUnhealthy); code != EXIT_UNHEALTHY {
+		t.Fatal("Expected", EXIT_UNHEALTHY, "got", code)
+	}
+}
@@ -0,0 +1,244 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	dockerContainer "github.com/docker/docker/api/types/container"
+	dockerFilters "github.com/docker/docker/api/types/filters"
+	"github.com/oott123/systemd-docker/pkg/dockerx"
+)
+
+const (
+	LABEL_UNIT       = "io.systemd.unit"
+	LABEL_INVOCATION = "io.systemd.invocation"
+)
+
+/* unitFromCgroup finds the service we run in from /proc/self/cgroup */
+func unitFromCgroup(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		/* Only the innermost cgroup is ours, a shell in a scope below
+		 * user@.service doesn't belong to that service */
+		unit := path.Base(parts[2])
+		if strings.HasSuffix(unit, ".service") {
+			return unit
+		}
+	}
+	return ""
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+/* containerName turns a unit name into a valid container name, instances of
+ * templates (web@1.service) have an @ docker doesn't allow */
+func containerName(unit string) string {
+	return invalidNameChars.ReplaceAllString(unit, "_")
+}
+
+/* unitName is --unit if given, otherwise the service we are running in */
+func unitName(c *Context) string {
+	if len(c.Unit) > 0 {
+		return c.Unit
+	}
+
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+
+	return unitFromCgroup(string(data))
+}
+
+func unitLabels(c *Context) []string {
+	args := []string{}
+
+	unit := unitName(c)
+	if len(unit) > 0 {
+		args = append(args, "--label", LABEL_UNIT+"="+unit)
+	}
+
+	invocation := os.Getenv("INVOCATION_ID")
+	if len(invocation) > 0 {
+		args = append(args, "--label", LABEL_INVOCATION+"="+invocation)
+	}
+
+	return args
+}
+
+/* invocationContainer finds a container created by this run of the unit
+ * through its invocation label, when docker create was cut short before it
+ * wrote the cidfile */
+func invocationContainer(c *Context) string {
+	invocation := os.Getenv("INVOCATION_ID")
+	if len(invocation) == 0 {
+		return ""
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return ""
+	}
+
+	ctx, cancel := cleanupContext(c, 0)
+	defer cancel()
+
+	containers, err := client.ContainerList(ctx, dockerContainer.ListOptions{
+		All:     true,
+		Filters: dockerFilters.NewArgs(dockerFilters.Arg("label", LABEL_INVOCATION+"="+invocation)),
+	})
+	if err != nil || len(containers) == 0 {
+		return ""
+	}
+	return containers[0].ID
+}
+
+/* adoptUnitContainer finds a container a crashed run of this unit left
+ * running, through the cid file or the unit label */
+func adoptUnitContainer(c *Context) error {
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+
+	id := ""
+	if len(c.CidFile) > 0 {
+		bytes, err := ioutil.ReadFile(c.CidFile)
+		if err == nil {
+			id = strings.TrimSpace(string(bytes))
+		}
+	}
+
+	unit := unitName(c)
+	if len(id) == 0 && len(unit) > 0 {
+		ctx, cancel := apiContext(c)
+		defer cancel()
+
+		containers, err := client.ContainerList(ctx, dockerContainer.ListOptions{
+			Filters: dockerFilters.NewArgs(
+				dockerFilters.Arg("label", LABEL_UNIT+"="+unit),
+				dockerFilters.Arg("status", "running"),
+			),
+		})
+		if err != nil {
+			return err
+		}
+
+		var created int64
+		for _, container := range containers {
+			if container.Created > created {
+				id = container.ID
+				created = container.Created
+			}
+		}
+
+		if len(containers) > 1 {
+			logWarn(fmt.Sprintf("Found %d running containers of %s, adopting the newest", len(containers), unit))
+		}
+	}
+
+	if len(id) == 0 {
+		return nil
+	}
+
+	container, err := inspectContainer(c, client, id)
+	if dockerx.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !container.State.Running {
+		return nil
+	}
+
+	err = verifyDigest(c, container)
+	if err != nil {
+		return err
+	}
+
+	err = verifySignature(c, container)
+	if err != nil {
+		return err
+	}
+
+	adoptContainer(c, container)
+
+	return nil
+}
+
+/* Directories systemd sets up for the unit with RuntimeDirectory= and
+ * friends, by the name used in --unit-dir-target */
+var unitDirs = []struct {
+	kind string
+	env  string
+}{
+	{"runtime", "RUNTIME_DIRECTORY"},
+	{"state", "STATE_DIRECTORY"},
+	{"cache", "CACHE_DIRECTORY"},
+	{"logs", "LOGS_DIRECTORY"},
+}
+
+func parseUnitDirTargets(values []string) (map[string]string, error) {
+	targets := map[string]string{}
+	for _, value := range values {
+		kv := strings.SplitN(value, "=", 2)
+
+		known := false
+		for _, dir := range unitDirs {
+			known = known || dir.kind == kv[0]
+		}
+
+		if len(kv) != 2 || !known || !strings.HasPrefix(kv[1], "/") {
+			return nil, errors.New(fmt.Sprintf("Invalid --unit-dir-target %s, expected runtime, state, cache or logs=/path", value))
+		}
+		targets[kv[0]] = kv[1]
+	}
+	return targets, nil
+}
+
+/* unitDirArgs bind mounts the unit's directories into the container, at the
+ * same path unless --unit-dir-target says otherwise, and tells the app where
+ * they are in the same variables systemd uses */
+func unitDirArgs(c *Context) []string {
+	args := []string{}
+	if !c.MountUnitDirs {
+		return args
+	}
+
+	for _, dir := range unitDirs {
+		value := os.Getenv(dir.env)
+		if len(value) == 0 {
+			continue
+		}
+
+		sources := strings.Split(value, ":")
+		targets := []string{}
+		for _, source := range sources {
+			target := source
+			if base, ok := c.UnitDirTargets[dir.kind]; ok {
+				target = base
+				if len(sources) > 1 {
+					target = path.Join(base, path.Base(source))
+				}
+			}
+
+			args = append(args, "-v", source+":"+target)
+			targets = append(targets, target)
+		}
+
+		args = append(args, "-e", dir.env+"="+strings.Join(targets, ":"))
+	}
+
+	return args
+}
@@ -0,0 +1,87 @@
+package supervisor
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUnitFromCgroup(t *testing.T) {
+	cases := map[string]string{
+		"0::/system.slice/nginx.service\n":                                                  "nginx.service",
+		"12:pids:/system.slice/web@1.service\n1:name=systemd:/system.slice/web@1.service\n": "web@1.service",
+		"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app.service\n":          "app.service",
+		"0::/user.slice/user-1000.slice/session-2.scope\n":                                  "",
+	}
+
+	for data, expected := range cases {
+		if unitFromCgroup(data) != expected {
+			t.Fatal("Expected", expected, "got", unitFromCgroup(data), "for", data)
+		}
+	}
+}
+
+func TestParseUnitLabels(t *testing.T) {
+	os.Setenv("INVOCATION_ID", "0123")
+	defer os.Unsetenv("INVOCATION_ID")
+
+	c, err := Parse([]string{"--unit", "web.service", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	args := strings.Join(c.Args, " ")
+	if !strings.Contains(args, "--label io.systemd.unit=web.service --label io.systemd.invocation=0123") {
+		t.Fatal("Missing labels", args)
+	}
+}
+
+func TestParseDefaultName(t *testing.T) {
+	c, err := Parse([]string{"--unit", "web@1.service", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	if c.Name != "web_1.service" || !strings.Contains(strings.Join(c.Args, " "), "--name web_1.service busybox") {
+		t.Fatal("Bad default name", c.Name, c.Args)
+	}
+
+	c, err = Parse([]string{"--unit", "web.service", "run", "--name", "other", "busybox"})
+	if err != nil || c.Name != "other" {
+		t.Fatal("Explicit name not kept", c, err)
+	}
+
+	c, err = Parse([]string{"--unit", "web.service", "--default-name=false", "run", "busybox"})
+	if err != nil || len(c.Name) > 0 {
+		t.Fatal("Name set anyway", c, err)
+	}
+}
+
+func TestUnitDirArgs(t *testing.T) {
+	os.Setenv("STATE_DIRECTORY", "/var/lib/web")
+	os.Setenv("CACHE_DIRECTORY", "/var/cache/web:/var/cache/web-thumbs")
+	defer os.Unsetenv("STATE_DIRECTORY")
+	defer os.Unsetenv("CACHE_DIRECTORY")
+
+	c, err := Parse([]string{"run", "busybox"})
+	if err != nil || strings.Contains(strings.Join(c.Args, " "), "STATE_DIRECTORY") {
+		t.Fatal("Directories mounted without --mount-unit-dirs", c, err)
+	}
+
+	c, err = Parse([]string{"--mount-unit-dirs", "--unit-dir-target", "cache=/cache", "run", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	args := strings.Join(c.Args, " ")
+	expected := "-v /var/lib/web:/var/lib/web -e STATE_DIRECTORY=/var/lib/web " +
+		"-v /var/cache/web:/cache/web -v /var/cache/web-thumbs:/cache/web-thumbs -e CACHE_DIRECTORY=/cache/web:/cache/web-thumbs"
+	if !strings.Contains(args, expected) {
+		t.Fatal("Bad unit dir args", args)
+	}
+
+	_, err = Parse([]string{"--unit-dir-target", "home=/home", "run", "busybox"})
+	if err == nil {
+		t.Fatal("Expected an unknown directory to be rejected")
+	}
+}
@@ -0,0 +1,161 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* --unit-limits gives the container the MemoryMax=, CPUQuota= and TasksMax=
+ * of its unit, so they are only declared once.  Docker puts the container in
+ * a cgroup of its own where the unit's limits don't reach. */
+
+type unitLimit struct {
+	Env      string
+	Property string
+	Flags    []string
+	Arg      string
+	parse    func(string) (string, error)
+}
+
+var unitLimits = []unitLimit{
+	{"MEMORY_MAX", "MemoryMax", []string{"memory"}, "--memory", parseMemoryMax},
+	{"CPU_QUOTA", "CPUQuotaPerSecUSec", []string{"cpus", "cpu-quota", "cpu-period"}, "--cpus", parseCPUQuota},
+	{"TASKS_MAX", "TasksMax", []string{"pids-limit"}, "--pids-limit", parseTasksMax},
+}
+
+/* showUnit returns the properties of a unit as systemctl show prints them */
+var showUnit = func(unit string, properties []string) (string, error) {
+	args := []string{"show"}
+	if os.Geteuid() != 0 {
+		args = append(args, "--user")
+	}
+	for _, p := range properties {
+		args = append(args, "--property", p)
+	}
+	out, err := exec.Command("systemctl", append(args, "--", unit)...).Output()
+	return string(out), err
+}
+
+func parseUnitProperties(out string) map[string]string {
+	props := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			props[parts[0]] = parts[1]
+		}
+	}
+	return props
+}
+
+/* parseMemoryMax takes bytes with an optional K, M, G or T suffix as
+ * MemoryMax= does.  Percentages of the host's memory aren't supported. */
+func parseMemoryMax(value string) (string, error) {
+	multiplier := uint64(1)
+	number := value
+	if len(value) > 0 {
+		if i := strings.IndexByte("KMGT", value[len(value)-1]); i >= 0 {
+			multiplier = 1 << (10 * uint(i+1))
+			number = value[:len(value)-1]
+		}
+	}
+
+	bytes, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || bytes == 0 {
+		return "", errors.New(fmt.Sprintf("Invalid memory limit %s", value))
+	}
+	return strconv.FormatUint(bytes*multiplier, 10), nil
+}
+
+/* parseCPUQuota takes a percentage as CPUQuota= does, or the time per second
+ * systemctl show prints, 1.5s or 1min 4s */
+func parseCPUQuota(value string) (string, error) {
+	var cpus float64
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Invalid CPU quota %s", value))
+		}
+		cpus = percent / 100
+	} else {
+		duration, err := time.ParseDuration(strings.Replace(strings.Replace(value, " ", "", -1), "min", "m", -1))
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Invalid CPU quota %s", value))
+		}
+		cpus = duration.Seconds()
+	}
+
+	if cpus <= 0 {
+		return "", errors.New(fmt.Sprintf("Invalid CPU quota %s", value))
+	}
+	return strconv.FormatFloat(cpus, 'f', -1, 64), nil
+}
+
+func parseTasksMax(value string) (string, error) {
+	tasks, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || tasks == 0 {
+		return "", errors.New(fmt.Sprintf("Invalid tasks limit %s", value))
+	}
+	return value, nil
+}
+
+/* unitLimitArgs returns the run flags for the unit's limits.  The environment
+ * wins over the unit, flags given to run win over both. */
+func unitLimitArgs(c *Context) ([]string, error) {
+	if !c.UnitLimits {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	missing := []string{}
+	for _, limit := range unitLimits {
+		if value := os.Getenv(limit.Env); len(value) > 0 {
+			values[limit.Property] = value
+		} else {
+			missing = append(missing, limit.Property)
+		}
+	}
+
+	if unit := unitName(c); len(missing) > 0 && len(unit) > 0 {
+		out, err := showUnit(unit, missing)
+		if err != nil {
+			logWarn(fmt.Sprintf("Failed to read the limits of %s: %s", unit, err))
+		}
+		props := parseUnitProperties(out)
+		for _, property := range missing {
+			values[property] = props[property]
+		}
+	}
+
+	args := []string{}
+	for _, limit := range unitLimits {
+		value := values[limit.Property]
+		if len(value) == 0 || value == "infinity" || limitGiven(c.Args, limit.Flags) {
+			continue
+		}
+
+		arg, err := limit.parse(value)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, limit.Arg, arg)
+	}
+
+	if len(args) > 0 {
+		logDebug("Limits of the unit:", strings.Join(args, " "))
+	}
+	return args, nil
+}
+
+func limitGiven(args []string, names []string) bool {
+	for _, name := range names {
+		if _, ok := findRunFlag(args, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUnitLimits(t *testing.T) {
+	if v, err := parseMemoryMax("512M"); err != nil || v != "536870912" {
+		t.Fatal("Bad memory limit", v, err)
+	}
+	if v, err := parseMemoryMax("1073741824"); err != nil || v != "1073741824" {
+		t.Fatal("Bad memory limit", v, err)
+	}
+	if _, err := parseMemoryMax("50%"); err == nil {
+		t.Fatal("Expected error for a percentage")
+	}
+
+	if v, err := parseCPUQuota("150%"); err != nil || v != "1.5" {
+		t.Fatal("Bad CPU quota", v, err)
+	}
+	if v, err := parseCPUQuota("500ms"); err != nil || v != "0.5" {
+		t.Fatal("Bad CPU quota", v, err)
+	}
+	if v, err := parseCPUQuota("1min 4s"); err != nil || v != "64" {
+		t.Fatal("Bad CPU quota", v, err)
+	}
+
+	if _, err := parseTasksMax("many"); err == nil {
+		t.Fatal("Expected error for a bad tasks limit")
+	}
+}
+
+func fakeShowUnit(t *testing.T, out string) *[]string {
+	asked := []string{}
+	oldShow := showUnit
+	showUnit = func(unit string, properties []string) (string, error) {
+		asked = append(asked, unit)
+		asked = append(asked, properties...)
+		return out, nil
+	}
+	t.Cleanup(func() { showUnit = oldShow })
+	return &asked
+}
+
+func TestUnitLimitArgs(t *testing.T) {
+	asked := fakeShowUnit(t, "MemoryMax=1073741824\nCPUQuotaPerSecUSec=2s\nTasksMax=infinity\n")
+	t.Setenv("MEMORY_MAX", "")
+	t.Setenv("CPU_QUOTA", "")
+	t.Setenv("TASKS_MAX", "64")
+
+	c, err := Parse([]string{"--unit-limits", "--unit", "web.service", "--default-name=false", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := strings.Join(c.Args, " ")
+	for _, expected := range []string{"--memory 1073741824", "--cpus 2", "--pids-limit 64"} {
+		if !strings.Contains(args, expected) {
+			t.Fatal("Missing", expected, "in", args)
+		}
+	}
+
+	if strings.Join(*asked, " ") != "web.service MemoryMax CPUQuotaPerSecUSec" {
+		t.Fatal("Bad query", *asked)
+	}
+}
+
+func TestUnitLimitArgsRunFlagsWin(t *testing.T) {
+	fakeShowUnit(t, "MemoryMax=1073741824\nCPUQuotaPerSecUSec=2s\nTasksMax=100\n")
+	for _, env := range []string{"MEMORY_MAX", "CPU_QUOTA", "TASKS_MAX"} {
+		t.Setenv(env, "")
+	}
+
+	c, err := Parse([]string{"--unit-limits", "--unit", "web.service", "--default-name=false", "run", "-m", "256m", "--cpu-quota=50000", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := strings.Join(c.Args, " ")
+	if strings.Contains(args, "--memory") || strings.Contains(args, "--cpus") {
+		t.Fatal("Unit limit replaced a run flag", args)
+	}
+	if !strings.Contains(args, "--pids-limit 100") {
+		t.Fatal("Missing --pids-limit", args)
+	}
+}
+
+func TestUnitLimitArgsInvalid(t *testing.T) {
+	fakeShowUnit(t, "")
+	t.Setenv("MEMORY_MAX", "lots")
+
+	if _, err := Parse([]string{"--unit-limits", "--unit", "web.service", "run", "busybox"}); err == nil {
+		t.Fatal("Expected error for a bad MEMORY_MAX")
+	}
+}
+
+func TestUnitLimitArgsOff(t *testing.T) {
+	asked := fakeShowUnit(t, "MemoryMax=1073741824\n")
+
+	c, err := Parse([]string{"--unit", "web.service", "--default-name=false", "run", "busybox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*asked) > 0 || strings.Contains(strings.Join(c.Args, " "), "--memory") {
+		t.Fatal("Limits applied without --unit-limits", c.Args)
+	}
+}
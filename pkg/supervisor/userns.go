@@ -0,0 +1,101 @@
+package supervisor
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/* With --user or a userns-remap daemon the container isn't root on the host.
+ * The proxy socket is world writable, but it and its private directory also
+ * belong to the container's user, so a stricter mode or ACL on the runtime
+ * directory doesn't lock the container out. */
+
+/* remapOffset is the host uid and gid of root in the container.  A remapping
+ * daemon keeps its data in a directory named after them, like
+ * /var/lib/docker/100000.100000 */
+func remapOffset(c *Context) (int, int, bool) {
+	if f, ok := findRunFlag(c.Args, "userns"); ok && f.Value == "host" {
+		return 0, 0, false
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	ctx, cancel := apiContext(c)
+	defer cancel()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		logDebug("Failed to ask the daemon about user namespaces:", err)
+		return 0, 0, false
+	}
+
+	remapped := false
+	for _, option := range info.SecurityOptions {
+		remapped = remapped || strings.Contains(option, "name=userns")
+	}
+	if !remapped {
+		return 0, 0, false
+	}
+
+	ids := strings.SplitN(path.Base(info.DockerRootDir), ".", 2)
+	if len(ids) != 2 {
+		return 0, 0, false
+	}
+	uid, err := strconv.Atoi(ids[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	gid, err := strconv.Atoi(ids[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
+
+/* containerOwner is the host uid and gid the container runs as.  A --user
+ * given by name can only be resolved inside the image, only its remapped
+ * root is known then. */
+func containerOwner(c *Context) (int, int, bool) {
+	uid, gid := 0, 0
+	if f, ok := findRunFlag(c.Args, "user"); ok {
+		parts := strings.SplitN(f.Value, ":", 2)
+		if id, err := strconv.Atoi(parts[0]); err == nil {
+			uid = id
+		}
+		if len(parts) == 2 {
+			if id, err := strconv.Atoi(parts[1]); err == nil {
+				gid = id
+			}
+		}
+	}
+
+	if uidOffset, gidOffset, ok := remapOffset(c); ok {
+		uid += uidOffset
+		gid += gidOffset
+	}
+
+	return uid, gid, uid != 0 || gid != 0
+}
+
+/* chownNotifyProxy hands the proxy socket and its directory to the
+ * container's user, only root may do that */
+func chownNotifyProxy(c *Context) {
+	uid, gid, ok := containerOwner(c)
+	if !ok {
+		return
+	}
+
+	for _, file := range []string{path.Dir(c.NotifyProxy), c.NotifyProxy} {
+		err := os.Lchown(file, uid, gid)
+		if err != nil {
+			logDebug("Failed to hand", file, "to the container's user:", err)
+			return
+		}
+	}
+	logDebug("Notify socket belongs to", uid, gid)
+}
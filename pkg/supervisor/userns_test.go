@@ -0,0 +1,31 @@
+package supervisor
+
+import (
+	"net/http"
+	"testing"
+)
+
+func remapContext(t *testing.T, args ...string) *Context {
+	client := newFakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"SecurityOptions": ["name=seccomp,profile=default", "name=userns"], "DockerRootDir": "/var/lib/docker/100000.100000"}`))
+	}).Client
+
+	return &Context{Client: client, Args: args}
+}
+
+func TestContainerOwner(t *testing.T) {
+	uid, gid, ok := containerOwner(remapContext(t, "--user", "1000:50", "busybox"))
+	if !ok || uid != 101000 || gid != 100050 {
+		t.Fatal("Bad owner", uid, gid)
+	}
+
+	uid, gid, ok = containerOwner(remapContext(t, "--user", "nobody", "busybox"))
+	if !ok || uid != 100000 || gid != 100000 {
+		t.Fatal("Bad owner of a named user", uid, gid)
+	}
+
+	uid, gid, ok = containerOwner(remapContext(t, "--userns=host", "busybox"))
+	if ok {
+		t.Fatal("Remapped with --userns=host", uid, gid)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestChownNotifyProxy(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Only root may chown")
+	}
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := remapContext(t, "--user", "1000", "busybox")
+	c.NotifySocket = dir + "/systemd"
+	c.NotifyProxy = dir + "/proxy/notify"
+	err = openNotifyProxy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeNotifyProxy(c)
+
+	for _, file := range []string{path.Dir(c.NotifyProxy), c.NotifyProxy} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner := info.Sys().(*syscall.Stat_t); owner.Uid != 101000 || owner.Gid != 100000 {
+			t.Fatal(file, "not handed to the container", owner.Uid, owner.Gid)
+		}
+	}
+}
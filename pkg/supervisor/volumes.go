@@ -0,0 +1,111 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+/* bindSources returns the host paths of the bind mounts in docker run args,
+ * named volumes are left to docker */
+func bindSources(args []string) []string {
+	flags, _ := parseRunArgs(args)
+
+	sources := []string{}
+	for _, f := range flags {
+		switch f.Name {
+		case "volume":
+			source := strings.SplitN(f.Value, ":", 2)[0]
+			if strings.HasPrefix(source, "/") && strings.Contains(f.Value, ":") {
+				sources = append(sources, source)
+			}
+		case "mount":
+			bind := false
+			source := ""
+			for _, field := range strings.Split(f.Value, ",") {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch kv[0] {
+				case "type":
+					bind = kv[1] == "bind"
+				case "source", "src":
+					source = kv[1]
+				}
+			}
+			if bind && strings.HasPrefix(source, "/") {
+				sources = append(sources, source)
+			}
+		}
+	}
+
+	return sources
+}
+
+/* parseOwner takes user[:group], as names or numbers */
+func parseOwner(owner string) (int, int, error) {
+	parts := strings.SplitN(owner, ":", 2)
+
+	uid, err := strconv.Atoi(parts[0])
+	gid := -1
+	if err != nil {
+		u, err := user.Lookup(parts[0])
+		if err != nil {
+			return 0, 0, errors.New(fmt.Sprintf("Invalid --mkdir-owner %s: %s", owner, err))
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+
+	if len(parts) == 2 {
+		gid, err = strconv.Atoi(parts[1])
+		if err != nil {
+			g, err := user.LookupGroup(parts[1])
+			if err != nil {
+				return 0, 0, errors.New(fmt.Sprintf("Invalid --mkdir-owner %s: %s", owner, err))
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+/* Docker creates missing bind mount sources owned by root (or fails, for
+ * --mount), with --mkdir-volumes we create them as configured instead */
+func mkdirVolumes(c *Context) error {
+	if !c.MkdirVolumes {
+		return nil
+	}
+
+	for _, source := range bindSources(c.Args) {
+		if _, err := os.Stat(source); err == nil || !os.IsNotExist(err) {
+			continue
+		}
+
+		logInfo("Creating volume directory", source)
+		err := os.MkdirAll(source, c.MkdirMode)
+		if err != nil {
+			return err
+		}
+
+		/* MkdirAll is subject to the umask */
+		err = os.Chmod(source, c.MkdirMode)
+		if err != nil {
+			return err
+		}
+
+		if c.MkdirUid >= 0 {
+			err = os.Chown(source, c.MkdirUid, c.MkdirGid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
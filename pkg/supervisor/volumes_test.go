@@ -0,0 +1,58 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBindSources(t *testing.T) {
+	sources := bindSources([]string{"-v", "/srv/data:/data", "-v", "named:/cache", "-v", "/anonymous",
+		"--mount", "type=bind,source=/srv/conf,target=/conf,readonly", "--mount", "type=volume,src=vol,dst=/vol",
+		"busybox", "-v", "/not:/mine"})
+
+	if strings.Join(sources, " ") != "/srv/data /srv/conf" {
+		t.Fatal("Bad bind sources", sources)
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	uid, gid, err := parseOwner("1000:1001")
+	if err != nil || uid != 1000 || gid != 1001 {
+		t.Fatal("Bad owner", uid, gid, err)
+	}
+
+	uid, gid, err = parseOwner("root")
+	if err != nil || uid != 0 || gid != 0 {
+		t.Fatal("Bad owner", uid, gid, err)
+	}
+
+	_, _, err = parseOwner("no-such-user-here")
+	if err == nil {
+		t.Fatal("Expected an unknown user to fail")
+	}
+}
+
+func TestMkdirVolumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "volumes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Parse([]string{"--mkdir-volumes", "--mkdir-mode", "0750", "run", "-v", dir + "/a/b:/data", "busybox"})
+	if err != nil {
+		t.Fatal("failed to parse:", err)
+	}
+
+	err = mkdirVolumes(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dir + "/a/b")
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0750 {
+		t.Fatal("Volume directory not created", info, err)
+	}
+}
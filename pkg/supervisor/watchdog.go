@@ -0,0 +1,81 @@
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* With WatchdogSec= systemd expects WATCHDOG=1 regularly.  We send it while
+ * the container is healthy, once Docker's health check says unhealthy we
+ * stop (or trigger the watchdog right away) and systemd restarts the unit. */
+
+func watchdogInterval() time.Duration {
+	pid := os.Getenv("WATCHDOG_PID")
+	if len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
+
+/* healthStatus takes a health_status event action, like
+ * "health_status: unhealthy" */
+func healthStatus(action string) (string, bool) {
+	if !strings.HasPrefix(action, "health_status:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(action, "health_status:")), true
+}
+
+func setHealth(c *Context, status string) {
+	var unhealthy int32
+	if status == "unhealthy" {
+		unhealthy = 1
+	}
+
+	markUnhealthy(c, unhealthy == 1)
+	if atomic.SwapInt32(&c.Unhealthy, unhealthy) != unhealthy {
+		logInfo(fmt.Sprintf("Container %s is %s", shortId(c.Id), status))
+	}
+}
+
+func isUnhealthy(c *Context) bool {
+	return atomic.LoadInt32(&c.Unhealthy) != 0
+}
+
+/* runWatchdog pets the watchdog until the container turns unhealthy.  With
+ * --notify the container gets the watchdog to itself.  While an update
+ * replaces the container there is none to vouch for, an update that takes
+ * longer than WatchdogSec= fails the unit. */
+func runWatchdog(c *Context) {
+	interval := watchdogInterval()
+	if interval <= 0 || c.Notify {
+		return
+	}
+
+	triggered := false
+	for {
+		if updating(c) {
+			logDebug("Not petting the watchdog while the container is updated")
+		} else if !isUnhealthy(c) {
+			triggered = false
+			sendNotify(c, "WATCHDOG=1")
+		} else if c.WatchdogTrigger && !triggered {
+			triggered = true
+			sendNotify(c, "STATUS=Container is unhealthy\nWATCHDOG=trigger")
+		}
+
+		if sleepContext(c, interval/2) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package supervisor
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Setenv("WATCHDOG_USEC", "2000000")
+	if watchdogInterval() != 2*time.Second {
+		t.Fatal("Expected 2s, got", watchdogInterval())
+	}
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if watchdogInterval() != 0 {
+		t.Fatal("Watchdog of another process should be ignored")
+	}
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("WATCHDOG_USEC", "bad")
+	if watchdogInterval() != 0 {
+		t.Fatal("Invalid WATCHDOG_USEC should be ignored")
+	}
+}
+
+func TestHealthStatus(t *testing.T) {
+	status, ok := healthStatus("health_status: unhealthy")
+	if !ok || status != "unhealthy" {
+		t.Fatal("Bad status", status)
+	}
+
+	_, ok = healthStatus("die")
+	if ok {
+		t.Fatal("die is not a health event")
+	}
+
+	c := &Context{Id: "abc"}
+	setHealth(c, "unhealthy")
+	if !isUnhealthy(c) {
+		t.Fatal("Expected unhealthy")
+	}
+	setHealth(c, "healthy")
+	if isUnhealthy(c) {
+		t.Fatal("Expected healthy")
+	}
+}
+
+func TestWatchdogTrigger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := dir + "/notify"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("WATCHDOG_USEC", "20000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	c := &Context{Id: "abc", NotifySocket: socket, WatchdogTrigger: true}
+	go runWatchdog(c)
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "WATCHDOG=1" {
+		t.Fatal("Expected WATCHDOG=1, got", string(buf[:n]), err)
+	}
+
+	setHealth(c, "unhealthy")
+	for {
+		n, err = conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "WATCHDOG=1" {
+			break
+		}
+	}
+
+	if string(buf[:n]) != "STATUS=Container is unhealthy\nWATCHDOG=trigger" {
+		t.Fatal("Expected trigger, got", string(buf[:n]))
+	}
+
+	/* Nothing more while unhealthy */
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = conn.Read(buf)
+	if err == nil {
+		t.Fatal("Expected no more watchdog messages")
+	}
+}
+
+func TestWatchdogWhileUpdating(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := dir + "/notify"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("WATCHDOG_USEC", "20000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Context{Id: "abc", NotifySocket: socket, Ctx: ctx, updating: 1}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWatchdog(c)
+	}()
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := conn.Read(buf)
+	if err == nil {
+		t.Fatal("No container to vouch for while updating, got", string(buf[:n]))
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The watchdog outlived the unit")
+	}
+}